@@ -0,0 +1,137 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+)
+
+// AccessWitness records the keys that are read and written during the
+// execution of a block, which are the keys that its witness has to prove,
+// and those that EIP-4762 charges gas for. It is safe for concurrent use.
+type AccessWitness struct {
+	mu   sync.Mutex
+	keys map[[KeySize]byte]accessMode
+}
+
+type accessMode byte
+
+const (
+	accessRead accessMode = 1 << iota
+	accessWrite
+)
+
+// NewAccessWitness creates an empty AccessWitness.
+func NewAccessWitness() *AccessWitness {
+	return &AccessWitness{keys: make(map[[KeySize]byte]accessMode)}
+}
+
+func (aw *AccessWitness) record(key []byte, mode accessMode) {
+	if len(key) != KeySize {
+		return
+	}
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	aw.keys[[KeySize]byte(key)] |= mode
+}
+
+// Keys returns the sorted list of the keys that were accessed.
+func (aw *AccessWitness) Keys() [][]byte {
+	return aw.sortedKeys(accessRead | accessWrite)
+}
+
+// WrittenKeys returns the sorted list of the keys that were written to.
+func (aw *AccessWitness) WrittenKeys() [][]byte {
+	return aw.sortedKeys(accessWrite)
+}
+
+// Stems returns the sorted list of the stems of the keys that were
+// accessed.
+func (aw *AccessWitness) Stems() []Stem {
+	var stems []Stem
+	for _, key := range aw.Keys() {
+		if stem := KeyToStem(key); len(stems) == 0 || stems[len(stems)-1] != stem {
+			stems = append(stems, stem)
+		}
+	}
+	return stems
+}
+
+// Reset forgets all the recorded accesses.
+func (aw *AccessWitness) Reset() {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	clear(aw.keys)
+}
+
+func (aw *AccessWitness) sortedKeys(mode accessMode) [][]byte {
+	aw.mu.Lock()
+	keys := make([][]byte, 0, len(aw.keys))
+	for key, m := range aw.keys {
+		if m&mode != 0 {
+			keys = append(keys, append([]byte{}, key[:]...))
+		}
+	}
+	aw.mu.Unlock()
+	slices.SortFunc(keys, bytes.Compare)
+	return keys
+}
+
+// AccessRecorder is a tree that records every key accessed through Get,
+// Insert and Delete in an AccessWitness, so that the code using the tree
+// doesn't have to.
+type AccessRecorder struct {
+	VerkleNode
+	witness *AccessWitness
+}
+
+// NewAccessRecorder wraps a tree so that its accesses are recorded in the
+// given witness.
+func NewAccessRecorder(root VerkleNode, witness *AccessWitness) *AccessRecorder {
+	return &AccessRecorder{VerkleNode: root, witness: witness}
+}
+
+// Witness returns the AccessWitness that accesses are recorded in.
+func (r *AccessRecorder) Witness() *AccessWitness {
+	return r.witness
+}
+
+func (r *AccessRecorder) Get(key []byte, resolver NodeResolverFn) ([]byte, error) {
+	r.witness.record(key, accessRead)
+	return r.VerkleNode.Get(key, resolver)
+}
+
+func (r *AccessRecorder) Insert(key []byte, value []byte, resolver NodeResolverFn) error {
+	r.witness.record(key, accessWrite)
+	return r.VerkleNode.Insert(key, value, resolver)
+}
+
+func (r *AccessRecorder) Delete(key []byte, resolver NodeResolverFn) (bool, error) {
+	r.witness.record(key, accessWrite)
+	return r.VerkleNode.Delete(key, resolver)
+}
@@ -0,0 +1,58 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAccessRecorder(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	witness := NewAccessWitness()
+	tree := NewAccessRecorder(root, witness)
+	if _, err := tree.Get(fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error getting: %v", err)
+	}
+	if _, err := tree.Get(ffx32KeyTest, nil); err != nil {
+		t.Fatalf("error getting: %v", err)
+	}
+	if err := tree.Insert(oneKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if _, err := tree.Delete(zeroKeyTest, nil); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+
+	checkKeys := func(got, expected [][]byte) {
+		t.Helper()
+		if len(got) != len(expected) {
+			t.Fatalf("invalid number of keys, got %d, expected %d", len(got), len(expected))
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], expected[i]) {
+				t.Fatalf("invalid key #%d, got %x, expected %x", i, got[i], expected[i])
+			}
+		}
+	}
+	checkKeys(witness.Keys(), [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest, ffx32KeyTest})
+	checkKeys(witness.WrittenKeys(), [][]byte{zeroKeyTest, oneKeyTest})
+	if stems := witness.Stems(); len(stems) != 3 {
+		t.Fatalf("invalid number of stems: %d", len(stems))
+	}
+
+	// The recorded keys can be proven directly.
+	if _, _, _, _, err := MakeVerkleMultiProof(tree, nil, witness.Keys(), nil); err != nil {
+		t.Fatalf("error proving the recorded keys: %v", err)
+	}
+
+	witness.Reset()
+	if keys := witness.Keys(); len(keys) != 0 {
+		t.Fatalf("keys left after reset: %x", keys)
+	}
+}
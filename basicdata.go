@@ -0,0 +1,105 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Offsets of the fields of the basic data of an account, as defined by
+// EIP-6800. All of them are big-endian.
+const (
+	BasicDataVersionOffset  = 0
+	BasicDataCodeSizeOffset = 5
+	BasicDataNonceOffset    = 8
+	BasicDataBalanceOffset  = 16
+
+	basicDataCodeSizeBytes = BasicDataNonceOffset - BasicDataCodeSizeOffset
+	basicDataBalanceBytes  = leafBasicDataSize - BasicDataBalanceOffset
+)
+
+// BasicData holds the fields that are packed in the value found at
+// BasicDataLeafKey in the leaf of the header of an account.
+type BasicData struct {
+	Version  uint8
+	CodeSize uint32 // at most 24 bits
+	Nonce    uint64
+	Balance  *big.Int // at most 128 bits, nil means zero
+}
+
+// Encode returns the 32-byte value that holds the basic data.
+func (bd BasicData) Encode() ([]byte, error) {
+	if bd.CodeSize >= 1<<(8*basicDataCodeSizeBytes) {
+		return nil, fmt.Errorf("code size %d doesn't fit in %d bytes", bd.CodeSize, basicDataCodeSizeBytes)
+	}
+	if bd.Balance != nil && (bd.Balance.Sign() < 0 || bd.Balance.BitLen() > 8*basicDataBalanceBytes) {
+		return nil, fmt.Errorf("balance %s doesn't fit in %d bytes", bd.Balance, basicDataBalanceBytes)
+	}
+	value := make([]byte, leafBasicDataSize)
+	value[BasicDataVersionOffset] = bd.Version
+	var codeSize [4]byte
+	binary.BigEndian.PutUint32(codeSize[:], bd.CodeSize)
+	copy(value[BasicDataCodeSizeOffset:BasicDataNonceOffset], codeSize[4-basicDataCodeSizeBytes:])
+	binary.BigEndian.PutUint64(value[BasicDataNonceOffset:], bd.Nonce)
+	if bd.Balance != nil {
+		bd.Balance.FillBytes(value[BasicDataBalanceOffset:])
+	}
+	return value, nil
+}
+
+// DecodeBasicData parses the basic data held in a 32-byte value.
+func DecodeBasicData(value []byte) (BasicData, error) {
+	if len(value) != leafBasicDataSize {
+		return BasicData{}, fmt.Errorf("invalid basic data length %d, expected %d", len(value), leafBasicDataSize)
+	}
+	var codeSize [4]byte
+	copy(codeSize[4-basicDataCodeSizeBytes:], value[BasicDataCodeSizeOffset:BasicDataNonceOffset])
+	return BasicData{
+		Version:  value[BasicDataVersionOffset],
+		CodeSize: binary.BigEndian.Uint32(codeSize[:]),
+		Nonce:    binary.BigEndian.Uint64(value[BasicDataNonceOffset:BasicDataBalanceOffset]),
+		Balance:  new(big.Int).SetBytes(value[BasicDataBalanceOffset:]),
+	}, nil
+}
+
+// errNoBasicData is returned by LeafNode.BasicData when the leaf doesn't
+// hold any basic data.
+var errNoBasicData = errors.New("leaf holds no basic data")
+
+// BasicData decodes the basic data held by the leaf, which must be the
+// header of an account.
+func (n *LeafNode) BasicData() (BasicData, error) {
+	if n.isPOAStub {
+		return BasicData{}, ErrIsPOAStub
+	}
+	if n.values[BasicDataLeafKey] == nil {
+		return BasicData{}, errNoBasicData
+	}
+	return DecodeBasicData(n.values[BasicDataLeafKey])
+}
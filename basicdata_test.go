@@ -0,0 +1,72 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestBasicData(t *testing.T) {
+	t.Parallel()
+
+	balance, _ := new(big.Int).SetString("0102030405060708090a0b0c0d0e0f10", 16)
+	bd := BasicData{Version: 1, CodeSize: 0x123456, Nonce: 0x1122334455667788, Balance: balance}
+	value, err := bd.Encode()
+	if err != nil {
+		t.Fatalf("error encoding: %v", err)
+	}
+	expected, _ := hex.DecodeString("01000000001234561122334455667788" + "0102030405060708090a0b0c0d0e0f10")
+	if !bytes.Equal(value, expected) {
+		t.Fatalf("invalid encoding %x, expected %x", value, expected)
+	}
+	decoded, err := DecodeBasicData(value)
+	if err != nil {
+		t.Fatalf("error decoding: %v", err)
+	}
+	if decoded.Version != bd.Version || decoded.CodeSize != bd.CodeSize || decoded.Nonce != bd.Nonce || decoded.Balance.Cmp(balance) != 0 {
+		t.Fatalf("invalid decoded basic data %+v", decoded)
+	}
+
+	if value, err := (BasicData{}).Encode(); err != nil || !bytes.Equal(value, make([]byte, 32)) {
+		t.Fatalf("invalid encoding of empty basic data %x: %v", value, err)
+	}
+	for _, invalid := range []BasicData{
+		{CodeSize: 1 << 24},
+		{Balance: new(big.Int).Lsh(big.NewInt(1), 128)},
+		{Balance: big.NewInt(-1)},
+	} {
+		if _, err := invalid.Encode(); err == nil {
+			t.Fatalf("expected an error encoding %+v", invalid)
+		}
+	}
+	if _, err := DecodeBasicData(value[1:]); err == nil {
+		t.Fatal("expected an error decoding a short value")
+	}
+
+	// The basic data of a leaf.
+	key := GetTreeKeyBasicData([]byte{1})
+	root := New()
+	if err := root.Insert(key, value, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	leaf := root.(*InternalNode).children[key[0]].(*LeafNode)
+	if decoded, err := leaf.BasicData(); err != nil || decoded.Nonce != bd.Nonce {
+		t.Fatalf("invalid basic data of the leaf %+v: %v", decoded, err)
+	}
+	if err := root.Insert(GetTreeKeyStorageSlot([]byte{2}, []byte{0}), testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	var other *LeafNode
+	for _, child := range root.(*InternalNode).children {
+		if l, ok := child.(*LeafNode); ok && l != leaf {
+			other = l
+		}
+	}
+	if other == nil {
+		t.Fatal("missing the leaf of the second account")
+	}
+	if _, err := other.BasicData(); err == nil {
+		t.Fatal("expected an error getting the basic data of a leaf without any")
+	}
+}
@@ -0,0 +1,163 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// WriteBatch stages insertions and deletions, and applies them all at once
+// to a tree when it is committed. Until then, the tree is left untouched,
+// so dropping the staged writes with Discard reverts them.
+type WriteBatch struct {
+	root     *InternalNode
+	resolver NodeResolverFn
+	writes   map[[KeySize]byte]stagedWrite
+}
+
+type stagedWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// NewWriteBatch creates an empty batch of writes to the given tree.
+func NewWriteBatch(root VerkleNode, resolver NodeResolverFn) (*WriteBatch, error) {
+	rootNode, ok := root.(*InternalNode)
+	if !ok {
+		return nil, errors.New("root must be an internal node")
+	}
+	return &WriteBatch{
+		root:     rootNode,
+		resolver: resolver,
+		writes:   make(map[[KeySize]byte]stagedWrite),
+	}, nil
+}
+
+// Len returns the number of keys that the batch writes to.
+func (b *WriteBatch) Len() int {
+	return len(b.writes)
+}
+
+// Insert stages the insertion of a value.
+func (b *WriteBatch) Insert(key, value []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("invalid key size: %d", len(key))
+	}
+	if value == nil {
+		return errors.New("inserting a nil value")
+	}
+	b.writes[[KeySize]byte(key)] = stagedWrite{value: append([]byte{}, value...)}
+	return nil
+}
+
+// Delete stages the deletion of a key.
+func (b *WriteBatch) Delete(key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("invalid key size: %d", len(key))
+	}
+	b.writes[[KeySize]byte(key)] = stagedWrite{deleted: true}
+	return nil
+}
+
+// Get returns the value of a key, taking the staged writes into account.
+func (b *WriteBatch) Get(key []byte) ([]byte, error) {
+	if len(key) == KeySize {
+		if w, ok := b.writes[[KeySize]byte(key)]; ok {
+			return w.value, nil
+		}
+	}
+	return b.root.Get(key, b.resolver)
+}
+
+// Discard drops all the staged writes.
+func (b *WriteBatch) Discard() {
+	clear(b.writes)
+}
+
+// Commit applies the staged writes to the tree, updates its commitments
+// and returns its new root commitment. The writes are applied to a
+// snapshot of the tree, which replaces the tree only if all of them
+// succeeded, so that the tree is left untouched in case of error. The
+// staged writes are kept in that case, and dropped otherwise.
+func (b *WriteBatch) Commit() (*Point, error) {
+	keys := make([][KeySize]byte, 0, len(b.writes))
+	for key := range b.writes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+
+	// Group the insertions by stem, so that each stem is only
+	// visited once, and apply the deletions afterwards.
+	var (
+		snap    = b.root.Snapshot()
+		stem    Stem
+		values  [][]byte
+		deleted [][KeySize]byte
+	)
+	insert := func() error {
+		if values == nil {
+			return nil
+		}
+		if err := snap.InsertValuesAtStem(stem, values, b.resolver); err != nil {
+			return fmt.Errorf("inserting at stem %x: %w", stem, err)
+		}
+		values = nil
+		return nil
+	}
+	for _, key := range keys {
+		w := b.writes[key]
+		if w.deleted {
+			deleted = append(deleted, key)
+			continue
+		}
+		if values != nil && stem != KeyToStem(key[:]) {
+			if err := insert(); err != nil {
+				return nil, err
+			}
+		}
+		if values == nil {
+			stem = KeyToStem(key[:])
+			values = make([][]byte, NodeWidth)
+		}
+		values[key[StemSize]] = w.value
+	}
+	if err := insert(); err != nil {
+		return nil, err
+	}
+	for _, key := range deleted {
+		if _, err := snap.Delete(key[:], b.resolver); err != nil {
+			return nil, fmt.Errorf("deleting %x: %w", key, err)
+		}
+	}
+
+	snap.Commit()
+	*b.root = *snap
+	clear(b.writes)
+	return b.root.commitment, nil
+}
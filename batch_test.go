@@ -0,0 +1,131 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeys(t, 50)
+	build := func() VerkleNode {
+		root := New()
+		for _, k := range keys[:20] {
+			if err := root.Insert(k, k, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		root.Commit()
+		return root
+	}
+	root, expected := build(), build()
+	initial := root.Commit().Bytes()
+
+	batch, err := NewWriteBatch(root, nil)
+	if err != nil {
+		t.Fatalf("error creating batch: %v", err)
+	}
+	stage := func(tree interface {
+		Insert([]byte, []byte) error
+		Delete([]byte) error
+	}) {
+		for _, k := range keys[20:] {
+			if err := tree.Insert(k, testValue); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		// Two writes to the same stem, with a deletion in between.
+		sibling := append([]byte{}, keys[0]...)
+		sibling[StemSize] ^= 1
+		if err := tree.Insert(sibling, testValue); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+		if err := tree.Delete(keys[0]); err != nil {
+			t.Fatalf("error deleting: %v", err)
+		}
+		if err := tree.Insert(keys[1], testValue); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	stage(batch)
+
+	// Staged writes are visible through the batch only.
+	if value, err := batch.Get(keys[0]); err != nil || value != nil {
+		t.Fatalf("expected a deleted value, got %x, %v", value, err)
+	}
+	if value, err := root.Get(keys[0], nil); err != nil || !bytes.Equal(value, keys[0]) {
+		t.Fatalf("the tree was modified before commit: %x, %v", value, err)
+	}
+
+	batch.Discard()
+	if _, err := batch.Commit(); err != nil {
+		t.Fatalf("error committing an empty batch: %v", err)
+	}
+	if root.Commit().Bytes() != initial {
+		t.Fatal("a discarded batch modified the tree")
+	}
+
+	stage(batch)
+	if batch.Len() != 33 {
+		t.Fatalf("invalid number of staged writes: %d", batch.Len())
+	}
+	comm, err := batch.Commit()
+	if err != nil {
+		t.Fatalf("error committing: %v", err)
+	}
+	stage(treeWriter{expected})
+	if !comm.Equal(expected.Commit()) || !root.Commit().Equal(comm) {
+		t.Fatal("invalid commitment after the batch was applied")
+	}
+	if batch.Len() != 0 {
+		t.Fatalf("writes were kept after commit: %d", batch.Len())
+	}
+}
+
+func TestWriteBatchRollback(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.(*InternalNode).Flush(func([]byte, VerkleNode) {})
+	initial := root.Commit().Bytes()
+
+	batch, err := NewWriteBatch(root, nil)
+	if err != nil {
+		t.Fatalf("error creating batch: %v", err)
+	}
+	if err := batch.Insert(ffx32KeyTest, testValue); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	// Deletions are applied last and, without a resolver,
+	// deleting from the hashed subtree fails.
+	if err := batch.Delete(oneKeyTest); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if _, err := batch.Commit(); err == nil {
+		t.Fatal("expected an error writing to a hashed node")
+	}
+	if root.Commit().Bytes() != initial {
+		t.Fatal("a failed batch modified the tree")
+	}
+	if _, ok := root.(*InternalNode).children[0xff].(Empty); !ok {
+		t.Fatal("a failed batch inserted a value")
+	}
+}
+
+// treeWriter gives a VerkleNode the write methods of a WriteBatch.
+type treeWriter struct {
+	VerkleNode
+}
+
+func (w treeWriter) Insert(key, value []byte) error {
+	return w.VerkleNode.Insert(key, value, nil)
+}
+
+func (w treeWriter) Delete(key []byte) error {
+	_, err := w.VerkleNode.Delete(key, nil)
+	return err
+}
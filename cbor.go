@@ -0,0 +1,686 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CBOR encoding of tree nodes, stems and proof structures, for use in
+// content-addressed stores. The encoding follows the core deterministic
+// encoding requirements of RFC 8949: integers and lengths use their shortest
+// form, maps are sorted by their encoded keys and indefinite lengths are not
+// used. The same object therefore always produces the same bytes, and the
+// decoder rejects any payload that is not encoded this way.
+//
+// Group elements are encoded as 32-byte compressed byte strings, and missing
+// values as null.
+
+const (
+	cborMajorUint   byte = 0
+	cborMajorBytes  byte = 2
+	cborMajorText   byte = 3
+	cborMajorArray  byte = 4
+	cborMajorMap    byte = 5
+	cborMajorSimple byte = 7
+
+	cborNull = 22
+
+	// cborMaxNesting bounds the recursion of the decoder.
+	cborMaxNesting = 8
+)
+
+var errCBORInvalid = errors.New("invalid cbor encoding")
+
+// cborItem is a decoded, or yet to be encoded, CBOR data item.
+type cborItem struct {
+	major   byte
+	num     uint64      // unsigned integers and simple values
+	bytes   []byte      // byte and text strings
+	items   []cborItem  // arrays
+	entries []cborEntry // maps
+}
+
+type cborEntry struct {
+	key   string
+	value cborItem
+}
+
+func cborUint(n uint64) cborItem           { return cborItem{major: cborMajorUint, num: n} }
+func cborBytes(b []byte) cborItem          { return cborItem{major: cborMajorBytes, bytes: b} }
+func cborArray(items ...cborItem) cborItem { return cborItem{major: cborMajorArray, items: items} }
+func cborMap(entries ...cborEntry) cborItem {
+	return cborItem{major: cborMajorMap, entries: entries}
+}
+
+func cborOptional(value *[32]byte) cborItem {
+	if value == nil {
+		return cborItem{major: cborMajorSimple, num: cborNull}
+	}
+	return cborBytes(value[:])
+}
+
+func cborAppendHead(dst []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(dst, major|byte(n))
+	case n <= 0xff:
+		return append(dst, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(dst, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(dst, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, major|27), n)
+	}
+}
+
+func (item *cborItem) appendTo(dst []byte) []byte {
+	switch item.major {
+	case cborMajorBytes, cborMajorText:
+		dst = cborAppendHead(dst, item.major, uint64(len(item.bytes)))
+		return append(dst, item.bytes...)
+	case cborMajorArray:
+		dst = cborAppendHead(dst, item.major, uint64(len(item.items)))
+		for i := range item.items {
+			dst = item.items[i].appendTo(dst)
+		}
+		return dst
+	case cborMajorMap:
+		type encodedEntry struct {
+			key, value []byte
+		}
+		entries := make([]encodedEntry, len(item.entries))
+		for i, entry := range item.entries {
+			key := cborItem{major: cborMajorText, bytes: []byte(entry.key)}
+			entries[i] = encodedEntry{key.appendTo(nil), entry.value.appendTo(nil)}
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+		dst = cborAppendHead(dst, item.major, uint64(len(entries)))
+		for _, entry := range entries {
+			dst = append(append(dst, entry.key...), entry.value...)
+		}
+		return dst
+	default:
+		return cborAppendHead(dst, item.major, item.num)
+	}
+}
+
+func (item *cborItem) encode() []byte {
+	return item.appendTo(nil)
+}
+
+// cborReadHead reads the head of a data item, and rejects any argument that
+// is not encoded in its shortest form.
+func cborReadHead(buf []byte) (byte, uint64, []byte, error) {
+	if len(buf) == 0 {
+		return 0, 0, nil, errCBORInvalid
+	}
+	major, info := buf[0]>>5, buf[0]&0x1f
+	buf = buf[1:]
+	if info < 24 {
+		return major, uint64(info), buf, nil
+	}
+	if info > 27 {
+		return 0, 0, nil, errCBORInvalid
+	}
+	size := 1 << (info - 24)
+	if len(buf) < size {
+		return 0, 0, nil, errCBORInvalid
+	}
+	var n uint64
+	for _, b := range buf[:size] {
+		n = n<<8 | uint64(b)
+	}
+	if (size == 1 && n < 24) || (size > 1 && n < 1<<(4*size)) {
+		return 0, 0, nil, fmt.Errorf("non-canonical integer encoding: %w", errCBORInvalid)
+	}
+	return major, n, buf[size:], nil
+}
+
+func cborDecodeItem(buf []byte, nesting int) (cborItem, []byte, error) {
+	if nesting > cborMaxNesting {
+		return cborItem{}, nil, fmt.Errorf("nesting too deep: %w", errCBORInvalid)
+	}
+	major, n, buf, err := cborReadHead(buf)
+	if err != nil {
+		return cborItem{}, nil, err
+	}
+	item := cborItem{major: major}
+	switch major {
+	case cborMajorUint:
+		item.num = n
+	case cborMajorBytes, cborMajorText:
+		if uint64(len(buf)) < n {
+			return cborItem{}, nil, errCBORInvalid
+		}
+		item.bytes, buf = buf[:n], buf[n:]
+	case cborMajorArray:
+		// Every item takes at least one byte, which bounds the allocation.
+		if uint64(len(buf)) < n {
+			return cborItem{}, nil, errCBORInvalid
+		}
+		item.items = make([]cborItem, n)
+		for i := range item.items {
+			if item.items[i], buf, err = cborDecodeItem(buf, nesting+1); err != nil {
+				return cborItem{}, nil, err
+			}
+		}
+	case cborMajorMap:
+		if uint64(len(buf)) < 2*n {
+			return cborItem{}, nil, errCBORInvalid
+		}
+		item.entries = make([]cborEntry, n)
+		var prevKey []byte
+		for i := range item.entries {
+			rest := buf
+			key, rest, err := cborDecodeItem(rest, nesting+1)
+			if err != nil {
+				return cborItem{}, nil, err
+			}
+			if key.major != cborMajorText {
+				return cborItem{}, nil, fmt.Errorf("map key is not a text string: %w", errCBORInvalid)
+			}
+			encodedKey := buf[:len(buf)-len(rest)]
+			if i > 0 && bytes.Compare(prevKey, encodedKey) >= 0 {
+				return cborItem{}, nil, fmt.Errorf("unsorted or duplicate map key %q: %w", key.bytes, errCBORInvalid)
+			}
+			prevKey = encodedKey
+			item.entries[i].key = string(key.bytes)
+			if item.entries[i].value, buf, err = cborDecodeItem(rest, nesting+1); err != nil {
+				return cborItem{}, nil, err
+			}
+		}
+	case cborMajorSimple:
+		if n != cborNull {
+			return cborItem{}, nil, fmt.Errorf("unsupported simple value %d: %w", n, errCBORInvalid)
+		}
+		item.num = n
+	default:
+		return cborItem{}, nil, fmt.Errorf("unsupported major type %d: %w", major, errCBORInvalid)
+	}
+	return item, buf, nil
+}
+
+// cborDecode decodes a single data item that spans the whole buffer.
+func cborDecode(buf []byte) (cborItem, error) {
+	item, rest, err := cborDecodeItem(buf, 0)
+	if err != nil {
+		return cborItem{}, err
+	}
+	if len(rest) != 0 {
+		return cborItem{}, fmt.Errorf("%d trailing bytes: %w", len(rest), errCBORInvalid)
+	}
+	return item, nil
+}
+
+// fields returns the values of a map, in the order of the requested keys.
+// The map must contain exactly these keys.
+func (item *cborItem) fields(keys ...string) ([]cborItem, error) {
+	if item.major != cborMajorMap || len(item.entries) != len(keys) {
+		return nil, fmt.Errorf("expected a map with %d entries: %w", len(keys), errCBORInvalid)
+	}
+	values := make([]cborItem, len(keys))
+	for i, key := range keys {
+		found := false
+		for _, entry := range item.entries {
+			if entry.key == key {
+				values[i], found = entry.value, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("missing map key %q: %w", key, errCBORInvalid)
+		}
+	}
+	return values, nil
+}
+
+func (item *cborItem) array() ([]cborItem, error) {
+	if item.major != cborMajorArray {
+		return nil, fmt.Errorf("expected an array: %w", errCBORInvalid)
+	}
+	return item.items, nil
+}
+
+func (item *cborItem) byteValue() (byte, error) {
+	if item.major != cborMajorUint || item.num > 0xff {
+		return 0, fmt.Errorf("expected a byte: %w", errCBORInvalid)
+	}
+	return byte(item.num), nil
+}
+
+func (item *cborItem) byteString(maxSize int) ([]byte, error) {
+	if item.major != cborMajorBytes || len(item.bytes) > maxSize {
+		return nil, fmt.Errorf("expected a byte string of at most %d bytes: %w", maxSize, errCBORInvalid)
+	}
+	return item.bytes, nil
+}
+
+func (item *cborItem) readFixed(dst []byte) error {
+	if item.major != cborMajorBytes || len(item.bytes) != len(dst) {
+		return fmt.Errorf("expected a byte string of %d bytes: %w", len(dst), errCBORInvalid)
+	}
+	copy(dst, item.bytes)
+	return nil
+}
+
+func (item *cborItem) readOptional() (*[32]byte, error) {
+	if item.major == cborMajorSimple {
+		return nil, nil
+	}
+	var value [32]byte
+	if err := item.readFixed(value[:]); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the stem, as a byte string.
+func (s Stem) MarshalCBOR() ([]byte, error) {
+	item := cborBytes(s[:])
+	return item.encode(), nil
+}
+
+// UnmarshalCBOR decodes a stem from its CBOR encoding.
+func (s *Stem) UnmarshalCBOR(buf []byte) error {
+	item, err := cborDecode(buf)
+	if err != nil {
+		return err
+	}
+	return item.readFixed(s[:])
+}
+
+// SerializeNodeCBOR returns the CBOR encoding of an internal or leaf node.
+// The node must have been committed to.
+//
+//	InternalNode:  {"type": 0, "bitlist": bytes, "commitment": bytes}
+//	LeafNode:      {"type": 1, "stem": bytes, "commitment": bytes, "c1": bytes, "c2": bytes,
+//	                "values": [[suffix, value], ...]}
+func SerializeNodeCBOR(node VerkleNode) ([]byte, error) {
+	var item cborItem
+	switch n := node.(type) {
+	case *InternalNode:
+		var bitlist [bitlistSize]byte
+		for i, c := range n.children {
+			if _, ok := c.(Empty); !ok {
+				setBit(bitlist[:], i)
+			}
+		}
+		comm := n.commitment.Bytes()
+		item = cborMap(
+			cborEntry{"type", cborUint(uint64(internalType))},
+			cborEntry{"bitlist", cborBytes(bitlist[:])},
+			cborEntry{"commitment", cborBytes(comm[:])},
+		)
+	case *LeafNode:
+		if n.isPOAStub {
+			return nil, ErrIsPOAStub
+		}
+		c1, c2 := n.c1, n.c2
+		if c1 == nil {
+			c1 = new(Point).SetIdentity()
+		}
+		if c2 == nil {
+			c2 = new(Point).SetIdentity()
+		}
+		comm, c1Bytes, c2Bytes := n.commitment.Bytes(), c1.Bytes(), c2.Bytes()
+		var values []cborItem
+		for i, v := range n.values {
+			if v != nil {
+				values = append(values, cborArray(cborUint(uint64(i)), cborBytes(v)))
+			}
+		}
+		item = cborMap(
+			cborEntry{"type", cborUint(uint64(leafType))},
+			cborEntry{"stem", cborBytes(n.stem[:StemSize])},
+			cborEntry{"commitment", cborBytes(comm[:])},
+			cborEntry{"c1", cborBytes(c1Bytes[:])},
+			cborEntry{"c2", cborBytes(c2Bytes[:])},
+			cborEntry{"values", cborArray(values...)},
+		)
+	default:
+		return nil, fmt.Errorf("can not cbor-encode node of type %T", node)
+	}
+	return item.encode(), nil
+}
+
+// ParseNodeCBOR decodes a node from its CBOR encoding, see SerializeNodeCBOR.
+func ParseNodeCBOR(buf []byte, depth byte) (VerkleNode, error) {
+	item, err := cborDecode(buf)
+	if err != nil {
+		return nil, err
+	}
+	if item.major != cborMajorMap {
+		return nil, ErrInvalidNodeEncoding
+	}
+	var nodeType byte
+	for _, entry := range item.entries {
+		if entry.key == "type" {
+			if nodeType, err = entry.value.byteValue(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch nodeType {
+	case internalType:
+		fields, err := item.fields("type", "bitlist", "commitment")
+		if err != nil {
+			return nil, err
+		}
+		var bitlist [bitlistSize]byte
+		if err := fields[1].readFixed(bitlist[:]); err != nil {
+			return nil, err
+		}
+		node := newInternalNode(depth).(*InternalNode)
+		for i := range node.children {
+			if bit(bitlist[:], i) {
+				node.children[i] = HashedNode{}
+			}
+		}
+		if err := node.commitment.SetBytes(fields[2].bytes); err != nil {
+			return nil, fmt.Errorf("setting commitment: %w", err)
+		}
+		return node, nil
+	case leafType:
+		fields, err := item.fields("type", "stem", "commitment", "c1", "c2", "values")
+		if err != nil {
+			return nil, err
+		}
+		ln := &LeafNode{
+			values:     make([][]byte, NodeWidth),
+			commitment: new(Point),
+			c1:         new(Point),
+			c2:         new(Point),
+			depth:      depth,
+		}
+		if err := fields[1].readFixed(ln.stem[:]); err != nil {
+			return nil, err
+		}
+		for i, p := range []*Point{ln.commitment, ln.c1, ln.c2} {
+			if fields[i+2].major != cborMajorBytes {
+				return nil, ErrInvalidNodeEncoding
+			}
+			if err := p.SetBytes(fields[i+2].bytes); err != nil {
+				return nil, fmt.Errorf("setting commitment #%d: %w", i, err)
+			}
+		}
+		values, err := fields[5].array()
+		if err != nil {
+			return nil, err
+		}
+		for i := range values {
+			pair, err := values[i].array()
+			if err != nil {
+				return nil, err
+			}
+			if len(pair) != 2 {
+				return nil, ErrInvalidNodeEncoding
+			}
+			suffix, err := pair[0].byteValue()
+			if err != nil {
+				return nil, err
+			}
+			value, err := pair[1].byteString(LeafValueSize)
+			if err != nil {
+				return nil, err
+			}
+			ln.values[suffix] = append([]byte{}, value...)
+		}
+		return ln, nil
+	default:
+		return nil, ErrInvalidNodeEncoding
+	}
+}
+
+func (ipp *IPAProof) cborItem() cborItem {
+	cl := make([]cborItem, len(ipp.CL))
+	cr := make([]cborItem, len(ipp.CR))
+	for i := range ipp.CL {
+		cl[i], cr[i] = cborBytes(ipp.CL[i][:]), cborBytes(ipp.CR[i][:])
+	}
+	return cborMap(
+		cborEntry{"cl", cborArray(cl...)},
+		cborEntry{"cr", cborArray(cr...)},
+		cborEntry{"finalEvaluation", cborBytes(ipp.FinalEvaluation[:])},
+	)
+}
+
+func (ipp *IPAProof) fromCBORItem(item *cborItem) error {
+	fields, err := item.fields("cl", "cr", "finalEvaluation")
+	if err != nil {
+		return err
+	}
+	cl, err := fields[0].array()
+	if err != nil {
+		return err
+	}
+	cr, err := fields[1].array()
+	if err != nil {
+		return err
+	}
+	if len(cl) != IPA_PROOF_DEPTH || len(cr) != IPA_PROOF_DEPTH {
+		return fmt.Errorf("invalid IPA proof depth: %w", errCBORInvalid)
+	}
+	for i := range ipp.CL {
+		if err := cl[i].readFixed(ipp.CL[i][:]); err != nil {
+			return err
+		}
+		if err := cr[i].readFixed(ipp.CR[i][:]); err != nil {
+			return err
+		}
+	}
+	return fields[2].readFixed(ipp.FinalEvaluation[:])
+}
+
+// MarshalCBOR returns the CBOR encoding of the IPA proof.
+func (ipp *IPAProof) MarshalCBOR() ([]byte, error) {
+	item := ipp.cborItem()
+	return item.encode(), nil
+}
+
+// UnmarshalCBOR decodes the CBOR encoding of an IPA proof.
+func (ipp *IPAProof) UnmarshalCBOR(buf []byte) error {
+	item, err := cborDecode(buf)
+	if err != nil {
+		return err
+	}
+	return ipp.fromCBORItem(&item)
+}
+
+// MarshalCBOR returns the CBOR encoding of the verkle proof.
+func (vp *VerkleProof) MarshalCBOR() ([]byte, error) {
+	if vp.IPAProof == nil {
+		return nil, errors.New("missing IPA proof")
+	}
+	stems := make([]cborItem, len(vp.OtherStems))
+	for i := range vp.OtherStems {
+		stems[i] = cborBytes(vp.OtherStems[i][:])
+	}
+	comms := make([]cborItem, len(vp.CommitmentsByPath))
+	for i := range vp.CommitmentsByPath {
+		comms[i] = cborBytes(vp.CommitmentsByPath[i][:])
+	}
+	item := cborMap(
+		cborEntry{"otherStems", cborArray(stems...)},
+		cborEntry{"depthExtensionPresent", cborBytes(vp.DepthExtensionPresent)},
+		cborEntry{"commitmentsByPath", cborArray(comms...)},
+		cborEntry{"d", cborBytes(vp.D[:])},
+		cborEntry{"ipaProof", vp.IPAProof.cborItem()},
+	)
+	return item.encode(), nil
+}
+
+// UnmarshalCBOR decodes the CBOR encoding of a verkle proof.
+func (vp *VerkleProof) UnmarshalCBOR(buf []byte) error {
+	item, err := cborDecode(buf)
+	if err != nil {
+		return err
+	}
+	fields, err := item.fields("otherStems", "depthExtensionPresent", "commitmentsByPath", "d", "ipaProof")
+	if err != nil {
+		return err
+	}
+	stems, err := fields[0].array()
+	if err != nil {
+		return err
+	}
+	depths, err := fields[1].byteString(len(buf))
+	if err != nil {
+		return err
+	}
+	comms, err := fields[2].array()
+	if err != nil {
+		return err
+	}
+
+	proof := VerkleProof{
+		OtherStems:            make([][StemSize]byte, len(stems)),
+		DepthExtensionPresent: append([]byte{}, depths...),
+		CommitmentsByPath:     make([][32]byte, len(comms)),
+		IPAProof:              &IPAProof{},
+	}
+	for i := range stems {
+		if err := stems[i].readFixed(proof.OtherStems[i][:]); err != nil {
+			return err
+		}
+	}
+	for i := range comms {
+		if err := comms[i].readFixed(proof.CommitmentsByPath[i][:]); err != nil {
+			return err
+		}
+	}
+	if err := fields[3].readFixed(proof.D[:]); err != nil {
+		return err
+	}
+	if err := proof.IPAProof.fromCBORItem(&fields[4]); err != nil {
+		return fmt.Errorf("decoding IPA proof: %w", err)
+	}
+	*vp = proof
+	return nil
+}
+
+func (ssd *StemStateDiff) cborItem() cborItem {
+	suffixDiffs := make([]cborItem, len(ssd.SuffixDiffs))
+	for i, suffixDiff := range ssd.SuffixDiffs {
+		suffixDiffs[i] = cborMap(
+			cborEntry{"suffix", cborUint(uint64(suffixDiff.Suffix))},
+			cborEntry{"currentValue", cborOptional(suffixDiff.CurrentValue)},
+			cborEntry{"newValue", cborOptional(suffixDiff.NewValue)},
+		)
+	}
+	return cborMap(
+		cborEntry{"stem", cborBytes(ssd.Stem[:])},
+		cborEntry{"suffixDiffs", cborArray(suffixDiffs...)},
+	)
+}
+
+func (ssd *StemStateDiff) fromCBORItem(item *cborItem) error {
+	fields, err := item.fields("stem", "suffixDiffs")
+	if err != nil {
+		return err
+	}
+	var diff StemStateDiff
+	if err := fields[0].readFixed(diff.Stem[:]); err != nil {
+		return err
+	}
+	suffixDiffs, err := fields[1].array()
+	if err != nil {
+		return err
+	}
+	diff.SuffixDiffs = make(SuffixStateDiffs, len(suffixDiffs))
+	for i := range suffixDiffs {
+		values, err := suffixDiffs[i].fields("suffix", "currentValue", "newValue")
+		if err != nil {
+			return err
+		}
+		if diff.SuffixDiffs[i].Suffix, err = values[0].byteValue(); err != nil {
+			return err
+		}
+		if diff.SuffixDiffs[i].CurrentValue, err = values[1].readOptional(); err != nil {
+			return err
+		}
+		if diff.SuffixDiffs[i].NewValue, err = values[2].readOptional(); err != nil {
+			return err
+		}
+	}
+	*ssd = diff
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the stem state diff.
+func (ssd *StemStateDiff) MarshalCBOR() ([]byte, error) {
+	item := ssd.cborItem()
+	return item.encode(), nil
+}
+
+// UnmarshalCBOR decodes the CBOR encoding of a stem state diff.
+func (ssd *StemStateDiff) UnmarshalCBOR(buf []byte) error {
+	item, err := cborDecode(buf)
+	if err != nil {
+		return err
+	}
+	return ssd.fromCBORItem(&item)
+}
+
+// MarshalCBOR returns the CBOR encoding of the state diff, as an array of
+// stem state diffs.
+func (sd StateDiff) MarshalCBOR() ([]byte, error) {
+	stemDiffs := make([]cborItem, len(sd))
+	for i := range sd {
+		stemDiffs[i] = sd[i].cborItem()
+	}
+	item := cborArray(stemDiffs...)
+	return item.encode(), nil
+}
+
+// UnmarshalCBOR decodes the CBOR encoding of a state diff.
+func (sd *StateDiff) UnmarshalCBOR(buf []byte) error {
+	item, err := cborDecode(buf)
+	if err != nil {
+		return err
+	}
+	stemDiffs, err := item.array()
+	if err != nil {
+		return err
+	}
+	diff := make(StateDiff, len(stemDiffs))
+	for i := range stemDiffs {
+		if err := diff[i].fromCBORItem(&stemDiffs[i]); err != nil {
+			return err
+		}
+	}
+	*sd = diff
+	return nil
+}
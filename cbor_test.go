@@ -0,0 +1,154 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCBORProofRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(keys[0], fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	postroot.Commit()
+
+	proveKeys := [][]byte{keys[0], keys[1], zeroKeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, proveKeys, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	vp, statediff, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatalf("error serializing proof: %v", err)
+	}
+
+	encoded, err := vp.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("error encoding proof: %v", err)
+	}
+	var decoded VerkleProof
+	if err := decoded.UnmarshalCBOR(encoded); err != nil {
+		t.Fatalf("error decoding proof: %v", err)
+	}
+	if err := decoded.Equal(vp); err != nil {
+		t.Fatalf("decoded proof differs: %v", err)
+	}
+	if *decoded.IPAProof != *vp.IPAProof {
+		t.Fatal("decoded IPA proof differs")
+	}
+
+	encoded, err = statediff.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("error encoding state diff: %v", err)
+	}
+	var decodedDiff StateDiff
+	if err := decodedDiff.UnmarshalCBOR(encoded); err != nil {
+		t.Fatalf("error decoding state diff: %v", err)
+	}
+	if err := decodedDiff.Equal(statediff); err != nil {
+		t.Fatalf("decoded state diff differs: %v", err)
+	}
+	reencoded, err := decodedDiff.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("error encoding state diff: %v", err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Fatal("re-encoding the state diff produced different bytes")
+	}
+
+	if err := decodedDiff.UnmarshalCBOR(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated state diff")
+	}
+}
+
+func TestCBORNodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, testValue[:3], nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	encoded, err := SerializeNodeCBOR(root)
+	if err != nil {
+		t.Fatalf("error encoding root: %v", err)
+	}
+	decoded, err := ParseNodeCBOR(encoded, 0)
+	if err != nil {
+		t.Fatalf("error decoding root: %v", err)
+	}
+	if !decoded.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	reencoded, err := SerializeNodeCBOR(decoded)
+	if err != nil {
+		t.Fatalf("error encoding root: %v", err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Fatal("re-encoding the root produced different bytes")
+	}
+
+	leaf := root.(*InternalNode).children[0].(*LeafNode)
+	encoded, err = SerializeNodeCBOR(leaf)
+	if err != nil {
+		t.Fatalf("error encoding leaf: %v", err)
+	}
+	decoded, err = ParseNodeCBOR(encoded, 1)
+	if err != nil {
+		t.Fatalf("error decoding leaf: %v", err)
+	}
+	dleaf := decoded.(*LeafNode)
+	if !dleaf.commitment.Equal(leaf.commitment) || !dleaf.c1.Equal(leaf.c1) || !dleaf.c2.Equal(leaf.c2) {
+		t.Fatal("invalid leaf commitments")
+	}
+	for i := range leaf.values {
+		if !bytes.Equal(leaf.values[i], dleaf.values[i]) {
+			t.Fatalf("invalid value #%d: got %x, expected %x", i, dleaf.values[i], leaf.values[i])
+		}
+	}
+
+	var stem Stem
+	encoded, err = leaf.stem.MarshalCBOR()
+	if err != nil {
+		t.Fatalf("error encoding stem: %v", err)
+	}
+	if err := stem.UnmarshalCBOR(encoded); err != nil {
+		t.Fatalf("error decoding stem: %v", err)
+	}
+	if !bytes.Equal(stem[:], leaf.stem[:]) {
+		t.Fatalf("invalid stem, got %x, expected %x", stem, leaf.stem)
+	}
+}
+
+func TestCBORRejectsNonCanonical(t *testing.T) {
+	t.Parallel()
+
+	for _, encoded := range [][]byte{
+		{0xa2, 0x61, 'b', 0x00, 0x61, 'a', 0x00}, // unsorted map keys
+		{0xa2, 0x61, 'a', 0x00, 0x61, 'a', 0x00}, // duplicate map keys
+		{0x18, 0x01},                             // integer not in its shortest form
+		{0x9f, 0xff},                             // indefinite-length array
+		{0x00, 0x00},                             // trailing bytes
+	} {
+		if _, err := cborDecode(encoded); err == nil {
+			t.Fatalf("expected an error decoding %x", encoded)
+		}
+	}
+}
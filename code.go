@@ -0,0 +1,69 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+const (
+	push1  = 0x60
+	push32 = 0x7f
+
+	// CodeChunkSize is the number of bytes of code held by a chunk,
+	// after the byte that counts the leading PUSH data bytes.
+	CodeChunkSize = LeafValueSize - 1
+)
+
+// ChunkifyCode splits the code of an account into the values stored at
+// the keys returned by GetTreeKeyCodeChunk, as defined by EIP-6800. Each
+// value holds CodeChunkSize bytes of code, zero-padded at the end of the
+// code, after a byte that counts how many of them are the data of a PUSH
+// instruction of a previous chunk, so that the code can be executed from
+// any chunk.
+func ChunkifyCode(code []byte) [][]byte {
+	count := (len(code) + CodeChunkSize - 1) / CodeChunkSize
+
+	// pushData[i] is the number of PUSH data bytes that remain from
+	// the i-th byte of the code on, including that byte.
+	pushData := make([]int, len(code))
+	for pc := 0; pc < len(code); pc++ {
+		if op := code[pc]; op >= push1 && op <= push32 {
+			n := int(op-push1) + 1
+			for i := 0; i < n && pc+1+i < len(code); i++ {
+				pushData[pc+1+i] = n - i
+			}
+			pc += n
+		}
+	}
+
+	chunks := make([][]byte, count)
+	buf := make([]byte, count*LeafValueSize)
+	for i := range chunks {
+		chunk := buf[i*LeafValueSize : (i+1)*LeafValueSize]
+		start := i * CodeChunkSize
+		chunk[0] = byte(min(pushData[start], CodeChunkSize))
+		copy(chunk[1:], code[start:min(start+CodeChunkSize, len(code))])
+		chunks[i] = chunk
+	}
+	return chunks
+}
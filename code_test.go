@@ -0,0 +1,54 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChunkifyCode(t *testing.T) {
+	t.Parallel()
+
+	if chunks := ChunkifyCode(nil); len(chunks) != 0 {
+		t.Fatalf("expected no chunks, got %d", len(chunks))
+	}
+
+	// PUSH32 at the start of the code, whose data spills 2 bytes
+	// into the second chunk.
+	code := append([]byte{push32}, bytes.Repeat([]byte{0xaa}, 32)...)
+	code = append(code, 0x00)
+	chunks := ChunkifyCode(code)
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	if chunks[0][0] != 0 || !bytes.Equal(chunks[0][1:], code[:31]) {
+		t.Fatalf("invalid first chunk %x", chunks[0])
+	}
+	if chunks[1][0] != 2 || !bytes.Equal(chunks[1][1:4], code[31:]) || !bytes.Equal(chunks[1][4:], make([]byte, 28)) {
+		t.Fatalf("invalid second chunk %x", chunks[1])
+	}
+
+	// PUSH32 at the end of the first chunk, whose data covers the
+	// whole second chunk and one byte of the third.
+	code = make([]byte, 30, 93)
+	code = append(code, push32)
+	code = append(code, bytes.Repeat([]byte{push1}, 32)...)
+	code = append(code, push1, 0xbb)
+	chunks = ChunkifyCode(code)
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+	for i, expected := range []byte{0, 31, 1} {
+		if chunks[i][0] != expected {
+			t.Fatalf("invalid leading byte %d for chunk %d, expected %d", chunks[i][0], i, expected)
+		}
+		if len(chunks[i]) != LeafValueSize {
+			t.Fatalf("invalid length %d for chunk %d", len(chunks[i]), i)
+		}
+	}
+
+	// A PUSH whose data is cut by the end of the code.
+	chunks = ChunkifyCode([]byte{push32, 1, 2})
+	if len(chunks) != 1 || !bytes.Equal(chunks[0][:4], []byte{0, push32, 1, 2}) {
+		t.Fatalf("invalid truncated chunk %x", chunks[0])
+	}
+}
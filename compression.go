@@ -0,0 +1,163 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CompressionAlgorithm identifies the compression applied to a serialized
+// blob, such as a subtree or an export. It is written as the first byte of
+// the compressed data, so that the reader can pick the right decompressor.
+type CompressionAlgorithm byte
+
+const (
+	CompressionNone CompressionAlgorithm = iota
+	CompressionDeflate
+	// The following algorithms are not built in, since they would add a
+	// dependency. Embedders can provide them with RegisterCompressor.
+	CompressionSnappy
+	CompressionZstd
+)
+
+// Compressor creates the streams that compress and decompress data with a
+// given algorithm.
+type Compressor interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type nopCompressor struct{}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (nopCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+func (nopCompressor) NewReader(r io.Reader) (io.ReadCloser, error)  { return io.NopCloser(r), nil }
+
+type deflateCompressor struct{}
+
+func (deflateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func (deflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+var (
+	errUnknownCompression = errors.New("unknown compression algorithm")
+
+	compressorsLock sync.RWMutex
+	compressors     = map[CompressionAlgorithm]Compressor{
+		CompressionNone:    nopCompressor{},
+		CompressionDeflate: deflateCompressor{},
+	}
+)
+
+// RegisterCompressor sets the compressor used for an algorithm, e.g. to
+// provide CompressionSnappy or CompressionZstd.
+func RegisterCompressor(alg CompressionAlgorithm, c Compressor) error {
+	if alg == CompressionNone {
+		return errors.New("can not override the absence of compression")
+	}
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	compressors[alg] = c
+	return nil
+}
+
+func getCompressor(alg CompressionAlgorithm) (Compressor, error) {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	c, ok := compressors[alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", errUnknownCompression, alg)
+	}
+	return c, nil
+}
+
+// NewCompressedWriter writes the algorithm header to w, and returns a
+// writer that compresses everything written to it. It must be closed to
+// flush the compressed stream, which doesn't close w.
+func NewCompressedWriter(w io.Writer, alg CompressionAlgorithm) (io.WriteCloser, error) {
+	c, err := getCompressor(alg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte{byte(alg)}); err != nil {
+		return nil, err
+	}
+	return c.NewWriter(w)
+}
+
+// NewDecompressedReader reads the algorithm header from r, and returns a
+// reader of the decompressed stream. This is how an export compressed with
+// NewCompressedWriter can be passed to ImportTree.
+func NewDecompressedReader(r io.Reader) (io.ReadCloser, error) {
+	var alg [1]byte
+	if _, err := io.ReadFull(r, alg[:]); err != nil {
+		return nil, fmt.Errorf("reading compression header: %w", err)
+	}
+	c, err := getCompressor(CompressionAlgorithm(alg[0]))
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReader(r)
+}
+
+// Compress compresses a serialized blob, e.g. the output of
+// SerializeSubtree, and prefixes it with the algorithm header.
+func Compress(data []byte, alg CompressionAlgorithm) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewCompressedWriter(&buf, alg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress returns the blob that was compressed with Compress.
+func Decompress(data []byte) ([]byte, error) {
+	r, err := NewDecompressedReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
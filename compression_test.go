@@ -0,0 +1,78 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressSubtree(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range randomKeys(t, 100) {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	blob, err := SerializeSubtree(root)
+	if err != nil {
+		t.Fatalf("error serializing subtree: %v", err)
+	}
+
+	for _, alg := range []CompressionAlgorithm{CompressionNone, CompressionDeflate} {
+		compressed, err := Compress(blob, alg)
+		if err != nil {
+			t.Fatalf("error compressing with algorithm %d: %v", alg, err)
+		}
+		if alg == CompressionDeflate && len(compressed) >= len(blob) {
+			t.Fatalf("compressed blob isn't smaller: %d >= %d", len(compressed), len(blob))
+		}
+		decompressed, err := Decompress(compressed)
+		if err != nil {
+			t.Fatalf("error decompressing with algorithm %d: %v", alg, err)
+		}
+		if !bytes.Equal(decompressed, blob) {
+			t.Fatalf("blob differs after a round trip with algorithm %d", alg)
+		}
+	}
+
+	if _, err := Compress(blob, CompressionZstd); !errors.Is(err, errUnknownCompression) {
+		t.Fatalf("expected an unknown compression error, got %v", err)
+	}
+}
+
+func TestCompressExport(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range randomKeys(t, 100) {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := NewCompressedWriter(&buf, CompressionDeflate)
+	if err != nil {
+		t.Fatalf("error creating writer: %v", err)
+	}
+	if err := ExportTree(root, nil, w); err != nil {
+		t.Fatalf("error exporting tree: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing writer: %v", err)
+	}
+
+	r, err := NewDecompressedReader(&buf)
+	if err != nil {
+		t.Fatalf("error creating reader: %v", err)
+	}
+	imported, err := ImportTree(r)
+	if err != nil {
+		t.Fatalf("error importing tree: %v", err)
+	}
+	if !imported.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+}
@@ -38,7 +38,7 @@ const (
 )
 
 func equalPaths(key1, key2 []byte) bool {
-	return bytes.Equal(KeyToStem(key1), KeyToStem(key2))
+	return bytes.Equal(key1[:StemSize], key2[:StemSize])
 }
 
 // offset2key extracts the n bits of a key that correspond to the
@@ -46,3 +46,11 @@ func equalPaths(key1, key2 []byte) bool {
 func offset2key(key []byte, offset byte) byte {
 	return key[offset]
 }
+
+// BitOffsetForDepth returns the position, in bits, at which the child
+// index of a node at the given depth starts within a key. Since a
+// child index is NodeBitWidth bits wide, offset2key reads it from the
+// byte at BitOffsetForDepth(depth)/NodeBitWidth, i.e. at `depth`.
+func (*IPAConfig) BitOffsetForDepth(depth byte) int {
+	return int(depth) * int(NodeBitWidth)
+}
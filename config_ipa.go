@@ -26,6 +26,9 @@
 package verkle
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"sync"
 
 	"github.com/crate-crypto/go-ipa/ipa"
@@ -49,8 +52,9 @@ var (
 	FrZero Fr
 	FrOne  Fr
 
-	cfg     *Config
-	onceCfg sync.Once
+	cfg      *Config
+	onceCfg  sync.Once
+	cfgReady = make(chan struct{})
 )
 
 func init() {
@@ -59,7 +63,8 @@ func init() {
 }
 
 type IPAConfig struct {
-	conf *ipa.IPAConfig
+	conf        *ipa.IPAConfig
+	fingerprint [32]byte
 }
 
 type Config = IPAConfig
@@ -71,6 +76,7 @@ func GetConfig() *Config {
 			panic(err)
 		}
 		cfg = &IPAConfig{conf: conf}
+		cfg.fingerprint = cfg.computeFingerprint()
 
 		// Initialize the empty code cached values.
 		values := make([][]byte, NodeWidth)
@@ -82,11 +88,59 @@ func GetConfig() *Config {
 		EmptyCodeHashPoint = *cfg.CommitToPoly(c1poly[:], 0)
 		EmptyCodeHashFirstHalfValue = c1poly[EmptyCodeHashFirstHalfIdx]
 		EmptyCodeHashSecondHalfValue = c1poly[EmptyCodeHashSecondHalfIdx]
+		close(cfgReady)
 	})
 	return cfg
 }
 
+// InitConfig is like GetConfig, but returns ctx.Err() if ctx is done before
+// the configuration is ready. The initialization then keeps running in the
+// background, and a later call picks up its result. The precomputed tables
+// are already generated on all cores.
+func InitConfig(ctx context.Context) (*Config, error) {
+	select {
+	case <-cfgReady:
+		return cfg, nil
+	default:
+	}
+	go GetConfig()
+	select {
+	case <-cfgReady:
+		return cfg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (conf *IPAConfig) CommitToPoly(poly []Fr, _ int) *Point {
 	ret := conf.conf.Commit(poly)
 	return &ret
 }
+
+// Fingerprint identifies the parameters that commitments depend on: the
+// node width, the curve, the SRS and the tree key layout. Data produced
+// under a configuration with a different fingerprint has incompatible
+// commitments.
+func (conf *IPAConfig) Fingerprint() [32]byte {
+	return conf.fingerprint
+}
+
+func (conf *IPAConfig) computeFingerprint() [32]byte {
+	h := sha256.New()
+	h.Write([]byte("banderwagon"))
+	var buf [8]byte
+	for _, param := range []int{NodeWidth, StemSize, KeySize, len(conf.conf.SRS)} {
+		binary.BigEndian.PutUint64(buf[:], uint64(param))
+		h.Write(buf[:])
+	}
+	for _, point := range conf.conf.SRS {
+		b := point.Bytes()
+		h.Write(b[:])
+	}
+	q := conf.conf.Q.Bytes()
+	h.Write(q[:])
+
+	var fingerprint [32]byte
+	h.Sum(fingerprint[:0])
+	return fingerprint
+}
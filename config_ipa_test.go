@@ -0,0 +1,53 @@
+package verkle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+func TestConfigFingerprint(t *testing.T) {
+	t.Parallel()
+
+	cfg := GetConfig()
+	fingerprint := cfg.Fingerprint()
+	if fingerprint == ([32]byte{}) {
+		t.Fatal("zero fingerprint")
+	}
+	if fingerprint != cfg.computeFingerprint() {
+		t.Fatal("fingerprint isn't stable")
+	}
+
+	// A different SRS yields a different fingerprint.
+	conf := *cfg.conf
+	conf.SRS = append([]banderwagon.Element{}, conf.SRS...)
+	conf.SRS[0] = banderwagon.Generator
+	other := &IPAConfig{conf: &conf}
+	if other.computeFingerprint() == fingerprint {
+		t.Fatal("fingerprint doesn't depend on the SRS")
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if conf, err := InitConfig(ctx); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected a cancellation error, got %v", err)
+		}
+	} else if conf != GetConfig() {
+		t.Fatal("initialized a different config")
+	}
+
+	conf, err := InitConfig(context.Background())
+	if err != nil {
+		t.Fatalf("error initializing config: %v", err)
+	}
+	if conf != GetConfig() {
+		t.Fatal("initialized a different config")
+	}
+}
@@ -62,7 +62,7 @@ func BatchNewLeafNode(nodesValues []BatchNewLeafNodeData) ([]LeafNode, error) {
 				var poly [NodeWidth]Fr
 				poly[0].SetUint64(1)
 				for i, nv := range nodesValues {
-					if err := StemFromLEBytes(&poly[1], nv.Stem); err != nil {
+					if err := StemFromLEBytes(&poly[1], nv.Stem[:]); err != nil {
 						return err
 					}
 					poly[2] = *c1c2frs[2*i]
@@ -80,7 +80,7 @@ func BatchNewLeafNode(nodesValues []BatchNewLeafNodeData) ([]LeafNode, error) {
 	}
 
 	sort.Slice(ret, func(i, j int) bool {
-		return bytes.Compare(ret[i].stem, ret[j].stem) < 0
+		return ret[i].stem.Compare(ret[j].stem) < 0
 	})
 
 	return ret, nil
@@ -99,7 +99,7 @@ func firstDiffByteIdx(stem1 []byte, stem2 []byte) int {
 
 func (n *InternalNode) InsertMigratedLeaves(leaves []LeafNode, resolver NodeResolverFn) error {
 	sort.Slice(leaves, func(i, j int) bool {
-		return bytes.Compare(leaves[i].stem, leaves[j].stem) < 0
+		return leaves[i].stem.Compare(leaves[j].stem) < 0
 	})
 
 	// We first mark all children of the subtreess that we'll update in parallel,
@@ -120,6 +120,7 @@ func (n *InternalNode) InsertMigratedLeaves(leaves []LeafNode, resolver NodeReso
 				n.children[lastChildrenIdx] = resolved
 			}
 			n.cowChild(byte(lastChildrenIdx))
+			n.writableChild(byte(lastChildrenIdx))
 		}
 	}
 
@@ -166,7 +167,8 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 				parent.children[ln.stem[parent.depth]] = resolved
 			}
 
-			nextParent, ok := parent.children[ln.stem[parent.depth]].(*InternalNode)
+			// Copy the nodes shared with a snapshot before writing to them.
+			nextParent, ok := parent.writableChild(ln.stem[parent.depth]).(*InternalNode)
 			if !ok {
 				break
 			}
@@ -175,13 +177,14 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 			parent = nextParent
 		}
 
-		switch node := parent.children[ln.stem[parent.depth]].(type) {
+		switch node := parent.writableChild(ln.stem[parent.depth]).(type) {
 		case Empty:
 			parent.cowChild(ln.stem[parent.depth])
 			parent.children[ln.stem[parent.depth]] = &ln
 			ln.setDepth(parent.depth + 1)
+			ln.owner = parent.owner
 		case *LeafNode:
-			if bytes.Equal(node.stem, ln.stem) {
+			if node.stem == ln.stem {
 				// In `ln` we have migrated key/values which should be copied to the leaf
 				// only if there isn't a value there. If there's a value, we skip it since
 				// our migrated value is stale.
@@ -199,7 +202,7 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 			}
 
 			// Otherwise, we need to create the missing internal nodes depending in the fork point in their stems.
-			idx := firstDiffByteIdx(node.stem, ln.stem)
+			idx := firstDiffByteIdx(node.stem[:], ln.stem[:])
 			// We do a sanity check to make sure that the fork point is not before the current depth.
 			if byte(idx) <= parent.depth {
 				return fmt.Errorf("unexpected fork point %d for nodes %x and %x", idx, node.stem, ln.stem)
@@ -207,6 +210,7 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 			// Create the missing internal nodes.
 			for i := parent.depth + 1; i <= byte(idx); i++ {
 				nextParent := newInternalNode(parent.depth + 1).(*InternalNode)
+				nextParent.owner = parent.owner
 				parent.cowChild(ln.stem[parent.depth])
 				parent.children[ln.stem[parent.depth]] = nextParent
 				parent = nextParent
@@ -218,9 +222,104 @@ func (n *InternalNode) insertMigratedLeavesSubtree(leaves []LeafNode, resolver N
 			parent.cowChild(ln.stem[parent.depth])
 			parent.children[ln.stem[parent.depth]] = &ln
 			ln.setDepth(parent.depth + 1)
+			ln.owner = parent.owner
 		default:
 			return fmt.Errorf("unexpected node type %T", node)
 		}
 	}
 	return nil
 }
+
+// KeyValueIterator is a stream of key-value pairs, as produced by Iterator.
+type KeyValueIterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+}
+
+// BuildFromSorted builds a tree from a stream of key-value pairs sorted by
+// key, such as a genesis allocation or a snapshot. The tree is built
+// bottom-up, so that the commitment of each node is computed exactly once,
+// which is much faster than inserting the keys one by one. The returned
+// tree is committed.
+func BuildFromSorted(it KeyValueIterator) (VerkleNode, error) {
+	var (
+		data []BatchNewLeafNodeData
+		last []byte
+	)
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("invalid key size: %d", len(key))
+		}
+		if last != nil && bytes.Compare(last, key) >= 0 {
+			return nil, fmt.Errorf("keys are not sorted: %x after %x", key, last)
+		}
+		last = append(last[:0], key...)
+
+		stem := KeyToStem(key)
+		if len(data) == 0 || data[len(data)-1].Stem != stem {
+			data = append(data, BatchNewLeafNodeData{Stem: stem, Values: map[byte][]byte{}})
+		}
+		data[len(data)-1].Values[key[StemSize]] = append([]byte{}, value...)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return New(), nil
+	}
+
+	leaves, err := BatchNewLeafNode(data)
+	if err != nil {
+		return nil, err
+	}
+	return buildFromSortedLeaves(leaves, 0)
+}
+
+// buildFromSortedLeaves creates the internal node at the given depth that
+// holds the leaves, which must share their first depth bytes, and computes
+// its commitment from those of its children.
+func buildFromSortedLeaves(leaves []LeafNode, depth byte) (*InternalNode, error) {
+	node := newInternalNode(depth).(*InternalNode)
+	var (
+		points  []*Point
+		indices []int
+	)
+	for start := 0; start < len(leaves); {
+		idx := leaves[start].stem[depth]
+		end := start + 1
+		for end < len(leaves) && leaves[end].stem[depth] == idx {
+			end++
+		}
+		if end-start == 1 {
+			leaf := &leaves[start]
+			leaf.setDepth(depth + 1)
+			node.children[idx] = leaf
+		} else {
+			child, err := buildFromSortedLeaves(leaves[start:end], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.children[idx] = child
+		}
+		points = append(points, node.children[idx].Commitment())
+		indices = append(indices, int(idx))
+		start = end
+	}
+
+	frs := make([]*Fr, len(points))
+	for i := range frs {
+		frs[i] = new(Fr)
+	}
+	if err := banderwagon.BatchMapToScalarField(frs, points); err != nil {
+		return nil, fmt.Errorf("mapping to scalar field: %s", err)
+	}
+	var poly [NodeWidth]Fr
+	for i, idx := range indices {
+		poly[idx] = *frs[i]
+	}
+	node.commitment = GetConfig().CommitToPoly(poly[:], NodeWidth-len(indices))
+	return node, nil
+}
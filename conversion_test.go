@@ -0,0 +1,64 @@
+package verkle
+
+import (
+	"testing"
+)
+
+// sliceIterator is a KeyValueIterator over a list of keys, each of which
+// is used as its own value.
+type sliceIterator struct {
+	keys [][]byte
+	pos  int
+}
+
+func (it *sliceIterator) Next() bool    { it.pos++; return it.pos <= len(it.keys) }
+func (it *sliceIterator) Key() []byte   { return it.keys[it.pos-1] }
+func (it *sliceIterator) Value() []byte { return it.keys[it.pos-1] }
+func (it *sliceIterator) Error() error  { return nil }
+
+func TestBuildFromSorted(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeysSorted(t, 300)
+	// Add a few keys that share their stem with another one.
+	for _, i := range []int{0, 100, 299} {
+		key := append([]byte{}, keys[i]...)
+		key[StemSize] ^= 0xff
+		keys = append(keys, key)
+	}
+	expected := New()
+	for _, k := range keys {
+		if err := expected.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+
+	it, err := NewIterator(expected, nil)
+	if err != nil {
+		t.Fatalf("error creating iterator: %v", err)
+	}
+	root, err := BuildFromSorted(it)
+	if err != nil {
+		t.Fatalf("error building tree: %v", err)
+	}
+	if !root.Commit().Equal(expected.Commit()) {
+		t.Fatal("invalid root commitment")
+	}
+
+	// The tree can be updated like any other one.
+	for _, tree := range []VerkleNode{root, expected} {
+		if err := tree.Insert(zeroKeyTest, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	if !root.Commit().Equal(expected.Commit()) {
+		t.Fatal("invalid root commitment after an insertion")
+	}
+
+	if root, err := BuildFromSorted(&sliceIterator{}); err != nil || !root.Commit().Equal(New().Commit()) {
+		t.Fatalf("invalid empty tree: %v", err)
+	}
+	if _, err := BuildFromSorted(&sliceIterator{keys: [][]byte{keys[1], keys[0]}}); err == nil {
+		t.Fatal("expected an error for unsorted keys")
+	}
+}
@@ -25,6 +25,12 @@
 
 package verkle
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
 // A few proxy types that export their fields, so that the core type
 // does not. The conversion from one type to the other is done by calling
 // toExportable on an InternalNode.
@@ -44,3 +50,259 @@ type (
 		C2 [32]byte `json:"c2"`
 	}
 )
+
+// nodeMarshaller is the JSON representation of a node, used when dumping
+// (part of) a tree for debugging purposes. Internal nodes list the children
+// that are present in memory by index, and the bitlist holds all non-empty
+// children, so that the ones that are only present as a commitment can be
+// recovered as HashedNode.
+type nodeMarshaller struct {
+	Type       string                     `json:"type"`
+	Depth      byte                       `json:"depth"`
+	Commitment string                     `json:"commitment,omitempty"`
+	Bitlist    string                     `json:"bitlist,omitempty"`
+	Children   map[string]*nodeMarshaller `json:"children,omitempty"`
+	Stem       string                     `json:"stem,omitempty"`
+	C1         string                     `json:"c1,omitempty"`
+	C2         string                     `json:"c2,omitempty"`
+	Values     map[string]string          `json:"values,omitempty"`
+}
+
+const (
+	jsonInternalType = "internal"
+	jsonLeafType     = "leaf"
+)
+
+func pointToJSON(p *Point) string {
+	if p == nil {
+		return ""
+	}
+	b := p.Bytes()
+	return HexToPrefixedString(b[:])
+}
+
+func pointFromJSON(s string) (*Point, error) {
+	b, err := PrefixedHexStringToBytes(s)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Point)
+	if err := p.SetBytes(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (n *InternalNode) toMarshaller() (*nodeMarshaller, error) {
+	var bitlist [bitlistSize]byte
+	m := &nodeMarshaller{
+		Type:       jsonInternalType,
+		Depth:      n.depth,
+		Commitment: pointToJSON(n.commitment),
+		Children:   make(map[string]*nodeMarshaller),
+	}
+	for i, child := range n.children {
+		var (
+			cm  *nodeMarshaller
+			err error
+		)
+		switch child := child.(type) {
+		case Empty:
+			continue
+		case HashedNode:
+		case *InternalNode:
+			cm, err = child.toMarshaller()
+		case *LeafNode:
+			cm = child.toMarshaller()
+		default:
+			err = fmt.Errorf("can not marshal child #%d of type %T", i, child)
+		}
+		if err != nil {
+			return nil, err
+		}
+		setBit(bitlist[:], i)
+		if cm != nil {
+			m.Children[strconv.Itoa(i)] = cm
+		}
+	}
+	m.Bitlist = HexToPrefixedString(bitlist[:])
+	return m, nil
+}
+
+func (n *LeafNode) toMarshaller() *nodeMarshaller {
+	m := &nodeMarshaller{
+		Type:       jsonLeafType,
+		Depth:      n.depth,
+		Commitment: pointToJSON(n.commitment),
+		Stem:       HexToPrefixedString(n.stem[:]),
+		C1:         pointToJSON(n.c1),
+		C2:         pointToJSON(n.c2),
+		Values:     make(map[string]string),
+	}
+	for i, v := range n.values {
+		if v != nil {
+			m.Values[strconv.Itoa(i)] = HexToPrefixedString(v)
+		}
+	}
+	return m
+}
+
+// parseChildIndex parses a child or value index of a JSON-encoded node.
+func parseChildIndex(s string) (int, error) {
+	idx, err := strconv.Atoi(s)
+	if err != nil || idx < 0 || idx >= NodeWidth {
+		return 0, fmt.Errorf("invalid index %q", s)
+	}
+	return idx, nil
+}
+
+func (m *nodeMarshaller) toInternalNode() (*InternalNode, error) {
+	bitlist, err := PrefixedHexStringToBytes(m.Bitlist)
+	if err != nil {
+		return nil, fmt.Errorf("decoding bitlist: %w", err)
+	}
+	if len(bitlist) != bitlistSize {
+		return nil, fmt.Errorf("invalid bitlist length %d", len(bitlist))
+	}
+	n := newInternalNode(m.Depth).(*InternalNode)
+	if n.commitment, err = pointFromJSON(m.Commitment); err != nil {
+		return nil, fmt.Errorf("decoding commitment: %w", err)
+	}
+	for i := range n.children {
+		if bit(bitlist, i) {
+			n.children[i] = HashedNode{}
+		}
+	}
+	for key, cm := range m.Children {
+		idx, err := parseChildIndex(key)
+		if err != nil {
+			return nil, err
+		}
+		if !bit(bitlist, idx) {
+			return nil, fmt.Errorf("child #%d is missing from the bitlist", idx)
+		}
+		if cm.Depth != m.Depth+1 {
+			return nil, fmt.Errorf("invalid depth %d for child #%d", cm.Depth, idx)
+		}
+		if n.children[idx], err = cm.toNode(); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (m *nodeMarshaller) toLeafNode() (*LeafNode, error) {
+	b, err := PrefixedHexStringToBytes(m.Stem)
+	if err != nil {
+		return nil, fmt.Errorf("decoding stem: %w", err)
+	}
+	stem, err := StemFromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, NodeWidth)
+	for key, value := range m.Values {
+		idx, err := parseChildIndex(key)
+		if err != nil {
+			return nil, err
+		}
+		if values[idx], err = PrefixedHexStringToBytes(value); err != nil {
+			return nil, fmt.Errorf("decoding value #%d: %w", idx, err)
+		}
+		if len(values[idx]) > LeafValueSize {
+			return nil, fmt.Errorf("value #%d is too long: %d bytes", idx, len(values[idx]))
+		}
+	}
+
+	// Commitments are recomputed if they are missing from the dump.
+	if m.Commitment == "" {
+		leaf, err := NewLeafNode(stem, values)
+		if err != nil {
+			return nil, err
+		}
+		leaf.setDepth(m.Depth)
+		return leaf, nil
+	}
+	leaf := NewLeafNodeWithNoComms(stem, values)
+	leaf.setDepth(m.Depth)
+	if leaf.commitment, err = pointFromJSON(m.Commitment); err != nil {
+		return nil, fmt.Errorf("decoding commitment: %w", err)
+	}
+	if leaf.c1, err = pointFromJSON(m.C1); err != nil {
+		return nil, fmt.Errorf("decoding c1: %w", err)
+	}
+	if leaf.c2, err = pointFromJSON(m.C2); err != nil {
+		return nil, fmt.Errorf("decoding c2: %w", err)
+	}
+	return leaf, nil
+}
+
+func (m *nodeMarshaller) toNode() (VerkleNode, error) {
+	switch m.Type {
+	case jsonInternalType:
+		return m.toInternalNode()
+	case jsonLeafType:
+		return m.toLeafNode()
+	default:
+		return nil, fmt.Errorf("invalid node type %q", m.Type)
+	}
+}
+
+// MarshalJSON renders the internal node and all its in-memory descendants
+// in a human-readable format.
+func (n *InternalNode) MarshalJSON() ([]byte, error) {
+	m, err := n.toMarshaller()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON rebuilds an internal node and its descendants from the
+// output of MarshalJSON.
+func (n *InternalNode) UnmarshalJSON(data []byte) error {
+	var m nodeMarshaller
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m.Type != jsonInternalType {
+		return fmt.Errorf("invalid node type %q, expected %q", m.Type, jsonInternalType)
+	}
+	node, err := m.toInternalNode()
+	if err != nil {
+		return err
+	}
+	*n = *node
+	return nil
+}
+
+// MarshalJSON renders the leaf node in a human-readable format.
+func (n *LeafNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.toMarshaller())
+}
+
+// UnmarshalJSON rebuilds a leaf node from the output of MarshalJSON.
+func (n *LeafNode) UnmarshalJSON(data []byte) error {
+	var m nodeMarshaller
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m.Type != jsonLeafType {
+		return fmt.Errorf("invalid node type %q, expected %q", m.Type, jsonLeafType)
+	}
+	node, err := m.toLeafNode()
+	if err != nil {
+		return err
+	}
+	*n = *node
+	return nil
+}
+
+// ParseNodeJSON rebuilds a node of any type from the output of MarshalJSON.
+func ParseNodeJSON(data []byte) (VerkleNode, error) {
+	var m nodeMarshaller
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m.toNode()
+}
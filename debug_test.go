@@ -26,6 +26,8 @@
 package verkle
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 )
 
@@ -54,3 +56,82 @@ func TestJSON(t *testing.T) {
 	}
 	t.Log(string(output))
 }
+
+func TestNodeJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(oneKeyTest, zeroKeyTest[:5], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(forkOneKeyTest, zeroKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Insert(fourtyKeyTest, oneKeyTest, nil); err != nil {
+		t.Fatal(err)
+	}
+	root.Commit()
+	root.(*InternalNode).children[152] = HashedNode{}
+
+	output, err := json.Marshal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded InternalNode
+	if err := json.Unmarshal(output, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	if _, ok := decoded.children[152].(HashedNode); !ok {
+		t.Fatalf("expected a hashed node, got %T", decoded.children[152])
+	}
+	for _, key := range [][]byte{zeroKeyTest, oneKeyTest, forkOneKeyTest, fourtyKeyTest} {
+		expected, err := root.Get(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decoded.Get(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Fatalf("invalid value for key %x: got %x, expected %x", key, got, expected)
+		}
+	}
+	reencoded, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, reencoded) {
+		t.Fatalf("re-encoding produced a different output:\n%s\n%s", output, reencoded)
+	}
+
+	// A leaf without commitments gets them recomputed.
+	leaf := root.(*InternalNode).children[64].(*LeafNode)
+	output, err = json.Marshal(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(output, &m); err != nil {
+		t.Fatal(err)
+	}
+	delete(m, "commitment")
+	delete(m, "c1")
+	delete(m, "c2")
+	if output, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	node, err := ParseNodeJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.Commitment().Equal(leaf.Commitment()) {
+		t.Fatal("invalid recomputed leaf commitment")
+	}
+}
@@ -0,0 +1,434 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// DiffTrees walks two trees in lockstep and returns the stems of the
+// leaves that differ between them, including the stems that are only
+// present in one of the two trees. Subtrees that have the same commitment
+// in both trees are skipped, so that their descendants never need to be
+// resolved. Both roots are committed before the walk begins. The stems
+// are returned in ascending order.
+func DiffTrees(a, b VerkleNode, resolveA, resolveB NodeResolverFn) ([][]byte, error) {
+	a.Commit()
+	b.Commit()
+	pairs, err := diffNodes(a, b, nil, resolveA, resolveB, nil)
+	if err != nil {
+		return nil, err
+	}
+	changed := make([][]byte, len(pairs))
+	for i, pair := range pairs {
+		changed[i] = pair.stem()
+	}
+	return changed, nil
+}
+
+// ValueDiff is a key whose value differs between two trees. Old is nil
+// if the key is absent from the first tree, and New is nil if it is
+// absent from the second one.
+type ValueDiff struct {
+	Key []byte
+	Old []byte
+	New []byte
+}
+
+// DiffValues is like DiffTrees, but returns the keys whose values differ
+// between the two trees, along with their old and new values. The keys
+// are returned in ascending order.
+func DiffValues(a, b VerkleNode, resolveA, resolveB NodeResolverFn) ([]ValueDiff, error) {
+	a.Commit()
+	b.Commit()
+	pairs, err := diffNodes(a, b, nil, resolveA, resolveB, nil)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []ValueDiff
+	for _, pair := range pairs {
+		if (pair.a != nil && pair.a.isPOAStub) || (pair.b != nil && pair.b.isPOAStub) {
+			return nil, ErrIsPOAStub
+		}
+		stem := pair.stem()
+		for i := 0; i < NodeWidth; i++ {
+			var old, updated []byte
+			if pair.a != nil {
+				old = pair.a.values[i]
+			}
+			if pair.b != nil {
+				updated = pair.b.values[i]
+			}
+			if (old == nil) == (updated == nil) && bytes.Equal(old, updated) {
+				continue
+			}
+			diffs = append(diffs, ValueDiff{
+				Key: append(append(make([]byte, 0, KeySize), stem...), byte(i)),
+				Old: old,
+				New: updated,
+			})
+		}
+	}
+	return diffs, nil
+}
+
+// leafPair holds the two versions of a leaf that differs between two
+// trees. Either of them is nil if the stem is absent from its tree.
+type leafPair struct {
+	a, b *LeafNode
+}
+
+func (p leafPair) stem() []byte {
+	if p.a != nil {
+		return p.a.stem[:]
+	}
+	return p.b.stem[:]
+}
+
+func diffNodes(a, b VerkleNode, path []byte, resolveA, resolveB NodeResolverFn, changed []leafPair) ([]leafPair, error) {
+	if a.Commitment().Equal(b.Commitment()) {
+		return changed, nil
+	}
+
+	ina, oka := a.(*InternalNode)
+	inb, okb := b.(*InternalNode)
+	if !oka || !okb {
+		// The two subtrees have a different shape, compare
+		// the list of leaves that they contain.
+		leavesA, err := collectLeaves(a, path, resolveA, nil)
+		if err != nil {
+			return nil, err
+		}
+		leavesB, err := collectLeaves(b, path, resolveB, nil)
+		if err != nil {
+			return nil, err
+		}
+		return diffLeaves(leavesA, leavesB, changed), nil
+	}
+
+	for i := 0; i < NodeWidth; i++ {
+		if _, ok := ina.children[i].(Empty); ok {
+			if _, ok := inb.children[i].(Empty); ok {
+				continue
+			}
+		}
+
+		childPath := make([]byte, len(path)+1)
+		copy(childPath, path)
+		childPath[len(path)] = byte(i)
+
+		childA, err := ina.resolveChild(childPath, resolveA)
+		if err != nil {
+			return nil, err
+		}
+		childB, err := inb.resolveChild(childPath, resolveB)
+		if err != nil {
+			return nil, err
+		}
+		changed, err = diffNodes(childA, childB, childPath, resolveA, resolveB, changed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+// resolveChild returns the child found at the end of the given path,
+// resolving it if it is a HashedNode. The resolved node replaces the
+// HashedNode in the tree.
+func (n *InternalNode) resolveChild(path []byte, resolver NodeResolverFn) (VerkleNode, error) {
+	idx := path[len(path)-1]
+	if _, ok := n.children[idx].(HashedNode); !ok {
+		return n.children[idx], nil
+	}
+	if resolver == nil {
+		return nil, fmt.Errorf("hashed node at path %x could not be resolved: %w", path, errReadFromInvalid)
+	}
+	serialized, err := resolver(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolving node at path %x: %w", path, err)
+	}
+	resolved, err := ParseNode(serialized, n.depth+1)
+	if err != nil {
+		return nil, fmt.Errorf("parsing node %x: %w", serialized, err)
+	}
+	n.children[idx] = resolved
+	return resolved, nil
+}
+
+// collectLeaves appends all the leaves of a subtree to the list,
+// in stem order, resolving hashed nodes along the way.
+func collectLeaves(node VerkleNode, path []byte, resolver NodeResolverFn, leaves []*LeafNode) ([]*LeafNode, error) {
+	switch n := node.(type) {
+	case *LeafNode:
+		return append(leaves, n), nil
+	case *InternalNode:
+		for i := range n.children {
+			if _, ok := n.children[i].(Empty); ok {
+				continue
+			}
+			childPath := make([]byte, len(path)+1)
+			copy(childPath, path)
+			childPath[len(path)] = byte(i)
+			child, err := n.resolveChild(childPath, resolver)
+			if err != nil {
+				return nil, err
+			}
+			leaves, err = collectLeaves(child, childPath, resolver, leaves)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return leaves, nil
+	case Empty, UnknownNode:
+		return leaves, nil
+	default:
+		return nil, errUnknownNodeType
+	}
+}
+
+// diffLeaves merges two lists of leaves sorted by stem, and appends
+// the leaves that are either missing from one list or whose versions
+// have different commitments.
+func diffLeaves(a, b []*LeafNode, changed []leafPair) []leafPair {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch cmp := a[i].stem.Compare(b[j].stem); {
+		case cmp < 0:
+			changed = append(changed, leafPair{a: a[i]})
+			i++
+		case cmp > 0:
+			changed = append(changed, leafPair{b: b[j]})
+			j++
+		default:
+			if !a[i].commitment.Equal(b[j].commitment) {
+				changed = append(changed, leafPair{a[i], b[j]})
+			}
+			i++
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		changed = append(changed, leafPair{a: a[i]})
+	}
+	for ; j < len(b); j++ {
+		changed = append(changed, leafPair{b: b[j]})
+	}
+	return changed
+}
+
+const (
+	leafDiffVersion byte = 1
+
+	// Leaf diff offsets.
+	leafDiffCommitmentOffset = nodeVersionSize
+	leafDiffChangedOffset    = leafDiffCommitmentOffset + 3*banderwagon.UncompressedSize
+	leafDiffPresentOffset    = leafDiffChangedOffset + bitlistSize
+	leafDiffValuesOffset     = leafDiffPresentOffset + bitlistSize
+)
+
+// SerializeDiff encodes the changes that turn the old version of a leaf
+// into its updated version, so that an archive can store them instead of the
+// full new version. The format is:
+// <version><comm><c1comm><c2comm><changed bitlist><present bitlist><values...>
+// where the values are those of the changed suffixes that are present in
+// the updated version. Changed suffixes that are absent have been deleted.
+func SerializeDiff(old, updated *LeafNode) ([]byte, error) {
+	if old.stem != updated.stem {
+		return nil, fmt.Errorf("leaves have different stems: %x != %x", old.stem, updated.stem)
+	}
+	if updated.isPOAStub {
+		return nil, ErrIsPOAStub
+	}
+
+	var changed, present [bitlistSize]byte
+	var values [][]byte
+	for i := range updated.values {
+		if (old.values[i] == nil) == (updated.values[i] == nil) && bytes.Equal(old.values[i], updated.values[i]) {
+			continue
+		}
+		setBit(changed[:], i)
+		if updated.values[i] != nil {
+			setBit(present[:], i)
+			values = append(values, updated.values[i])
+		}
+	}
+
+	serialized := make([]byte, leafDiffValuesOffset+len(values)*LeafValueSize)
+	serialized[0] = leafDiffVersion
+	cBytes := banderwagon.BatchToBytesUncompressed(updated.commitment, updated.c1, updated.c2)
+	for i := range cBytes {
+		copy(serialized[leafDiffCommitmentOffset+i*banderwagon.UncompressedSize:], cBytes[i][:])
+	}
+	copy(serialized[leafDiffChangedOffset:], changed[:])
+	copy(serialized[leafDiffPresentOffset:], present[:])
+	for i, v := range values {
+		copy(serialized[leafDiffValuesOffset+i*LeafValueSize:], v)
+	}
+	return serialized, nil
+}
+
+// ApplyDiff returns the updated version of a leaf, given its old version and
+// the output of SerializeDiff. The old leaf is left untouched.
+func ApplyDiff(old *LeafNode, diff []byte) (*LeafNode, error) {
+	if len(diff) < leafDiffValuesOffset {
+		return nil, errSerializedPayloadTooShort
+	}
+	if diff[0] != leafDiffVersion {
+		return nil, fmt.Errorf("unsupported leaf diff version %d", diff[0])
+	}
+
+	changed := diff[leafDiffChangedOffset:leafDiffPresentOffset]
+	present := diff[leafDiffPresentOffset:leafDiffValuesOffset]
+	values := make([][]byte, NodeWidth)
+	copy(values, old.values)
+	offset := leafDiffValuesOffset
+	for i := range values {
+		if !bit(changed, i) {
+			if bit(present, i) {
+				return nil, ErrInvalidNodeEncoding
+			}
+			continue
+		}
+		if !bit(present, i) {
+			values[i] = nil
+			continue
+		}
+		if offset+LeafValueSize > len(diff) {
+			return nil, errSerializedPayloadTooShort
+		}
+		values[i] = append([]byte{}, diff[offset:offset+LeafValueSize]...)
+		offset += LeafValueSize
+	}
+
+	leaf := NewLeafNodeWithNoComms(old.stem, values)
+	leaf.setDepth(old.depth)
+	comms := []*Point{new(Point), new(Point), new(Point)}
+	for i, comm := range comms {
+		start := leafDiffCommitmentOffset + i*banderwagon.UncompressedSize
+		if err := comm.SetBytesUncompressed(diff[start:start+banderwagon.UncompressedSize], true); err != nil {
+			return nil, fmt.Errorf("setting commitment #%d: %w", i, err)
+		}
+	}
+	leaf.commitment, leaf.c1, leaf.c2 = comms[0], comms[1], comms[2]
+	return leaf, nil
+}
+
+// MismatchError is returned by Equal to report where two trees diverge.
+type MismatchError struct {
+	Path   []byte
+	Reason string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("trees differ at path %x: %s", e.Path, e.Reason)
+}
+
+// Equal compares two trees node by node, including the commitments of
+// the nodes, so that it also catches a subtree that holds the right data
+// but was committed incorrectly. Hashed nodes are resolved and stored in
+// their tree. Both roots are committed before the walk begins. It returns
+// nil if the trees are identical, or a *MismatchError for the first path,
+// in depth-first order, at which they differ. The children of internal
+// nodes are compared before their commitments, so the reported path is
+// the deepest one at which the trees diverge.
+func Equal(a, b VerkleNode, resolveA, resolveB NodeResolverFn) error {
+	if _, ok := a.(HashedNode); ok {
+		return errors.New("can not compare a hashed root")
+	}
+	if _, ok := b.(HashedNode); ok {
+		return errors.New("can not compare a hashed root")
+	}
+	a.Commit()
+	b.Commit()
+	return equalNodes(a, b, nil, resolveA, resolveB)
+}
+
+func equalNodes(a, b VerkleNode, path []byte, resolveA, resolveB NodeResolverFn) error {
+	mismatch := func(format string, args ...any) error {
+		return &MismatchError{Path: path, Reason: fmt.Sprintf(format, args...)}
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return mismatch("node types %T and %T", a, b)
+	}
+	switch na := a.(type) {
+	case *InternalNode:
+		nb := b.(*InternalNode)
+		// Compare the children first, to report the deepest
+		// divergence rather than the root.
+		for i := 0; i < NodeWidth; i++ {
+			_, emptyA := na.children[i].(Empty)
+			_, emptyB := nb.children[i].(Empty)
+			if emptyA && emptyB {
+				continue
+			}
+			childPath := append(path[:len(path):len(path)], byte(i))
+			childA, err := na.resolveChild(childPath, resolveA)
+			if err != nil {
+				return err
+			}
+			childB, err := nb.resolveChild(childPath, resolveB)
+			if err != nil {
+				return err
+			}
+			if err := equalNodes(childA, childB, childPath, resolveA, resolveB); err != nil {
+				return err
+			}
+		}
+		if !na.commitment.Equal(nb.commitment) {
+			return mismatch("internal node commitments")
+		}
+	case *LeafNode:
+		nb := b.(*LeafNode)
+		if na.stem != nb.stem {
+			return mismatch("leaf stems %x and %x", na.stem, nb.stem)
+		}
+		if na.isPOAStub != nb.isPOAStub {
+			return mismatch("only one of the leaves is a proof-of-absence stub")
+		}
+		if len(na.values) != len(nb.values) {
+			return mismatch("leaf value counts %d and %d", len(na.values), len(nb.values))
+		}
+		for i := range na.values {
+			if (na.values[i] == nil) != (nb.values[i] == nil) || !bytes.Equal(na.values[i], nb.values[i]) {
+				return mismatch("values %x and %x at suffix %d", na.values[i], nb.values[i], i)
+			}
+		}
+		if !na.commitment.Equal(nb.commitment) {
+			return mismatch("leaf commitments")
+		}
+	default:
+		if !a.Commitment().Equal(b.Commitment()) {
+			return mismatch("commitments of %T nodes", a)
+		}
+	}
+	return nil
+}
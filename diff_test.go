@@ -0,0 +1,291 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDiffTreesOneLeaf(t *testing.T) {
+	t.Parallel()
+
+	key1, _ := hex.DecodeString("0100000000000000000000000000000000000000000000000000000000000000")
+	key2, _ := hex.DecodeString("0200000000000000000000000000000000000000000000000000000000000000")
+	key3, _ := hex.DecodeString("0201000000000000000000000000000000000000000000000000000000000000")
+	key4, _ := hex.DecodeString("0300000000000000000000000000000000000000000000000000000000000000")
+
+	build := func(value []byte) (VerkleNode, map[string][]byte) {
+		root := New()
+		for _, k := range [][]byte{key1, key2, key3, key4} {
+			v := testValue
+			if bytes.Equal(k, key1) {
+				v = value
+			}
+			if err := root.Insert(k, v, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		db := map[string][]byte{}
+		root.(*InternalNode).Flush(func(path []byte, node VerkleNode) {
+			serialized, err := node.Serialize()
+			if err != nil {
+				panic(err)
+			}
+			db[string(path)] = serialized
+		})
+		return root, db
+	}
+	rootA, dbA := build(testValue)
+	rootB, dbB := build(fourtyKeyTest)
+
+	var resolved [][]byte
+	resolver := func(db map[string][]byte) NodeResolverFn {
+		return func(path []byte) ([]byte, error) {
+			resolved = append(resolved, path)
+			return db[string(path)], nil
+		}
+	}
+
+	changed, err := DiffTrees(rootA, rootB, resolver(dbA), resolver(dbB))
+	if err != nil {
+		t.Fatalf("error diffing trees: %v", err)
+	}
+	if len(changed) != 1 || !bytes.Equal(changed[0], key1[:StemSize]) {
+		t.Fatalf("invalid list of changed stems: %x", changed)
+	}
+
+	// The internal node at path 02 has the same commitment
+	// in both trees, so its children must not be resolved.
+	for _, path := range resolved {
+		if len(path) > 1 {
+			t.Fatalf("unchanged subtree was resolved at path %x", path)
+		}
+	}
+}
+
+func TestDiffTreesAddedStem(t *testing.T) {
+	t.Parallel()
+
+	rootA := New()
+	if err := rootA.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	rootB := rootA.Copy()
+	if err := rootB.Insert(forkOneKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+
+	changed, err := DiffTrees(rootA, rootB, nil, nil)
+	if err != nil {
+		t.Fatalf("error diffing trees: %v", err)
+	}
+	if len(changed) != 1 || !bytes.Equal(changed[0], forkOneKeyTest[:StemSize]) {
+		t.Fatalf("invalid list of changed stems: %x", changed)
+	}
+
+	changed, err = DiffTrees(rootA, rootA.Copy(), nil, nil)
+	if err != nil {
+		t.Fatalf("error diffing trees: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("identical trees should have no changed stems, got %x", changed)
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	t.Parallel()
+
+	build := func() VerkleNode {
+		root := New()
+		for _, k := range [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest} {
+			if err := root.Insert(k, testValue, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		return root
+	}
+	rootA, rootB := build(), build()
+	if err := rootB.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if _, err := rootB.Delete(oneKeyTest, nil); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+	if err := rootB.Insert(forkOneKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+
+	diffs, err := DiffValues(rootA, rootB, nil, nil)
+	if err != nil {
+		t.Fatalf("error diffing trees: %v", err)
+	}
+	expected := []ValueDiff{
+		{Key: zeroKeyTest, Old: testValue, New: fourtyKeyTest},
+		{Key: oneKeyTest, Old: testValue},
+		{Key: forkOneKeyTest, New: testValue},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("invalid number of diffs, got %d, expected %d", len(diffs), len(expected))
+	}
+	for i := range diffs {
+		if !bytes.Equal(diffs[i].Key, expected[i].Key) || !bytes.Equal(diffs[i].Old, expected[i].Old) || !bytes.Equal(diffs[i].New, expected[i].New) {
+			t.Fatalf("invalid diff #%d, got %x, expected %x", i, diffs[i], expected[i])
+		}
+		if (diffs[i].Old == nil) != (expected[i].Old == nil) || (diffs[i].New == nil) != (expected[i].New == nil) {
+			t.Fatalf("invalid presence in diff #%d: %x", i, diffs[i])
+		}
+	}
+}
+
+func TestSerializeApplyDiff(t *testing.T) {
+	t.Parallel()
+
+	values := make([][]byte, NodeWidth)
+	values[0] = testValue
+	values[3] = testValue
+	values[200] = testValue
+	old, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+	old.setDepth(2)
+
+	// Update one value, delete another and add a new one.
+	updatedValues := make([][]byte, NodeWidth)
+	copy(updatedValues, values)
+	updatedValues[3] = fourtyKeyTest
+	updatedValues[200] = nil
+	updatedValues[201] = zeroKeyTest
+	updated, err := NewLeafNode(KeyToStem(ffx32KeyTest), updatedValues)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+
+	diff, err := SerializeDiff(old, updated)
+	if err != nil {
+		t.Fatalf("error serializing diff: %v", err)
+	}
+	if expected := leafDiffValuesOffset + 2*LeafValueSize; len(diff) != expected {
+		t.Fatalf("invalid diff length, got %d, expected %d", len(diff), expected)
+	}
+	applied, err := ApplyDiff(old, diff)
+	if err != nil {
+		t.Fatalf("error applying diff: %v", err)
+	}
+	if applied.depth != old.depth {
+		t.Fatalf("invalid depth, got %d, expected %d", applied.depth, old.depth)
+	}
+	if !applied.commitment.Equal(updated.commitment) || !applied.c1.Equal(updated.c1) || !applied.c2.Equal(updated.c2) {
+		t.Fatal("invalid commitments")
+	}
+	for i := range updatedValues {
+		if !bytes.Equal(applied.values[i], updatedValues[i]) || (applied.values[i] == nil) != (updatedValues[i] == nil) {
+			t.Fatalf("invalid value #%d, got %x, expected %x", i, applied.values[i], updatedValues[i])
+		}
+	}
+	if !bytes.Equal(old.values[3], testValue) || old.values[201] != nil {
+		t.Fatal("the old leaf was modified")
+	}
+
+	if _, err := ApplyDiff(old, diff[:len(diff)-1]); err == nil {
+		t.Fatal("expected an error applying a truncated diff")
+	}
+	other, err := NewLeafNode(KeyToStem(zeroKeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+	if _, err := SerializeDiff(old, other); err == nil {
+		t.Fatal("expected an error diffing leaves with different stems")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeysSorted(t, 50)
+	build := func() VerkleNode {
+		root := New()
+		for _, k := range keys {
+			if err := root.Insert(k, k, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		return root
+	}
+	a, b := build(), build()
+	if err := Equal(a, b, nil, nil); err != nil {
+		t.Fatalf("identical trees differ: %v", err)
+	}
+
+	// A flushed tree is resolved as it is compared.
+	serialized := map[string][]byte{}
+	b.(*InternalNode).Flush(func(path []byte, node VerkleNode) {
+		s, err := node.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		serialized[string(path)] = s
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		return serialized[string(path)], nil
+	}
+	if err := Equal(a, b, nil, resolver); err != nil {
+		t.Fatalf("identical trees differ after flushing one: %v", err)
+	}
+
+	if err := b.Insert(keys[10], testValue, resolver); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	var mismatch *MismatchError
+	if err := Equal(a, b, nil, resolver); !errors.As(err, &mismatch) {
+		t.Fatalf("expected a mismatch, got %v", err)
+	}
+	if len(mismatch.Path) == 0 || !bytes.HasPrefix(keys[10], mismatch.Path) {
+		t.Fatalf("mismatch at path %x, which doesn't lead to the modified key", mismatch.Path)
+	}
+
+	// A leaf with the right values but a wrong commitment is caught.
+	c := build()
+	if err := Equal(a, c, nil, nil); err != nil {
+		t.Fatalf("identical trees differ: %v", err)
+	}
+	var node VerkleNode = c
+	for {
+		internal, ok := node.(*InternalNode)
+		if !ok {
+			break
+		}
+		node = internal.children[keys[0][internal.depth]]
+	}
+	leaf := node.(*LeafNode)
+	leaf.commitment.Add(leaf.commitment, leaf.commitment)
+	if err := Equal(a, c, nil, nil); !errors.As(err, &mismatch) || mismatch.Reason != "leaf commitments" {
+		t.Fatalf("expected a leaf commitment mismatch, got %v", err)
+	}
+}
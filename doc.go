@@ -28,18 +28,26 @@ package verkle
 import "errors"
 
 var (
-	errInsertIntoHash         = errors.New("trying to insert into hashed node")
-	errDeleteHash             = errors.New("trying to delete from a hashed subtree")
-	errDeleteMissing          = errors.New("trying to delete a missing group")
-	errDeleteUnknown          = errors.New("trying to delete an out-of-view node")
-	errReadFromInvalid        = errors.New("trying to read from an invalid child")
-	errSerializeHashedNode    = errors.New("trying to serialize a hashed internal node")
-	errInsertIntoOtherStem    = errors.New("insert splits a stem where it should not happen")
-	errUnknownNodeType        = errors.New("unknown node type detected")
-	errMissingNodeInStateless = errors.New("trying to access a node that is missing from the stateless view")
-	errIsPOAStub              = errors.New("trying to read/write a proof of absence leaf node")
+	errInsertIntoHash      = errors.New("trying to insert into hashed node")
+	errDeleteHash          = errors.New("trying to delete from a hashed subtree")
+	errDeleteMissing       = errors.New("trying to delete a missing group")
+	errDeleteUnknown       = errors.New("trying to delete an out-of-view node")
+	errReadFromInvalid     = errors.New("trying to read from an invalid child")
+	errSerializeHashedNode = errors.New("trying to serialize a hashed internal node")
+	errInsertIntoOtherStem = errors.New("insert splits a stem where it should not happen")
+	errUnknownNodeType     = errors.New("unknown node type detected")
 )
 
+// ErrIsPOAStub is returned when reading from or writing to a proof-of-absence
+// stub, a leaf of a stateless tree that only carries the stem and commitment
+// of a leaf found along the path of an absent key.
+var ErrIsPOAStub = errors.New("trying to read/write a proof of absence leaf node")
+
+// ErrStemCollision is returned when inserting a stem would split a leaf
+// whose stem doesn't match its position in the tree, which would keep
+// splitting until the maximum depth of StemSize is reached.
+var ErrStemCollision = errors.New("stem collides with a misplaced leaf")
+
 const (
 	// Extension status
 	extStatusAbsentEmpty = byte(iota) // missing child node along the path
@@ -25,7 +25,10 @@
 
 package verkle
 
-import "errors"
+import (
+	"errors"
+	"io"
+)
 
 type Empty struct{}
 
@@ -61,6 +64,15 @@ func (Empty) Serialize() ([]byte, error) {
 	return nil, errors.New("can't encode empty node to RLP")
 }
 
+func (e Empty) SerializeTo(io.Writer) (int, error) {
+	_, err := e.Serialize()
+	return 0, err
+}
+
+func (Empty) Size() int {
+	return 0
+}
+
 func (Empty) Copy() VerkleNode {
 	return Empty(struct{}{})
 }
@@ -26,19 +26,53 @@
 package verkle
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"runtime"
+	"slices"
+	"sync"
 
 	"github.com/crate-crypto/go-ipa/banderwagon"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
-	ErrInvalidNodeEncoding = errors.New("invalid node encoding")
+	ErrInvalidNodeEncoding  = errors.New("invalid node encoding")
+	ErrNodeChecksumMismatch = errors.New("node checksum mismatch")
+	ErrNonCanonicalEncoding = errors.New("non-canonical node encoding")
+
+	nodeChecksumTable = crc32.MakeTable(crc32.Castagnoli)
 
 	mask = [8]byte{0x80, 0x40, 0x20, 0x10, 0x8, 0x4, 0x2, 0x1}
 )
 
 const (
+	// Serialized nodes are prefixed with a version byte. Its most significant
+	// bit is always set, so that it can't be mistaken for one of the node types
+	// that start the payloads written before versioning was introduced. These
+	// unversioned payloads are decoded as version 0.
+	nodeVersionSize           = 1
+	nodeVersionFlag      byte = 0x80
+	currentNodeVersion   byte = 1
+	currentVersionHeader      = nodeVersionFlag | currentNodeVersion
+
+	// Payloads of the compressed version share the layout of the current
+	// version, except that commitments are written in their 32-byte
+	// compressed form. They are half the size, but slower to decode.
+	compressedNodeVersion   byte = 2
+	compressedVersionHeader      = nodeVersionFlag | compressedNodeVersion
+	compressedPointSavings       = banderwagon.UncompressedSize - banderwagon.CompressedSize
+
+	// Versioned nodes may end with a CRC-32C checksum of their header and
+	// payload, which is signaled by a flag in the version header.
+	nodeChecksumFlag byte = 0x40
+	nodeChecksumSize      = 4
+
 	nodeTypeSize = 1
 	bitlistSize  = NodeWidth / 8
 
@@ -61,8 +95,192 @@ const (
 	leafValueIndexSize     = 1
 	singleSlotLeafSize     = nodeTypeSize + StemSize + 2*banderwagon.UncompressedSize + leafValueIndexSize + leafSlotSize
 	eoaLeafSize            = nodeTypeSize + StemSize + 2*banderwagon.UncompressedSize + leafBasicDataSize
+
+	// Flagged leaf node offsets. The flags tell which of C1 and C2 follow
+	// the commitment; the missing ones are the identity.
+	flaggedLeafFlagsOffset           = leafBitlistOffset + bitlistSize
+	flaggedLeafCommitmentOffset      = flaggedLeafFlagsOffset + 1
+	leafC1Present               byte = 1
+	leafC2Present               byte = 2
 )
 
+// splitNodeVersion returns the encoding version of a serialized node,
+// as well as the payload that follows the version header. If the node
+// carries a checksum, it is verified and stripped from the payload.
+func splitNodeVersion(serialized []byte) (byte, []byte, error) {
+	if len(serialized) == 0 || serialized[0]&nodeVersionFlag == 0 {
+		return 0, serialized, nil
+	}
+	if serialized[0]&nodeChecksumFlag != 0 {
+		if len(serialized) < nodeVersionSize+nodeChecksumSize {
+			return 0, nil, errSerializedPayloadTooShort
+		}
+		end := len(serialized) - nodeChecksumSize
+		if binary.BigEndian.Uint32(serialized[end:]) != crc32.Checksum(serialized[:end], nodeChecksumTable) {
+			return 0, nil, ErrNodeChecksumMismatch
+		}
+		serialized = serialized[:end]
+	}
+	return serialized[0] &^ (nodeVersionFlag | nodeChecksumFlag), serialized[nodeVersionSize:], nil
+}
+
+// AppendNodeChecksum flags a serialized node as carrying a checksum, and
+// appends the checksum of the header and payload to it. ParseNode verifies
+// it, so that a node corrupted in storage is detected when it is loaded.
+// The node is modified in place.
+func AppendNodeChecksum(serialized []byte) ([]byte, error) {
+	if len(serialized) == 0 || serialized[0]&nodeVersionFlag == 0 {
+		return nil, errors.New("can not checksum a node without a version header")
+	}
+	if serialized[0]&nodeChecksumFlag != 0 {
+		return nil, errors.New("node already has a checksum")
+	}
+	serialized[0] |= nodeChecksumFlag
+	return binary.BigEndian.AppendUint32(serialized, crc32.Checksum(serialized, nodeChecksumTable)), nil
+}
+
+// newSerializedNode allocates the buffer for a node whose payload is
+// size bytes long, and writes the version header. It returns both the
+// full buffer, and the slice in which the payload should be written.
+func newSerializedNode(size int) ([]byte, []byte) {
+	return appendSerializedNode(nil, size)
+}
+
+// appendSerializedNode is like newSerializedNode, but extends dst with the
+// zeroed serialization buffer instead of allocating a new one.
+func appendSerializedNode(dst []byte, size int) ([]byte, []byte) {
+	start := len(dst)
+	dst = slices.Grow(dst, nodeVersionSize+size)[:start+nodeVersionSize+size]
+	clear(dst[start:])
+	dst[start] = currentVersionHeader
+	return dst, dst[start+nodeVersionSize:]
+}
+
+// serializationBuffers holds the buffers used by SerializeTo, so that
+// flushing many nodes doesn't allocate a new buffer for each of them.
+var serializationBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, nodeVersionSize+leafChildrenOffset+NodeWidth*LeafValueSize)
+		return &buf
+	},
+}
+
+// writePooled serializes a node into a pooled buffer with appendFn, and
+// writes the result to w.
+func writePooled(w io.Writer, appendFn func([]byte) []byte) (int, error) {
+	buf := serializationBuffers.Get().(*[]byte)
+	defer serializationBuffers.Put(buf)
+	*buf = appendFn((*buf)[:0])
+	return w.Write(*buf)
+}
+
+// AppendSerializedNode appends the serialization of node to dst and returns
+// the extended buffer, so that callers can reuse the same buffer across
+// many nodes.
+func AppendSerializedNode(dst []byte, node VerkleNode) ([]byte, error) {
+	switch n := node.(type) {
+	case *InternalNode:
+		return n.appendSerialized(dst), nil
+	case *LeafNode:
+		return n.appendSerialized(dst), nil
+	default:
+		serialized, err := node.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		return append(dst, serialized...), nil
+	}
+}
+
+// nodeCommitments returns the offset of the commitments in a node payload,
+// and how many there are. In every layout, the commitments are stored next
+// to each other.
+func nodeCommitments(payload []byte) (int, int, error) {
+	if len(payload) < nodeTypeSize {
+		return 0, 0, errSerializedPayloadTooShort
+	}
+	switch payload[nodeTypeOffset] {
+	case internalType:
+		return internalCommitmentOffset, 1, nil
+	case leafType:
+		return leafCommitmentOffset, 3, nil
+	case eoAccountType, singleSlotType:
+		return leafStemOffset + StemSize, 2, nil
+	case flaggedLeafType:
+		if len(payload) < flaggedLeafCommitmentOffset {
+			return 0, 0, errSerializedPayloadTooShort
+		}
+		flags := payload[flaggedLeafFlagsOffset]
+		if flags&^(leafC1Present|leafC2Present) != 0 {
+			return 0, 0, ErrInvalidNodeEncoding
+		}
+		return flaggedLeafCommitmentOffset, 1 + bits.OnesCount8(flags), nil
+	default:
+		return 0, 0, ErrInvalidNodeEncoding
+	}
+}
+
+// SerializeNodeCompressed serializes a node like its Serialize method, but
+// writes commitments in their compressed form. ParseNode detects this
+// encoding from the version header.
+func SerializeNodeCompressed(node VerkleNode) ([]byte, error) {
+	serialized, err := node.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	_, payload, err := splitNodeVersion(serialized)
+	if err != nil {
+		return nil, err
+	}
+	offset, count, err := nodeCommitments(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]*Point, count)
+	for i := range points {
+		points[i] = new(Point)
+		start := offset + i*banderwagon.UncompressedSize
+		if err := points[i].SetBytesUncompressed(payload[start:start+banderwagon.UncompressedSize], true); err != nil {
+			return nil, fmt.Errorf("reading commitment #%d: %w", i, err)
+		}
+	}
+	end := offset + count*banderwagon.UncompressedSize
+	compressed := make([]byte, 0, nodeVersionSize+len(payload)-count*compressedPointSavings)
+	compressed = append(compressed, compressedVersionHeader)
+	compressed = append(compressed, payload[:offset]...)
+	for _, p := range banderwagon.ElementsToBytes(points...) {
+		compressed = append(compressed, p[:]...)
+	}
+	return append(compressed, payload[end:]...), nil
+}
+
+// decompressNodePayload turns the payload of a compressed node into its
+// uncompressed equivalent. Compressed commitments are validated.
+func decompressNodePayload(payload []byte) ([]byte, error) {
+	offset, count, err := nodeCommitments(payload)
+	if err != nil {
+		return nil, err
+	}
+	end := offset + count*banderwagon.CompressedSize
+	if len(payload) < end {
+		return nil, errSerializedPayloadTooShort
+	}
+
+	decompressed := make([]byte, 0, len(payload)+count*compressedPointSavings)
+	decompressed = append(decompressed, payload[:offset]...)
+	for i := 0; i < count; i++ {
+		var p Point
+		start := offset + i*banderwagon.CompressedSize
+		if err := p.SetBytes(payload[start : start+banderwagon.CompressedSize]); err != nil {
+			return nil, fmt.Errorf("reading commitment #%d: %w", i, err)
+		}
+		comm := p.BytesUncompressedTrusted()
+		decompressed = append(decompressed, comm[:]...)
+	}
+	return append(decompressed, payload[end:]...), nil
+}
+
 func bit(bitlist []byte, nr int) bool {
 	if len(bitlist)*8 <= nr {
 		return false
@@ -73,12 +291,59 @@ func bit(bitlist []byte, nr int) bool {
 var errSerializedPayloadTooShort = errors.New("verkle payload is too short")
 
 // ParseNode deserializes a node into its proper VerkleNode instance.
-// The serialized bytes have the format:
+// The serialized bytes start with a version header, followed by a payload
+// whose format is:
 // - Internal nodes:   <nodeType><bitlist><commitment>
 // - Leaf nodes:       <nodeType><stem><bitlist><comm><c1comm><c2comm><children...>
 // - EoA nodes:        <nodeType><stem><comm><c1comm><balance><nonce>
 // - single slot node: <nodeType><stem><comm><cncomm><leaf index><slot>
+// - flagged leaves:   <nodeType><stem><bitlist><flags><comm><c1comm or c2comm><children...>
+//
+// Payloads without a version header, as written by older releases, and
+// payloads with compressed commitments, see SerializeNodeCompressed, are
+// also accepted, as are the custom node types registered with
+// RegisterNodeType. Checksums added by AppendNodeChecksum are verified.
+// The returned node doesn't reference serializedNode, which the caller is
+// free to reuse. See ParseNodeUnsafe for a variant that avoids the copy.
+//
+// Uncompressed commitments are trusted: they are not checked to be on the
+// curve nor in the subgroup, as they are expected to come from a database
+// that only holds nodes serialized by this package. Compressed commitments
+// are always validated, since decompressing them requires the same work.
 func ParseNode(serializedNode []byte, depth byte) (VerkleNode, error) {
+	owned := make([]byte, len(serializedNode))
+	copy(owned, serializedNode)
+	return ParseNodeUnsafe(owned, depth)
+}
+
+// ParseNodeUnsafe deserializes a node like ParseNode, but without copying
+// any byte of the payload: the stem and values of the returned node are
+// sub-slices of serializedNode, unless its commitments are compressed.
+// The caller gives up the ownership of serializedNode, which must not be
+// modified for as long as the node is in use.
+func ParseNodeUnsafe(serializedNode []byte, depth byte) (VerkleNode, error) {
+	version, serializedNode, err := splitNodeVersion(serializedNode)
+	if err != nil {
+		return nil, err
+	}
+	switch version {
+	case 0, currentNodeVersion:
+		// Both versions share the same payload layout.
+	case compressedNodeVersion:
+		if serializedNode, err = decompressNodePayload(serializedNode); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidNodeEncoding
+	}
+
+	if len(serializedNode) < nodeTypeSize {
+		return nil, errSerializedPayloadTooShort
+	}
+	if codec, ok := customNodeCodec(serializedNode[nodeTypeOffset]); ok {
+		return codec.Decode(serializedNode, depth)
+	}
+
 	// Check that the length of the serialized node is at least the smallest possible serialized node.
 	if len(serializedNode) < nodeTypeSize+banderwagon.UncompressedSize {
 		return nil, errSerializedPayloadTooShort
@@ -93,11 +358,182 @@ func ParseNode(serializedNode []byte, depth byte) (VerkleNode, error) {
 		return parseEoAccountNode(serializedNode, depth)
 	case singleSlotType:
 		return parseSingleSlotNode(serializedNode, depth)
+	case flaggedLeafType:
+		return parseFlaggedLeafNode(serializedNode, depth)
 	default:
 		return nil, ErrInvalidNodeEncoding
 	}
 }
 
+// ParseNodeStrict deserializes a node like ParseNode, but only accepts the
+// canonical encoding of that node: the one that Serialize would produce.
+// Legacy, compressed and checksummed payloads are rejected, as are payloads
+// with trailing bytes, values encoded with the wrong node type, or leaf
+// sub-commitments that contradict the presence of values in their half of
+// the leaf.
+func ParseNodeStrict(serialized []byte, depth byte) (VerkleNode, error) {
+	if len(serialized) == 0 || serialized[0] != currentVersionHeader {
+		return nil, fmt.Errorf("%w: invalid version header", ErrNonCanonicalEncoding)
+	}
+	node, err := ParseNode(serialized, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	if ln, ok := node.(*LeafNode); ok {
+		var hasC1Values, hasC2Values bool
+		for i, v := range ln.values {
+			if v != nil {
+				hasC1Values = hasC1Values || i < NodeWidth/2
+				hasC2Values = hasC2Values || i >= NodeWidth/2
+			}
+		}
+		if ln.c1.Equal(&banderwagon.Identity) == hasC1Values || ln.c2.Equal(&banderwagon.Identity) == hasC2Values {
+			return nil, fmt.Errorf("%w: sub-commitments contradict the leaf values", ErrNonCanonicalEncoding)
+		}
+	}
+
+	reserialized, err := node.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(reserialized, serialized) {
+		return nil, ErrNonCanonicalEncoding
+	}
+	return node, nil
+}
+
+// ParseNodes deserializes a list of nodes, the i-th node being found at
+// depth depths[i]. Commitments are decoded from their trusted, affine
+// representation so no field inversion is needed; the work is instead
+// split across all CPUs, which makes it the preferred way to load a
+// large number of nodes, e.g. when warming up a cache.
+func ParseNodes(serializedNodes [][]byte, depths []byte) ([]VerkleNode, error) {
+	if len(serializedNodes) != len(depths) {
+		return nil, fmt.Errorf("number of nodes and depths differ: %d != %d", len(serializedNodes), len(depths))
+	}
+
+	ret := make([]VerkleNode, len(serializedNodes))
+	numBatches := runtime.NumCPU()
+	batchSize := (len(serializedNodes) + numBatches - 1) / numBatches
+	var group errgroup.Group
+	for start := 0; start < len(serializedNodes); start += batchSize {
+		end := start + batchSize
+		if end > len(serializedNodes) {
+			end = len(serializedNodes)
+		}
+		group.Go(func() error {
+			for i := start; i < end; i++ {
+				node, err := ParseNode(serializedNodes[i], depths[i])
+				if err != nil {
+					return fmt.Errorf("parsing node #%d: %w", i, err)
+				}
+				ret[i] = node
+			}
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ParseNodeFrom reads a single serialized node from r and deserializes it.
+// Only the bytes belonging to the node are consumed: the version header
+// and node type are read first, and the remaining length is derived from
+// them (and from the bitlist, in the case of a leaf node), so that several
+// nodes can be read back to back from the same stream.
+func ParseNodeFrom(r io.Reader, depth byte) (VerkleNode, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return nil, fmt.Errorf("reading node type: %w", err)
+	}
+	var (
+		header     []byte
+		nodeType   = first[0]
+		compressed bool
+		checksum   bool
+	)
+	if first[0]&nodeVersionFlag != 0 {
+		// Versioned payload, the node type follows the header.
+		checksum = first[0]&nodeChecksumFlag != 0
+		switch first[0] &^ nodeChecksumFlag {
+		case currentVersionHeader:
+		case compressedVersionHeader:
+			compressed = true
+		default:
+			return nil, ErrInvalidNodeEncoding
+		}
+		header = []byte{first[0]}
+		if _, err := io.ReadFull(r, first[:]); err != nil {
+			return nil, fmt.Errorf("reading node type: %w", err)
+		}
+		nodeType = first[0]
+	}
+
+	// Read the part of the payload that determines its length.
+	var prefix []byte
+	switch nodeType {
+	case leafType:
+		prefix = make([]byte, leafCommitmentOffset)
+	case flaggedLeafType:
+		prefix = make([]byte, flaggedLeafCommitmentOffset)
+	default:
+		prefix = make([]byte, nodeTypeSize)
+	}
+	prefix[nodeTypeOffset] = nodeType
+	if _, err := io.ReadFull(r, prefix[nodeTypeSize:]); err != nil {
+		return nil, fmt.Errorf("reading node header: %w", err)
+	}
+
+	var size int
+	switch nodeType {
+	case internalType:
+		size = internalCommitmentOffset + banderwagon.UncompressedSize
+	case leafType:
+		// The header contains the bitlist, which gives the number of values.
+		var count int
+		for _, b := range prefix[leafBitlistOffset:leafCommitmentOffset] {
+			count += bits.OnesCount8(b)
+		}
+		size = leafChildrenOffset + count*LeafValueSize
+	case flaggedLeafType:
+		var count int
+		for _, b := range prefix[leafBitlistOffset:flaggedLeafFlagsOffset] {
+			count += bits.OnesCount8(b)
+		}
+		size = count * LeafValueSize
+	case eoAccountType:
+		size = eoaLeafSize
+	case singleSlotType:
+		size = singleSlotLeafSize
+	default:
+		return nil, ErrInvalidNodeEncoding
+	}
+	_, commCount, err := nodeCommitments(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if nodeType == flaggedLeafType {
+		size += flaggedLeafCommitmentOffset + commCount*banderwagon.UncompressedSize
+	}
+	if compressed {
+		size -= commCount * compressedPointSavings
+	}
+	if checksum {
+		size += nodeChecksumSize
+	}
+
+	serialized := make([]byte, len(header)+size)
+	copy(serialized, header)
+	copy(serialized[len(header):], prefix)
+	if _, err := io.ReadFull(r, serialized[len(header)+len(prefix):]); err != nil {
+		return nil, fmt.Errorf("reading node payload: %w", err)
+	}
+	return ParseNodeUnsafe(serialized, depth)
+}
+
 func parseLeafNode(serialized []byte, depth byte) (VerkleNode, error) {
 	bitlist := serialized[leafBitlistOffset : leafBitlistOffset+bitlistSize]
 	var values [NodeWidth][]byte
@@ -111,7 +547,7 @@ func parseLeafNode(serialized []byte, depth byte) (VerkleNode, error) {
 			offset += LeafValueSize
 		}
 	}
-	ln := NewLeafNodeWithNoComms(serialized[leafStemOffset:leafStemOffset+StemSize], values[:])
+	ln := NewLeafNodeWithNoComms(Stem(serialized[leafStemOffset:leafStemOffset+StemSize]), values[:])
 	ln.setDepth(depth)
 	ln.c1 = new(Point)
 
@@ -139,7 +575,7 @@ func parseEoAccountNode(serialized []byte, depth byte) (VerkleNode, error) {
 	offset := leafStemOffset + StemSize + 2*banderwagon.UncompressedSize
 	values[0] = serialized[offset : offset+leafBasicDataSize] // basic data
 	values[1] = EmptyCodeHash[:]
-	ln := NewLeafNodeWithNoComms(serialized[leafStemOffset:leafStemOffset+StemSize], values[:])
+	ln := NewLeafNodeWithNoComms(Stem(serialized[leafStemOffset:leafStemOffset+StemSize]), values[:])
 	ln.setDepth(depth)
 	ln.c1 = new(Point)
 	if err := ln.c1.SetBytesUncompressed(serialized[leafStemOffset+StemSize:leafStemOffset+StemSize+banderwagon.UncompressedSize], true); err != nil {
@@ -156,7 +592,7 @@ func parseEoAccountNode(serialized []byte, depth byte) (VerkleNode, error) {
 func parseSingleSlotNode(serialized []byte, depth byte) (VerkleNode, error) {
 	var values [NodeWidth][]byte
 	offset := leafStemOffset
-	ln := NewLeafNodeWithNoComms(serialized[offset:offset+StemSize], values[:])
+	ln := NewLeafNodeWithNoComms(Stem(serialized[offset:offset+StemSize]), values[:])
 	offset += StemSize
 	cnCommBytes := serialized[offset : offset+banderwagon.UncompressedSize]
 	offset += banderwagon.UncompressedSize
@@ -186,6 +622,51 @@ func parseSingleSlotNode(serialized []byte, depth byte) (VerkleNode, error) {
 	return ln, nil
 }
 
+func parseFlaggedLeafNode(serialized []byte, depth byte) (VerkleNode, error) {
+	offset, count, err := nodeCommitments(serialized)
+	if err != nil {
+		return nil, err
+	}
+	bitlist := serialized[leafBitlistOffset:flaggedLeafFlagsOffset]
+	flags := serialized[flaggedLeafFlagsOffset]
+	end := offset + count*banderwagon.UncompressedSize
+	for i := range bitlist {
+		end += bits.OnesCount8(bitlist[i]) * LeafValueSize
+	}
+	if len(serialized) < end {
+		return nil, fmt.Errorf("verkle payload is too short, need at least %d and only have %d (%w)", end, len(serialized), errSerializedPayloadTooShort)
+	}
+
+	comms := make([]*Point, count)
+	for i := range comms {
+		comms[i] = new(Point)
+		start := offset + i*banderwagon.UncompressedSize
+		if err := comms[i].SetBytesUncompressed(serialized[start:start+banderwagon.UncompressedSize], true); err != nil {
+			return nil, fmt.Errorf("setting commitment #%d: %w", i, err)
+		}
+	}
+	var values [NodeWidth][]byte
+	offset += count * banderwagon.UncompressedSize
+	for i := 0; i < NodeWidth; i++ {
+		if bit(bitlist, i) {
+			values[i] = serialized[offset : offset+LeafValueSize]
+			offset += LeafValueSize
+		}
+	}
+
+	ln := NewLeafNodeWithNoComms(Stem(serialized[leafStemOffset:leafStemOffset+StemSize]), values[:])
+	ln.setDepth(depth)
+	ln.commitment, comms = comms[0], comms[1:]
+	ln.c1, ln.c2 = new(Point).SetIdentity(), new(Point).SetIdentity()
+	if flags&leafC1Present != 0 {
+		ln.c1, comms = comms[0], comms[1:]
+	}
+	if flags&leafC2Present != 0 {
+		ln.c2 = comms[0]
+	}
+	return ln, nil
+}
+
 func CreateInternalNode(bitlist []byte, raw []byte, depth byte) (*InternalNode, error) {
 	// GetTreeConfig caches computation result, hence
 	// this op has low overhead
@@ -219,3 +700,90 @@ func CreateInternalNode(bitlist []byte, raw []byte, depth byte) (*InternalNode,
 	}
 	return node, nil
 }
+
+// SerializeSubtree packs the root and all its resolved descendants into a
+// single blob, so that the top of a tree can be saved and loaded in one
+// go. Nodes are written depth-first, each prefixed by its length as a
+// varint. The node of each non-empty child of an internal node follows the
+// internal node, in order; a zero length stands for a child that is only
+// known by its commitment. The root is committed first.
+func SerializeSubtree(root VerkleNode) ([]byte, error) {
+	root.Commit()
+	return appendSubtree(nil, root)
+}
+
+func appendSubtree(blob []byte, node VerkleNode) ([]byte, error) {
+	if _, ok := node.(HashedNode); ok {
+		return binary.AppendUvarint(blob, 0), nil
+	}
+	serialized, err := node.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	blob = binary.AppendUvarint(blob, uint64(len(serialized)))
+	blob = append(blob, serialized...)
+
+	if n, ok := node.(*InternalNode); ok {
+		for _, child := range n.children {
+			if _, ok := child.(Empty); ok {
+				continue
+			}
+			if blob, err = appendSubtree(blob, child); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return blob, nil
+}
+
+// ParseSubtree restores a subtree from the output of SerializeSubtree,
+// its root being located at the given depth.
+func ParseSubtree(blob []byte, depth byte) (VerkleNode, error) {
+	owned := make([]byte, len(blob))
+	copy(owned, blob)
+	root, rest, err := parseSubtree(owned, depth)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("missing subtree root: %w", ErrInvalidNodeEncoding)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after subtree: %w", len(rest), ErrInvalidNodeEncoding)
+	}
+	return root, nil
+}
+
+// parseSubtree reads the subtree at the start of blob, and returns the
+// bytes that follow it. A nil node is returned for an unresolved child.
+func parseSubtree(blob []byte, depth byte) (VerkleNode, []byte, error) {
+	size, n := binary.Uvarint(blob)
+	if n <= 0 || uint64(len(blob)-n) < size {
+		return nil, nil, errSerializedPayloadTooShort
+	}
+	blob = blob[n:]
+	if size == 0 {
+		return nil, blob, nil
+	}
+	node, err := ParseNodeUnsafe(blob[:size], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	blob = blob[size:]
+
+	if in, ok := node.(*InternalNode); ok {
+		for i, child := range in.children {
+			if _, ok := child.(Empty); ok {
+				continue
+			}
+			var resolved VerkleNode
+			if resolved, blob, err = parseSubtree(blob, depth+1); err != nil {
+				return nil, nil, fmt.Errorf("parsing child #%d at depth %d: %w", i, depth, err)
+			}
+			if resolved != nil {
+				in.children[i] = resolved
+			}
+		}
+	}
+	return node, blob, nil
+}
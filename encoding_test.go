@@ -2,6 +2,8 @@ package verkle
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"testing"
 
 	"github.com/crate-crypto/go-ipa/banderwagon"
@@ -22,7 +24,7 @@ func TestLeafStemLength(t *testing.T) {
 	// Serialize a leaf with no values, but whose stem is 32 bytes. The
 	// serialization should trim the extra byte.
 	toolong := make([]byte, 32)
-	leaf, err := NewLeafNode(toolong, make([][]byte, NodeWidth))
+	leaf, err := NewLeafNode(KeyToStem(toolong), make([][]byte, NodeWidth))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -30,8 +32,8 @@ func TestLeafStemLength(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(ser) != nodeTypeSize+StemSize+bitlistSize+3*banderwagon.UncompressedSize {
-		t.Fatalf("invalid serialization when the stem is longer than 31 bytes: %x (%d bytes != %d)", ser, len(ser), nodeTypeSize+StemSize+bitlistSize+2*banderwagon.UncompressedSize)
+	if len(ser) != nodeVersionSize+nodeTypeSize+StemSize+bitlistSize+3*banderwagon.UncompressedSize {
+		t.Fatalf("invalid serialization when the stem is longer than 31 bytes: %x (%d bytes != %d)", ser, len(ser), nodeVersionSize+nodeTypeSize+StemSize+bitlistSize+3*banderwagon.UncompressedSize)
 	}
 }
 
@@ -46,7 +48,7 @@ func TestInvalidNodeEncoding(t *testing.T) {
 	// Test an invalid node type.
 	values := make([][]byte, NodeWidth)
 	values[42] = testValue
-	ln, err := NewLeafNode(ffx32KeyTest, values)
+	ln, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -54,7 +56,7 @@ func TestInvalidNodeEncoding(t *testing.T) {
 	if err != nil {
 		t.Fatalf("serializing leaf node: %v", err)
 	}
-	lnbytes[0] = 0xc0 // Change the type of the node to something invalid.
+	lnbytes[nodeVersionSize] = 0x40 // Change the type of the node to something invalid.
 	if _, err := ParseNode(lnbytes, 0); err != ErrInvalidNodeEncoding {
 		t.Fatalf("invalid error, got %v, expected %v", err, ErrInvalidNodeEncoding)
 	}
@@ -67,7 +69,7 @@ func TestParseNodeEoA(t *testing.T) {
 	values[2] = fourtyKeyTest[:] // set nonce to 64
 	values[3] = EmptyCodeHash[:] // set empty code hash
 	values[4] = zero32[:]        // zero-size
-	ln, err := NewLeafNode(ffx32KeyTest[:31], values)
+	ln, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
 	if err != nil {
 		t.Fatalf("error creating leaf node: %v", err)
 	}
@@ -77,8 +79,8 @@ func TestParseNodeEoA(t *testing.T) {
 		t.Fatalf("error serializing leaf node: %v", err)
 	}
 
-	if serialized[0] != eoAccountType {
-		t.Fatalf("invalid encoding type, got %d, expected %d", serialized[0], eoAccountType)
+	if serialized[nodeVersionSize] != eoAccountType {
+		t.Fatalf("invalid encoding type, got %d, expected %d", serialized[nodeVersionSize], eoAccountType)
 	}
 
 	deserialized, err := ParseNode(serialized, 5)
@@ -95,7 +97,7 @@ func TestParseNodeEoA(t *testing.T) {
 		t.Fatalf("invalid depth, got %d, expected %d", lnd.depth, 5)
 	}
 
-	if !bytes.Equal(lnd.stem, ffx32KeyTest[:31]) {
+	if !bytes.Equal(lnd.stem[:], ffx32KeyTest[:31]) {
 		t.Fatalf("invalid stem, got %x, expected %x", lnd.stem, ffx32KeyTest[:31])
 	}
 
@@ -134,7 +136,7 @@ func TestParseNodeEoA(t *testing.T) {
 func TestParseNodeSingleSlot(t *testing.T) {
 	values := make([][]byte, 256)
 	values[153] = EmptyCodeHash
-	ln, err := NewLeafNode(ffx32KeyTest[:31], values)
+	ln, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
 	if err != nil {
 		t.Fatalf("error creating leaf node: %v", err)
 	}
@@ -144,8 +146,8 @@ func TestParseNodeSingleSlot(t *testing.T) {
 		t.Fatalf("error serializing leaf node: %v", err)
 	}
 
-	if serialized[0] != singleSlotType {
-		t.Fatalf("invalid encoding type, got %d, expected %d", serialized[0], singleSlotType)
+	if serialized[nodeVersionSize] != singleSlotType {
+		t.Fatalf("invalid encoding type, got %d, expected %d", serialized[nodeVersionSize], singleSlotType)
 	}
 
 	deserialized, err := ParseNode(serialized, 5)
@@ -162,7 +164,7 @@ func TestParseNodeSingleSlot(t *testing.T) {
 		t.Fatalf("invalid depth, got %d, expected %d", lnd.depth, 5)
 	}
 
-	if !bytes.Equal(lnd.stem, ffx32KeyTest[:31]) {
+	if !bytes.Equal(lnd.stem[:], ffx32KeyTest[:31]) {
 		t.Fatalf("invalid stem, got %x, expected %x", lnd.stem, ffx32KeyTest[:31])
 	}
 
@@ -190,3 +192,583 @@ func TestParseNodeSingleSlot(t *testing.T) {
 		t.Fatalf("invalid commitment, got %x, expected %x", lnd.commitment, ln.commitment)
 	}
 }
+
+func TestParseNodeFlaggedLeaf(t *testing.T) {
+	t.Parallel()
+
+	// Contiguous values in a single half, as the code chunks of a stem
+	// past the account header, are flagged too.
+	var chunks []int
+	for i := 128; i < 160; i++ {
+		chunks = append(chunks, i)
+	}
+	for _, indices := range [][]int{{5, 10, 127}, {128, 130, 200}, chunks} {
+		values := make([][]byte, NodeWidth)
+		for _, idx := range indices {
+			values[idx] = testValue
+		}
+		ln, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
+		if err != nil {
+			t.Fatalf("error creating leaf node: %v", err)
+		}
+		serialized, err := ln.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing leaf node: %v", err)
+		}
+		if serialized[nodeVersionSize] != flaggedLeafType {
+			t.Fatalf("invalid encoding type, got %d, expected %d", serialized[nodeVersionSize], flaggedLeafType)
+		}
+		// One sub-commitment is omitted, and a flags byte is added.
+		if expected := nodeVersionSize + leafChildrenOffset + len(indices)*LeafValueSize - banderwagon.UncompressedSize + 1; len(serialized) != expected || ln.Size() != expected {
+			t.Fatalf("invalid serialized length, got %d (size %d), expected %d", len(serialized), ln.Size(), expected)
+		}
+		compressed, err := SerializeNodeCompressed(ln)
+		if err != nil {
+			t.Fatalf("error serializing leaf node: %v", err)
+		}
+
+		for _, parse := range []func() (VerkleNode, error){
+			func() (VerkleNode, error) { return ParseNode(serialized, 5) },
+			func() (VerkleNode, error) { return ParseNodeFrom(bytes.NewReader(serialized), 5) },
+			func() (VerkleNode, error) { return ParseNode(compressed, 5) },
+			func() (VerkleNode, error) { return ParseNodeFrom(bytes.NewReader(compressed), 5) },
+		} {
+			deserialized, err := parse()
+			if err != nil {
+				t.Fatalf("error deserializing leaf node: %v", err)
+			}
+			lnd := deserialized.(*LeafNode)
+			for i := range values {
+				if !bytes.Equal(lnd.values[i], values[i]) || (lnd.values[i] == nil) != (values[i] == nil) {
+					t.Fatalf("invalid value #%d, got %x, expected %x", i, lnd.values[i], values[i])
+				}
+			}
+			if !lnd.commitment.Equal(ln.commitment) || !lnd.c1.Equal(ln.c1) || !lnd.c2.Equal(ln.c2) {
+				t.Fatal("invalid commitments")
+			}
+		}
+	}
+}
+
+func TestParseNodeFrom(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	// Write the root and the leaves to the same stream.
+	nodes := []VerkleNode{root, root.(*InternalNode).children[0], root.(*InternalNode).children[64]}
+	var stream bytes.Buffer
+	for _, n := range nodes {
+		serialized, err := n.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node: %v", err)
+		}
+		stream.Write(serialized)
+	}
+
+	for i, n := range nodes {
+		depth := byte(1)
+		if i == 0 {
+			depth = 0
+		}
+		parsed, err := ParseNodeFrom(&stream, depth)
+		if err != nil {
+			t.Fatalf("error parsing node #%d: %v", i, err)
+		}
+		if !parsed.Commitment().Equal(n.Commitment()) {
+			t.Fatalf("invalid commitment for node #%d", i)
+		}
+	}
+	if stream.Len() != 0 {
+		t.Fatalf("%d bytes left unread in the stream", stream.Len())
+	}
+
+	if _, err := ParseNodeFrom(&stream, 0); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF error, got %v", err)
+	}
+}
+
+func TestParseNodeCompressed(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+	values := make([][]byte, NodeWidth)
+	values[0] = zeroKeyTest
+	values[1] = EmptyCodeHash
+	eoa, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+
+	// Internal, leaf, single-slot and EoA nodes.
+	nodes := []VerkleNode{root, root.(*InternalNode).children[0], root.(*InternalNode).children[64], eoa}
+	depths := []byte{0, 1, 1, 1}
+	var stream bytes.Buffer
+	for i, n := range nodes {
+		serialized, err := n.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		compressed, err := SerializeNodeCompressed(n)
+		if err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		_, count, _ := nodeCommitments(serialized[nodeVersionSize:])
+		if len(compressed) != len(serialized)-count*compressedPointSavings {
+			t.Fatalf("invalid compressed length for node #%d: %d", i, len(compressed))
+		}
+		parsed, err := ParseNode(compressed, depths[i])
+		if err != nil {
+			t.Fatalf("error parsing node #%d: %v", i, err)
+		}
+		// Decompression may pick another representative of the same group
+		// element, so commitments are compared rather than serialized nodes.
+		if !parsed.Commitment().Equal(n.Commitment()) {
+			t.Fatalf("invalid commitment for node #%d", i)
+		}
+		if leaf, ok := n.(*LeafNode); ok {
+			pleaf := parsed.(*LeafNode)
+			if !pleaf.c1.Equal(leaf.c1) || !pleaf.c2.Equal(leaf.c2) {
+				t.Fatalf("invalid c1 or c2 for node #%d", i)
+			}
+			for j := range leaf.values {
+				if !bytes.Equal(pleaf.values[j], leaf.values[j]) {
+					t.Fatalf("invalid value #%d for node #%d", j, i)
+				}
+			}
+		}
+		stream.Write(compressed)
+	}
+
+	for i, n := range nodes {
+		parsed, err := ParseNodeFrom(&stream, depths[i])
+		if err != nil {
+			t.Fatalf("error reading node #%d: %v", i, err)
+		}
+		if !parsed.Commitment().Equal(n.Commitment()) {
+			t.Fatalf("invalid commitment for node #%d", i)
+		}
+	}
+	if stream.Len() != 0 {
+		t.Fatalf("%d bytes left unread in the stream", stream.Len())
+	}
+
+	// Compressed commitments are validated.
+	compressed, err := SerializeNodeCompressed(root)
+	if err != nil {
+		t.Fatalf("error serializing root: %v", err)
+	}
+	for i := len(compressed) - banderwagon.CompressedSize; i < len(compressed); i++ {
+		compressed[i] = 0xff
+	}
+	if _, err := ParseNode(compressed, 0); err == nil {
+		t.Fatal("expected an error parsing an invalid commitment")
+	}
+}
+
+func TestParseNodeOwnership(t *testing.T) {
+	t.Parallel()
+
+	values := make([][]byte, NodeWidth)
+	values[0] = testValue
+	values[1] = testValue
+	ln, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+	serialized, err := ln.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing leaf node: %v", err)
+	}
+
+	safe, err := ParseNode(serialized, 1)
+	if err != nil {
+		t.Fatalf("error deserializing leaf node: %v", err)
+	}
+	unsafe, err := ParseNodeUnsafe(serialized, 1)
+	if err != nil {
+		t.Fatalf("error deserializing leaf node: %v", err)
+	}
+
+	// Overwrite the payload: only the node returned by
+	// ParseNodeUnsafe should see the change.
+	for i := range serialized {
+		serialized[i] = 0
+	}
+	if !bytes.Equal(safe.(*LeafNode).stem[:], ffx32KeyTest[:StemSize]) || !bytes.Equal(safe.(*LeafNode).values[0], testValue) {
+		t.Fatal("node returned by ParseNode references the serialized payload")
+	}
+	if !bytes.Equal(unsafe.(*LeafNode).values[0], zero32[:]) {
+		t.Fatal("node returned by ParseNodeUnsafe doesn't reference the serialized payload")
+	}
+}
+
+func TestParseNodeVersions(t *testing.T) {
+	t.Parallel()
+
+	values := make([][]byte, NodeWidth)
+	values[0] = testValue
+	values[200] = testValue
+	ln, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+	serialized, err := ln.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing leaf node: %v", err)
+	}
+	if serialized[0] != currentVersionHeader {
+		t.Fatalf("invalid version header, got %x, expected %x", serialized[0], currentVersionHeader)
+	}
+
+	// Payloads written before versioning have no header.
+	for _, payload := range [][]byte{serialized, serialized[nodeVersionSize:]} {
+		parsed, err := ParseNode(payload, 1)
+		if err != nil {
+			t.Fatalf("error deserializing leaf node: %v", err)
+		}
+		if !parsed.Commitment().Equal(ln.Commitment()) {
+			t.Fatal("invalid deserialized commitment")
+		}
+	}
+
+	// Unknown versions must be rejected.
+	serialized[0] = nodeVersionFlag | 0x3f
+	if _, err := ParseNode(serialized, 1); err != ErrInvalidNodeEncoding {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrInvalidNodeEncoding)
+	}
+}
+
+func TestParseNodes(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range randomKeys(t, 100) {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	serializedNodes, err := root.(*InternalNode).BatchSerialize()
+	if err != nil {
+		t.Fatalf("error serializing tree: %v", err)
+	}
+
+	var (
+		payloads = make([][]byte, len(serializedNodes))
+		depths   = make([]byte, len(serializedNodes))
+	)
+	for i, sn := range serializedNodes {
+		payloads[i] = sn.SerializedBytes
+		depths[i] = byte(len(sn.Path))
+	}
+	nodes, err := ParseNodes(payloads, depths)
+	if err != nil {
+		t.Fatalf("error parsing nodes: %v", err)
+	}
+	for i, n := range nodes {
+		if !n.Commitment().Equal(serializedNodes[i].Node.Commitment()) {
+			t.Fatalf("invalid commitment for node #%d", i)
+		}
+	}
+
+	if _, err := ParseNodes(payloads, depths[1:]); err == nil {
+		t.Fatal("expected an error when the number of depths doesn't match")
+	}
+	payloads[len(payloads)/2] = []byte{leafType}
+	if _, err := ParseNodes(payloads, depths); !errors.Is(err, errSerializedPayloadTooShort) {
+		t.Fatalf("invalid error, got %v, expected %v", err, errSerializedPayloadTooShort)
+	}
+}
+
+func TestSerializeTo(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	// Single slot leaf.
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	// Regular leaf, with values of different lengths.
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, testValue[:5], nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	// EoA leaf.
+	eoaValues := make([][]byte, NodeWidth)
+	eoaValues[0] = zero32[:]
+	eoaValues[1] = EmptyCodeHash
+	if err := root.(*InternalNode).InsertValuesAtStem(KeyToStem(ffx32KeyTest), eoaValues, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	for _, n := range []VerkleNode{root, root.(*InternalNode).children[0], root.(*InternalNode).children[64], root.(*InternalNode).children[255]} {
+		serialized, err := n.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node: %v", err)
+		}
+		if n.Size() != len(serialized) {
+			t.Fatalf("invalid size hint, got %d, expected %d", n.Size(), len(serialized))
+		}
+
+		var buf bytes.Buffer
+		written, err := n.SerializeTo(&buf)
+		if err != nil {
+			t.Fatalf("error serializing node: %v", err)
+		}
+		if written != len(serialized) || !bytes.Equal(buf.Bytes(), serialized) {
+			t.Fatalf("invalid serialization, got %x, expected %x", buf.Bytes(), serialized)
+		}
+	}
+
+	if _, err := (HashedNode{}).SerializeTo(io.Discard); err != errSerializeHashedNode {
+		t.Fatalf("invalid error, got %v, expected %v", err, errSerializeHashedNode)
+	}
+}
+
+func TestSerializeSubtree(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 200)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	// Leave one child unresolved.
+	hashedIdx := keys[0][0]
+	root.(*InternalNode).children[hashedIdx] = HashedNode{}
+
+	blob, err := SerializeSubtree(root)
+	if err != nil {
+		t.Fatalf("error serializing subtree: %v", err)
+	}
+	parsed, err := ParseSubtree(blob, 0)
+	if err != nil {
+		t.Fatalf("error parsing subtree: %v", err)
+	}
+	if !parsed.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	if _, ok := parsed.(*InternalNode).children[hashedIdx].(HashedNode); !ok {
+		t.Fatalf("expected child #%d to be unresolved, got %T", hashedIdx, parsed.(*InternalNode).children[hashedIdx])
+	}
+	for _, k := range keys {
+		if k[0] == hashedIdx {
+			continue
+		}
+		v, err := parsed.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting key %x: %v", k, err)
+		}
+		if !bytes.Equal(v, testValue) {
+			t.Fatalf("invalid value for key %x: %x", k, v)
+		}
+	}
+	reserialized, err := SerializeSubtree(parsed)
+	if err != nil {
+		t.Fatalf("error serializing subtree: %v", err)
+	}
+	if !bytes.Equal(reserialized, blob) {
+		t.Fatal("subtree differs after a round trip")
+	}
+
+	if _, err := ParseSubtree(blob[:len(blob)-1], 0); err == nil {
+		t.Fatal("expected an error parsing a truncated subtree")
+	}
+}
+
+func TestNodeChecksum(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	for i, n := range []VerkleNode{root, root.(*InternalNode).children[0]} {
+		serialized, err := n.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		compressed, err := SerializeNodeCompressed(n)
+		if err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		for _, payload := range [][]byte{serialized, compressed} {
+			checksummed, err := AppendNodeChecksum(payload)
+			if err != nil {
+				t.Fatalf("error adding checksum to node #%d: %v", i, err)
+			}
+			parsed, err := ParseNode(checksummed, byte(i))
+			if err != nil {
+				t.Fatalf("error parsing node #%d: %v", i, err)
+			}
+			if !parsed.Commitment().Equal(n.Commitment()) {
+				t.Fatalf("invalid commitment for node #%d", i)
+			}
+			if parsed, err = ParseNodeFrom(bytes.NewReader(checksummed), byte(i)); err != nil {
+				t.Fatalf("error reading node #%d: %v", i, err)
+			}
+			if !parsed.Commitment().Equal(n.Commitment()) {
+				t.Fatalf("invalid commitment for node #%d", i)
+			}
+
+			// Flip a bit in the payload.
+			checksummed[len(checksummed)/2] ^= 1
+			if _, err := ParseNode(checksummed, byte(i)); !errors.Is(err, ErrNodeChecksumMismatch) {
+				t.Fatalf("invalid error, got %v, expected %v", err, ErrNodeChecksumMismatch)
+			}
+			if _, err := ParseNodeFrom(bytes.NewReader(checksummed), byte(i)); !errors.Is(err, ErrNodeChecksumMismatch) {
+				t.Fatalf("invalid error, got %v, expected %v", err, ErrNodeChecksumMismatch)
+			}
+		}
+	}
+}
+
+func TestParseNodeStrict(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest, ffx32KeyTest} {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	leaf := root.(*InternalNode).children[0].(*LeafNode)
+
+	for i, n := range []VerkleNode{root, leaf} {
+		serialized, err := n.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		parsed, err := ParseNodeStrict(serialized, byte(i))
+		if err != nil {
+			t.Fatalf("error parsing node #%d: %v", i, err)
+		}
+		if !parsed.Commitment().Equal(n.Commitment()) {
+			t.Fatalf("invalid commitment for node #%d", i)
+		}
+
+		// Trailing bytes must be rejected.
+		if _, err := ParseNodeStrict(append(serialized, 0), byte(i)); err == nil {
+			t.Fatalf("expected an error parsing node #%d with trailing bytes", i)
+		}
+		// So must checksummed payloads.
+		checksummed, err := AppendNodeChecksum(serialized)
+		if err != nil {
+			t.Fatalf("error adding checksum to node #%d: %v", i, err)
+		}
+		if _, err := ParseNodeStrict(checksummed, byte(i)); !errors.Is(err, ErrNonCanonicalEncoding) {
+			t.Fatalf("invalid error, got %v, expected %v", err, ErrNonCanonicalEncoding)
+		}
+	}
+
+	values := make([][]byte, NodeWidth)
+	values[0] = testValue
+	single, err := NewLeafNode(KeyToStem(zeroKeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf: %v", err)
+	}
+	serialized, err := single.Serialize()
+	if err != nil {
+		t.Fatalf("error serializing leaf: %v", err)
+	}
+	if _, err := ParseNodeStrict(serialized, 1); err != nil {
+		t.Fatalf("error parsing leaf: %v", err)
+	}
+
+	// The same leaf, encoded with the full leaf layout, is not canonical
+	// since Serialize picks the single-slot layout.
+	full, payload := newSerializedNode(leafChildrenOffset + LeafValueSize)
+	payload[0] = leafType
+	copy(payload[leafStemOffset:], single.stem[:])
+	setBit(payload[leafBitlistOffset:leafCommitmentOffset], 0)
+	cBytes, c1Bytes, c2Bytes := single.commitment.BytesUncompressedTrusted(), single.c1.BytesUncompressedTrusted(), single.c2.BytesUncompressedTrusted()
+	copy(payload[leafCommitmentOffset:], cBytes[:])
+	copy(payload[leafC1CommitmentOffset:], c1Bytes[:])
+	copy(payload[leafC2CommitmentOffset:], c2Bytes[:])
+	copy(payload[leafChildrenOffset:], testValue)
+	if _, err := ParseNode(full, 1); err != nil {
+		t.Fatalf("error parsing leaf: %v", err)
+	}
+	if _, err := ParseNodeStrict(full, 1); !errors.Is(err, ErrNonCanonicalEncoding) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrNonCanonicalEncoding)
+	}
+
+	// A single-slot leaf whose sub-commitment is the identity contradicts
+	// the presence of a value in its half of the leaf.
+	identityBytes := banderwagon.Identity.BytesUncompressedTrusted()
+	copy(serialized[nodeVersionSize+leafStemOffset+StemSize:], identityBytes[:])
+	if _, err := ParseNodeStrict(serialized, 1); !errors.Is(err, ErrNonCanonicalEncoding) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrNonCanonicalEncoding)
+	}
+}
+
+func TestAppendSerializedNode(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest} {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+
+	var buf []byte
+	nodes := []VerkleNode{root, root.(*InternalNode).children[0], root.(*InternalNode).children[64]}
+	for i, n := range nodes {
+		start := len(buf)
+		var err error
+		if buf, err = AppendSerializedNode(buf, n); err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		serialized, err := n.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node #%d: %v", i, err)
+		}
+		if !bytes.Equal(buf[start:], serialized) {
+			t.Fatalf("invalid serialization for node #%d, got %x, expected %x", i, buf[start:], serialized)
+		}
+	}
+
+	// Reusing the buffer must not leak bytes from a previous, larger node.
+	buf, err := AppendSerializedNode(buf[:0], nodes[2])
+	if err != nil {
+		t.Fatalf("error serializing node: %v", err)
+	}
+	serialized, _ := nodes[2].Serialize()
+	if !bytes.Equal(buf, serialized) {
+		t.Fatalf("invalid serialization, got %x, expected %x", buf, serialized)
+	}
+}
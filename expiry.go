@@ -0,0 +1,253 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StateEpoch is a period of time, such as a number of blocks, after which
+// the parts of the tree that haven't been accessed can expire.
+type StateEpoch uint64
+
+// ErrExpired is returned when accessing an expired subtree.
+var ErrExpired = errors.New("trying to access an expired subtree")
+
+// MarkAccessed records that the stem was accessed during the given epoch,
+// in all the nodes along its path that are in memory.
+func (n *InternalNode) MarkAccessed(stem Stem, epoch StateEpoch) {
+	n.epoch = max(n.epoch, epoch)
+	switch child := n.writableChild(offset2key(stem[:], n.depth)).(type) {
+	case *InternalNode:
+		child.MarkAccessed(stem, epoch)
+	case *LeafNode:
+		if child.stem == stem {
+			child.epoch = max(child.epoch, epoch)
+		}
+	}
+}
+
+// ExpireBefore replaces the subtrees that weren't accessed since the given
+// epoch with ExpiredNode, which only retains their commitment. The tree
+// is committed first, and the number of expired subtrees is returned.
+func (n *InternalNode) ExpireBefore(epoch StateEpoch) int {
+	n.Commit()
+	return n.expireBefore(epoch)
+}
+
+func (n *InternalNode) expireBefore(epoch StateEpoch) int {
+	var count int
+	for i, child := range n.children {
+		switch child := child.(type) {
+		case *InternalNode:
+			if child.epoch >= epoch {
+				count += n.writableChild(byte(i)).(*InternalNode).expireBefore(epoch)
+				continue
+			}
+		case *LeafNode:
+			if child.epoch >= epoch || child.isPOAStub {
+				continue
+			}
+		default:
+			continue
+		}
+		n.children[i] = ExpiredNode{commitment: new(Point).Set(child.Commitment())}
+		count++
+	}
+	return count
+}
+
+// ResurrectionProof holds the content of an expired subtree, so that a
+// tree in which it expired can check it against the retained commitment
+// and revive it.
+type ResurrectionProof struct {
+	// Path is the path of the expired subtree.
+	Path []byte
+	// Paths and Nodes are the paths and serialized nodes of the
+	// complete subtree.
+	Paths [][]byte
+	Nodes [][]byte
+}
+
+// MakeResurrectionProof creates the proof that revives the subtree found
+// at path, out of a tree in which it didn't expire, such as the tree of an
+// archive node. If path leads to a leaf before its end, that leaf is the
+// subtree to revive.
+func MakeResurrectionProof(root *InternalNode, path []byte, resolver NodeResolverFn) (*ResurrectionProof, error) {
+	root.Commit()
+	node, err := root.ExtractSubtree(path, resolver)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case *InternalNode:
+	case *LeafNode:
+		path = n.stem[:n.depth]
+	default:
+		return nil, fmt.Errorf("no subtree to revive at path %x: %T", path, node)
+	}
+	proof := &ResurrectionProof{Path: append([]byte{}, path...)}
+	if err := proof.collect(node, proof.Path, resolver); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func (proof *ResurrectionProof) collect(node VerkleNode, path []byte, resolver NodeResolverFn) error {
+	serialized, err := node.Serialize()
+	if err != nil {
+		return fmt.Errorf("serializing node at path %x: %w", path, err)
+	}
+	proof.Paths = append(proof.Paths, path)
+	proof.Nodes = append(proof.Nodes, serialized)
+
+	internal, ok := node.(*InternalNode)
+	if !ok {
+		return nil
+	}
+	for i, child := range internal.children {
+		if _, ok := child.(Empty); ok {
+			continue
+		}
+		childPath := append(path[:len(path):len(path)], byte(i))
+		resolved, err := internal.resolveChild(childPath, resolver)
+		if err != nil {
+			return err
+		}
+		if err := proof.collect(resolved, childPath, resolver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resurrect checks the content of an expired subtree against the
+// commitment that the tree retained, and puts it back in the tree. The
+// revived nodes have no epoch, so they should be marked as accessed if
+// they are to survive the next expiry.
+func (n *InternalNode) Resurrect(proof *ResurrectionProof) error {
+	if len(proof.Path) == 0 || len(proof.Path) > StemSize {
+		return fmt.Errorf("invalid path %x", proof.Path)
+	}
+	parent := n
+	for _, idx := range proof.Path[:len(proof.Path)-1] {
+		child, ok := parent.writableChild(idx).(*InternalNode)
+		if !ok {
+			return fmt.Errorf("no expired subtree at path %x", proof.Path)
+		}
+		parent = child
+	}
+	idx := proof.Path[len(proof.Path)-1]
+	expired, ok := parent.children[idx].(ExpiredNode)
+	if !ok {
+		return fmt.Errorf("no expired subtree at path %x", proof.Path)
+	}
+
+	nodes, err := verifySubtreeNodes(expired.commitment, proof.Path, proof.Paths, proof.Nodes)
+	if err != nil {
+		return err
+	}
+	byPath := make(map[string]VerkleNode, len(nodes))
+	for i, node := range nodes {
+		byPath[string(proof.Paths[i])] = node
+	}
+	if _, ok := byPath[string(proof.Path)]; !ok {
+		return fmt.Errorf("%w: missing the root of the subtree at path %x", ErrUnverifiableNode, proof.Path)
+	}
+	for i, node := range nodes {
+		if internal, ok := node.(*InternalNode); ok {
+			for c, child := range internal.children {
+				if _, ok := child.(Empty); !ok {
+					internal.children[c] = byPath[string(append(proof.Paths[i][:len(proof.Paths[i]):len(proof.Paths[i])], byte(c)))]
+				}
+			}
+		}
+	}
+	parent.children[idx] = byPath[string(proof.Path)]
+	return nil
+}
+
+// ExpiredNode is a subtree that expired, of which only the commitment is
+// retained.
+type ExpiredNode struct {
+	commitment *Point
+}
+
+func (ExpiredNode) Insert([]byte, []byte, NodeResolverFn) error {
+	return ErrExpired
+}
+
+func (ExpiredNode) Delete([]byte, NodeResolverFn) (bool, error) {
+	return false, ErrExpired
+}
+
+func (ExpiredNode) Get([]byte, NodeResolverFn) ([]byte, error) {
+	return nil, ErrExpired
+}
+
+func (n ExpiredNode) Commit() *Point {
+	return n.commitment
+}
+
+func (n ExpiredNode) Commitment() *Point {
+	return n.commitment
+}
+
+func (n ExpiredNode) Hash() *Fr {
+	var hash Fr
+	n.commitment.MapToScalarField(&hash)
+	return &hash
+}
+
+func (ExpiredNode) GetProofItems(keylist, NodeResolverFn) (*ProofElements, []byte, []Stem, error) {
+	return nil, nil, nil, ErrExpired
+}
+
+func (ExpiredNode) Serialize() ([]byte, error) {
+	return nil, ErrExpired
+}
+
+func (ExpiredNode) SerializeTo(io.Writer) (int, error) {
+	return 0, ErrExpired
+}
+
+func (ExpiredNode) Size() int {
+	return 0
+}
+
+func (n ExpiredNode) Copy() VerkleNode {
+	return ExpiredNode{commitment: new(Point).Set(n.commitment)}
+}
+
+func (n ExpiredNode) toDot(parent, path string) string {
+	return fmt.Sprintf("expired%s [label=\"E: %x\"]\n%s -> expired%s\n", path, n.commitment.Bytes(), parent, path)
+}
+
+func (ExpiredNode) setDepth(byte) {
+	// do nothing
+}
@@ -0,0 +1,136 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestExpireBefore(t *testing.T) {
+	t.Parallel()
+
+	root := New().(*InternalNode)
+	keys := randomKeysSorted(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+		root.MarkAccessed(KeyToStem(k), 1)
+	}
+	for _, k := range keys[:10] {
+		root.MarkAccessed(KeyToStem(k), 2)
+	}
+	rootC := root.Commit().Bytes()
+
+	if count := root.ExpireBefore(2); count == 0 {
+		t.Fatal("nothing expired")
+	}
+	if root.Commit().Bytes() != rootC {
+		t.Fatal("expiry changed the root commitment")
+	}
+	var expired []byte
+	for i, k := range keys {
+		_, err := root.Get(k, nil)
+		if i < 10 && err != nil {
+			t.Fatalf("error getting live key %x: %v", k, err)
+		}
+		if _, ok := root.children[k[0]].(ExpiredNode); ok {
+			if !errors.Is(err, ErrExpired) {
+				t.Fatalf("expected ErrExpired for %x, got %v", k, err)
+			}
+			expired = k
+		}
+	}
+	if expired == nil {
+		t.Fatal("no expired subtree under the root")
+	}
+	if err := root.Insert(expired, testValue, nil); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+
+	// The live keys can still be proven.
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys[:10]...), nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	if err := verifyVerkleProofWithPreState(proof, root); err != nil {
+		t.Fatalf("error verifying proof: %v", err)
+	}
+}
+
+func TestResurrect(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeysSorted(t, 100)
+	build := func() *InternalNode {
+		root := New().(*InternalNode)
+		for _, k := range keys {
+			if err := root.Insert(k, k, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		root.Commit()
+		return root
+	}
+	archive, root := build(), build()
+	root.MarkAccessed(KeyToStem(keys[0]), 1)
+	root.ExpireBefore(1)
+
+	// Find a key whose subtree expired just below the root.
+	var key []byte
+	for _, k := range keys {
+		if _, ok := root.children[k[0]].(ExpiredNode); ok {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		t.Fatal("no expired subtree under the root")
+	}
+
+	proof, err := MakeResurrectionProof(archive, key[:1], nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+
+	// A proof with a modified node is rejected.
+	tampered := *proof
+	tampered.Nodes = append([][]byte{}, proof.Nodes...)
+	last := append([]byte{}, tampered.Nodes[len(tampered.Nodes)-1]...)
+	last[len(last)-1] ^= 1
+	tampered.Nodes[len(tampered.Nodes)-1] = last
+	if err := root.Resurrect(&tampered); err == nil {
+		t.Fatal("a tampered proof was accepted")
+	}
+	if _, ok := root.children[key[0]].(ExpiredNode); !ok {
+		t.Fatal("a rejected proof modified the tree")
+	}
+
+	if err := root.Resurrect(proof); err != nil {
+		t.Fatalf("error reviving subtree: %v", err)
+	}
+	value, err := root.Get(key, nil)
+	if err != nil {
+		t.Fatalf("error getting revived key: %v", err)
+	}
+	if !bytes.Equal(value, key) {
+		t.Fatalf("invalid revived value %x", value)
+	}
+	if !root.Commit().Equal(archive.Commit()) {
+		t.Fatal("revival changed the root commitment")
+	}
+	// The revived subtree can be written to again.
+	if err := root.Insert(key, testValue, nil); err != nil {
+		t.Fatalf("error inserting into the revived subtree: %v", err)
+	}
+	if err := archive.Insert(key, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if !root.Commit().Equal(archive.Commit()) {
+		t.Fatal("invalid commitment after writing to the revived subtree")
+	}
+
+	if err := root.Resurrect(proof); err == nil {
+		t.Fatal("expected an error reviving a live subtree")
+	}
+}
@@ -0,0 +1,285 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// Tree export file format. All integers are big endian.
+//
+//	header:  <magic "VKLT"><version><config fingerprint><root commitment>
+//	records: <length uint32><serialized node><crc32c(serialized node)>
+//	footer:  <length uint32 = 0><node count uint64><crc32c(header, records, node count)>
+//
+// Records are written depth-first: each internal node is followed by the
+// subtrees of its non-empty children, in order. The fingerprint is that of
+// the configuration the tree was committed with, see Config.Fingerprint.
+// The root commitment is in its 32-byte compressed form, and the checksums
+// use the Castagnoli polynomial.
+const (
+	exportVersion     byte = 2
+	exportFingerprint      = len(exportMagic) + 1
+	exportHeaderSize       = exportFingerprint + 32 + banderwagon.CompressedSize
+
+	// exportMaxRecordSize bounds the allocation of a record on import; it
+	// is well above the size of the largest serialized node.
+	exportMaxRecordSize = 1 << 16
+)
+
+var (
+	exportMagic      = [4]byte{'V', 'K', 'L', 'T'}
+	exportCRC32      = crc32.MakeTable(crc32.Castagnoli)
+	errInvalidExport = errors.New("invalid tree export")
+)
+
+type treeExporter struct {
+	w        io.Writer
+	checksum hash.Hash32
+	count    uint64
+	resolver NodeResolverFn
+}
+
+func (e *treeExporter) write(b []byte) error {
+	e.checksum.Write(b)
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *treeExporter) writeRecord(serialized []byte) error {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(len(serialized)))
+	if err := e.write(buf[:]); err != nil {
+		return err
+	}
+	if err := e.write(serialized); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(buf[:], crc32.Checksum(serialized, exportCRC32))
+	e.count++
+	return e.write(buf[:])
+}
+
+func (e *treeExporter) export(node VerkleNode, path []byte) error {
+	serialized, err := node.Serialize()
+	if err != nil {
+		return fmt.Errorf("serializing node at path %x: %w", path, err)
+	}
+	if err := e.writeRecord(serialized); err != nil {
+		return err
+	}
+
+	n, ok := node.(*InternalNode)
+	if !ok {
+		return nil
+	}
+	for i, child := range n.children {
+		childPath := append(path[:len(path):len(path)], byte(i))
+		switch child.(type) {
+		case Empty:
+			continue
+		case HashedNode:
+			// Resolve the child without keeping it in memory.
+			if e.resolver == nil {
+				return fmt.Errorf("hashed node at path %x could not be resolved: %w", childPath, errReadFromInvalid)
+			}
+			serialized, err := e.resolver(childPath)
+			if err != nil {
+				return fmt.Errorf("resolving node at path %x: %w", childPath, err)
+			}
+			if child, err = ParseNode(serialized, n.depth+1); err != nil {
+				return fmt.Errorf("parsing node at path %x: %w", childPath, err)
+			}
+		}
+		if err := e.export(child, childPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportTree writes the whole tree to w, in a format that ImportTree reads
+// back. Hashed nodes are resolved with resolver, but are not kept in the
+// tree. The root is committed first.
+func ExportTree(root VerkleNode, resolver NodeResolverFn, w io.Writer) error {
+	comm := root.Commit().Bytes()
+	bw := bufio.NewWriter(w)
+	e := &treeExporter{w: bw, checksum: crc32.New(exportCRC32), resolver: resolver}
+
+	header := make([]byte, 0, exportHeaderSize)
+	header = append(header, exportMagic[:]...)
+	header = append(header, exportVersion)
+	fingerprint := GetConfig().Fingerprint()
+	header = append(header, fingerprint[:]...)
+	header = append(header, comm[:]...)
+	if err := e.write(header); err != nil {
+		return err
+	}
+	if err := e.export(root, nil); err != nil {
+		return err
+	}
+
+	footer := make([]byte, 4, 16)
+	footer = binary.BigEndian.AppendUint64(footer, e.count)
+	if err := e.write(footer); err != nil {
+		return err
+	}
+	footer = binary.BigEndian.AppendUint32(nil, e.checksum.Sum32())
+	if _, err := bw.Write(footer); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+type treeImporter struct {
+	r        io.Reader
+	checksum hash.Hash32
+	count    uint64
+}
+
+func (im *treeImporter) read(b []byte) error {
+	if _, err := io.ReadFull(im.r, b); err != nil {
+		return err
+	}
+	im.checksum.Write(b)
+	return nil
+}
+
+// readRecord returns the next serialized node, or nil when the footer
+// has been reached.
+func (im *treeImporter) readRecord() ([]byte, error) {
+	var buf [4]byte
+	if err := im.read(buf[:]); err != nil {
+		return nil, fmt.Errorf("reading record length: %w", err)
+	}
+	size := binary.BigEndian.Uint32(buf[:])
+	if size == 0 {
+		return nil, nil
+	}
+	if size > exportMaxRecordSize {
+		return nil, fmt.Errorf("record #%d is too large: %d bytes: %w", im.count, size, errInvalidExport)
+	}
+	serialized := make([]byte, size)
+	if err := im.read(serialized); err != nil {
+		return nil, fmt.Errorf("reading record #%d: %w", im.count, err)
+	}
+	if err := im.read(buf[:]); err != nil {
+		return nil, fmt.Errorf("reading record #%d checksum: %w", im.count, err)
+	}
+	if binary.BigEndian.Uint32(buf[:]) != crc32.Checksum(serialized, exportCRC32) {
+		return nil, fmt.Errorf("record #%d checksum mismatch: %w", im.count, errInvalidExport)
+	}
+	im.count++
+	return serialized, nil
+}
+
+func (im *treeImporter) importNode(depth byte) (VerkleNode, error) {
+	serialized, err := im.readRecord()
+	if err != nil {
+		return nil, err
+	}
+	if serialized == nil {
+		return nil, fmt.Errorf("unexpected end of records: %w", errInvalidExport)
+	}
+	node, err := ParseNodeUnsafe(serialized, depth)
+	if err != nil {
+		return nil, fmt.Errorf("parsing record #%d: %w", im.count-1, err)
+	}
+
+	if n, ok := node.(*InternalNode); ok {
+		for i, child := range n.children {
+			if _, ok := child.(Empty); ok {
+				continue
+			}
+			if n.children[i], err = im.importNode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return node, nil
+}
+
+// ImportTree reads a tree written by ExportTree, and checks its integrity.
+// The whole tree is loaded in memory.
+func ImportTree(r io.Reader) (VerkleNode, error) {
+	im := &treeImporter{r: bufio.NewReader(r), checksum: crc32.New(exportCRC32)}
+
+	header := make([]byte, exportHeaderSize)
+	if err := im.read(header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if !bytes.Equal(header[:len(exportMagic)], exportMagic[:]) {
+		return nil, fmt.Errorf("invalid magic %x: %w", header[:len(exportMagic)], errInvalidExport)
+	}
+	if version := header[len(exportMagic)]; version != exportVersion {
+		return nil, fmt.Errorf("unsupported version %d: %w", version, errInvalidExport)
+	}
+	// Check the configuration before parsing any node, as commitments from
+	// another configuration would yield an invalid root.
+	if fingerprint := GetConfig().Fingerprint(); !bytes.Equal(header[exportFingerprint:exportFingerprint+32], fingerprint[:]) {
+		return nil, fmt.Errorf("exported with configuration %x, expected %x: %w", header[exportFingerprint:exportFingerprint+32], fingerprint, errInvalidExport)
+	}
+
+	root, err := im.importNode(0)
+	if err != nil {
+		return nil, err
+	}
+	if serialized, err := im.readRecord(); err != nil {
+		return nil, err
+	} else if serialized != nil {
+		return nil, fmt.Errorf("unexpected record after the tree: %w", errInvalidExport)
+	}
+
+	var buf [8]byte
+	if err := im.read(buf[:]); err != nil {
+		return nil, fmt.Errorf("reading node count: %w", err)
+	}
+	if count := binary.BigEndian.Uint64(buf[:]); count != im.count {
+		return nil, fmt.Errorf("invalid node count %d, read %d nodes: %w", count, im.count, errInvalidExport)
+	}
+	checksum := im.checksum.Sum32()
+	if _, err := io.ReadFull(im.r, buf[:4]); err != nil {
+		return nil, fmt.Errorf("reading checksum: %w", err)
+	}
+	if binary.BigEndian.Uint32(buf[:4]) != checksum {
+		return nil, fmt.Errorf("file checksum mismatch: %w", errInvalidExport)
+	}
+
+	comm := root.Commitment().Bytes()
+	if !bytes.Equal(comm[:], header[exportFingerprint+32:]) {
+		return nil, fmt.Errorf("root commitment %x doesn't match the header: %w", comm, errInvalidExport)
+	}
+	return root, nil
+}
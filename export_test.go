@@ -0,0 +1,80 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestExportImportTree(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 300)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+
+	// Flush the tree, so that the export has to resolve every node.
+	db := make(map[string][]byte)
+	root.(*InternalNode).Flush(func(path []byte, node VerkleNode) {
+		serialized, err := node.Serialize()
+		if err != nil {
+			t.Fatalf("error serializing node: %v", err)
+		}
+		db[string(path)] = serialized
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	var exported bytes.Buffer
+	if err := ExportTree(root, resolver, &exported); err != nil {
+		t.Fatalf("error exporting tree: %v", err)
+	}
+	if err := ExportTree(root, nil, &bytes.Buffer{}); !errors.Is(err, errReadFromInvalid) {
+		t.Fatalf("expected a resolution error, got %v", err)
+	}
+
+	imported, err := ImportTree(bytes.NewReader(exported.Bytes()))
+	if err != nil {
+		t.Fatalf("error importing tree: %v", err)
+	}
+	if !imported.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	for _, k := range keys {
+		v, err := imported.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting key %x: %v", k, err)
+		}
+		if !bytes.Equal(v, testValue) {
+			t.Fatalf("invalid value for key %x: %x", k, v)
+		}
+	}
+	var reexported bytes.Buffer
+	if err := ExportTree(imported, nil, &reexported); err != nil {
+		t.Fatalf("error exporting tree: %v", err)
+	}
+	if !bytes.Equal(reexported.Bytes(), exported.Bytes()) {
+		t.Fatal("export differs after a round trip")
+	}
+
+	// Corruptions are detected.
+	corrupted := bytes.Clone(exported.Bytes())
+	corrupted[exportHeaderSize+10] ^= 1
+	if _, err := ImportTree(bytes.NewReader(corrupted)); !errors.Is(err, errInvalidExport) {
+		t.Fatalf("expected an invalid export error, got %v", err)
+	}
+	otherConfig := bytes.Clone(exported.Bytes())
+	otherConfig[exportFingerprint] ^= 1
+	if _, err := ImportTree(bytes.NewReader(otherConfig)); !errors.Is(err, errInvalidExport) {
+		t.Fatalf("expected an invalid export error, got %v", err)
+	}
+	if _, err := ImportTree(bytes.NewReader(exported.Bytes()[:exported.Len()-1])); err == nil {
+		t.Fatal("expected an error importing a truncated export")
+	}
+}
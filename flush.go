@@ -0,0 +1,115 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "sync"
+
+// AsyncFlusher flushes trees to storage in the background. The nodes are
+// serialized by the goroutine calling Flush, which then moves on, and are
+// written by a background goroutine. The number of nodes waiting to be
+// written is bounded, and Flush blocks when that bound is reached, so that
+// a slow storage slows the producer down instead of filling the memory.
+type AsyncFlusher struct {
+	write func(path, serialized []byte) error
+	queue chan flushedNode
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+type flushedNode struct {
+	path, serialized []byte
+}
+
+// NewAsyncFlusher starts a background goroutine that writes the flushed
+// nodes with write, and lets at most queueSize of them wait to be written.
+func NewAsyncFlusher(write func(path, serialized []byte) error, queueSize int) *AsyncFlusher {
+	f := &AsyncFlusher{
+		write: write,
+		queue: make(chan flushedNode, queueSize),
+		done:  make(chan struct{}),
+	}
+	go f.loop()
+	return f
+}
+
+func (f *AsyncFlusher) loop() {
+	defer close(f.done)
+	for node := range f.queue {
+		// Keep draining the queue after an error, so that
+		// Flush doesn't block forever.
+		if f.Err() != nil {
+			continue
+		}
+		if err := f.write(node.path, node.serialized); err != nil {
+			f.setErr(err)
+		}
+	}
+}
+
+// Flush commits the tree, serializes its nodes and queues them for
+// writing, and replaces the flushed children with HashedNode, as
+// InternalNode.Flush does. It returns the first error encountered so far,
+// which might come from a previous call. Flush must not be called after
+// Close.
+func (f *AsyncFlusher) Flush(root *InternalNode) error {
+	root.Flush(func(path []byte, node VerkleNode) {
+		if f.Err() != nil {
+			return
+		}
+		serialized, err := node.Serialize()
+		if err != nil {
+			f.setErr(err)
+			return
+		}
+		f.queue <- flushedNode{path: append([]byte{}, path...), serialized: serialized}
+	})
+	return f.Err()
+}
+
+// Close waits for all the queued nodes to be written, stops the background
+// goroutine and returns the first error encountered.
+func (f *AsyncFlusher) Close() error {
+	close(f.queue)
+	<-f.done
+	return f.Err()
+}
+
+// Err returns the first error encountered, if any.
+func (f *AsyncFlusher) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *AsyncFlusher) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
@@ -0,0 +1,82 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestAsyncFlusher(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu sync.Mutex
+		db = map[string][]byte{}
+	)
+	resolver := func(path []byte) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return db[string(path)], nil
+	}
+	flusher := NewAsyncFlusher(func(path, serialized []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		db[string(path)] = serialized
+		return nil
+	}, 1)
+
+	keys := randomKeys(t, 100)
+	root := New().(*InternalNode)
+	// Flush one block while the next one is being processed.
+	for _, block := range [][][]byte{keys[:50], keys[50:]} {
+		for _, k := range block {
+			if err := root.Insert(k, k, resolver); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		if err := flusher.Flush(root); err != nil {
+			t.Fatalf("error flushing: %v", err)
+		}
+	}
+	if err := flusher.Close(); err != nil {
+		t.Fatalf("error closing flusher: %v", err)
+	}
+
+	stored, err := ParseNode(db[""], 0)
+	if err != nil {
+		t.Fatalf("error parsing root: %v", err)
+	}
+	if !stored.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid stored root commitment")
+	}
+	for _, k := range keys {
+		value, err := stored.Get(k, resolver)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", k, err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for %x: %x", k, value)
+		}
+	}
+}
+
+func TestAsyncFlusherError(t *testing.T) {
+	t.Parallel()
+
+	errWrite := errors.New("write error")
+	flusher := NewAsyncFlusher(func([]byte, []byte) error {
+		return errWrite
+	}, 1)
+	root := New().(*InternalNode)
+	for _, k := range randomKeys(t, 20) {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	// The queue is drained after an error, so this doesn't block.
+	_ = flusher.Flush(root)
+	if err := flusher.Close(); !errors.Is(err, errWrite) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+}
@@ -28,6 +28,7 @@ package verkle
 import (
 	"errors"
 	"fmt"
+	"io"
 )
 
 type HashedNode struct{}
@@ -66,6 +67,14 @@ func (HashedNode) Serialize() ([]byte, error) {
 	return nil, errSerializeHashedNode
 }
 
+func (HashedNode) SerializeTo(io.Writer) (int, error) {
+	return 0, errSerializeHashedNode
+}
+
+func (HashedNode) Size() int {
+	return 0
+}
+
 func (HashedNode) Copy() VerkleNode {
 	return HashedNode{}
 }
@@ -0,0 +1,131 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "sync"
+
+// CommitmentIndex maps the commitments of the in-memory nodes of a tree to
+// the nodes themselves, so that a node can be found from its hash without
+// walking the tree. The index is kept up to date by committing the tree
+// through it, which only visits the nodes that changed since the previous
+// commit. Nodes that are flushed or expired remain indexed until their
+// commitment changes or they are deleted.
+type CommitmentIndex struct {
+	mu    sync.RWMutex
+	nodes map[[32]byte]VerkleNode
+}
+
+// NewCommitmentIndex commits root and returns an index of all of its
+// in-memory nodes. Hashed nodes are not resolved.
+func NewCommitmentIndex(root *InternalNode) *CommitmentIndex {
+	idx := &CommitmentIndex{nodes: make(map[[32]byte]VerkleNode)}
+	root.Commit()
+	idx.addSubtree(root)
+	return idx
+}
+
+func (idx *CommitmentIndex) addSubtree(node VerkleNode) {
+	switch n := node.(type) {
+	case *InternalNode:
+		idx.nodes[n.commitment.Bytes()] = n
+		for _, child := range n.children {
+			idx.addSubtree(child)
+		}
+	case *LeafNode:
+		idx.nodes[n.commitment.Bytes()] = n
+	}
+}
+
+// removeSubtree unindexes a node that was deleted from the tree, as well
+// as its descendants. The children of a deleted internal node were
+// deleted before it, so they are found from the old commitments that it
+// still holds.
+func (idx *CommitmentIndex) removeSubtree(node VerkleNode) {
+	n, ok := node.(*InternalNode)
+	if !ok {
+		return
+	}
+	for _, old := range n.cow {
+		hash := old.Bytes()
+		idx.removeSubtree(idx.nodes[hash])
+		delete(idx.nodes, hash)
+	}
+}
+
+// Commit commits root, and updates the index with the nodes whose
+// commitment changed.
+func (idx *CommitmentIndex) Commit(root *InternalNode) *Point {
+	// The old commitments of the modified children are only known
+	// before the commit.
+	type change struct {
+		old  [32]byte
+		node VerkleNode
+	}
+	changes := []change{{root.commitment.Bytes(), root}}
+	var collect func(n *InternalNode)
+	collect = func(n *InternalNode) {
+		for i, old := range n.cow {
+			changes = append(changes, change{old.Bytes(), n.children[i]})
+			if child, ok := n.children[i].(*InternalNode); ok {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+
+	comm := root.Commit()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, c := range changes {
+		if _, ok := c.node.(Empty); ok {
+			idx.removeSubtree(idx.nodes[c.old])
+		}
+		delete(idx.nodes, c.old)
+	}
+	for _, c := range changes {
+		switch n := c.node.(type) {
+		case *InternalNode, *LeafNode:
+			idx.nodes[n.Commitment().Bytes()] = n
+		}
+	}
+	return comm
+}
+
+// Get returns the node whose commitment serializes to hash, or nil if
+// no such node is indexed.
+func (idx *CommitmentIndex) Get(hash [32]byte) VerkleNode {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.nodes[hash]
+}
+
+// Len returns the number of indexed nodes.
+func (idx *CommitmentIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.nodes)
+}
@@ -0,0 +1,68 @@
+package verkle
+
+import "testing"
+
+func TestCommitmentIndex(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeys(t, 200)
+	root := New().(*InternalNode)
+	for _, k := range keys[:100] {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	idx := NewCommitmentIndex(root)
+	oldRoot := root.Commitment().Bytes()
+	if idx.Get(oldRoot) != VerkleNode(root) {
+		t.Fatal("root isn't indexed")
+	}
+
+	for _, k := range keys[100:] {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	for _, k := range keys[:20] {
+		if _, err := root.Delete(k, nil); err != nil {
+			t.Fatalf("error deleting: %v", err)
+		}
+	}
+	comm := idx.Commit(root)
+	if idx.Get(oldRoot) != nil {
+		t.Fatal("the old root is still indexed")
+	}
+	if idx.Get(comm.Bytes()) != VerkleNode(root) {
+		t.Fatal("the new root isn't indexed")
+	}
+
+	// The index matches the one of a tree indexed from scratch.
+	expected := NewCommitmentIndex(root)
+	if idx.Len() != expected.Len() {
+		t.Fatalf("invalid number of indexed nodes: %d != %d", idx.Len(), expected.Len())
+	}
+	for hash, node := range expected.nodes {
+		if idx.Get(hash) != node {
+			t.Fatalf("node %x isn't indexed", hash)
+		}
+	}
+	for _, k := range keys[20:] {
+		values, err := root.GetValuesAtStem(KeyToStem(k), nil)
+		if err != nil {
+			t.Fatalf("error getting: %v", err)
+		}
+		leaf, ok := idx.Get(mustLeafCommitment(t, k, values)).(*LeafNode)
+		if !ok || !equalPaths(leaf.stem[:], k) {
+			t.Fatalf("leaf of key %x isn't indexed", k)
+		}
+	}
+}
+
+func mustLeafCommitment(t *testing.T, key []byte, values [][]byte) [32]byte {
+	t.Helper()
+	leaf, err := NewLeafNode(KeyToStem(key), values)
+	if err != nil {
+		t.Fatalf("error creating leaf: %v", err)
+	}
+	return leaf.commitment.Bytes()
+}
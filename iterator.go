@@ -0,0 +1,235 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Iterator walks the key-value pairs of a tree in key order. Hashed nodes
+// are resolved as the iterator reaches them, and are not stored in the
+// tree, so that walking a large tree doesn't load all of it in memory.
+// The tree must not be modified while it is being iterated.
+//
+//	it, err := NewIterator(root, resolver)
+//	...
+//	for it.Next() {
+//		use(it.Key(), it.Value())
+//	}
+//	if err := it.Error(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	resolver NodeResolverFn
+	root     *InternalNode
+	stack    []iteratorFrame
+	leaf     *LeafNode
+	suffix   int
+	start    []byte // lower bound set by Seek, cleared once reached
+	key      []byte
+	value    []byte
+	err      error
+}
+
+type iteratorFrame struct {
+	node *InternalNode
+	path []byte
+	next int // index of the next child to visit
+}
+
+// NewIterator returns an iterator positioned before the first key of the
+// tree.
+func NewIterator(root VerkleNode, resolver NodeResolverFn) (*Iterator, error) {
+	rootNode, ok := root.(*InternalNode)
+	if !ok {
+		return nil, errors.New("root must be an internal node")
+	}
+	it := &Iterator{resolver: resolver, root: rootNode}
+	it.Seek(nil)
+	return it, nil
+}
+
+// Seek positions the iterator before the first key that is greater than or
+// equal to start, which can be a prefix of a key.
+func (it *Iterator) Seek(start []byte) {
+	it.start = nil
+	if len(start) > 0 {
+		it.start = make([]byte, KeySize)
+		copy(it.start, start)
+	}
+	it.stack = it.stack[:0]
+	it.leaf, it.key, it.value, it.err = nil, nil, nil, nil
+	it.push(it.root, nil)
+}
+
+// push adds an internal node to the stack, skipping the children that are
+// below the lower bound.
+func (it *Iterator) push(node *InternalNode, path []byte) {
+	frame := iteratorFrame{node: node, path: path}
+	if it.start != nil && bytes.Equal(path, it.start[:len(path)]) {
+		frame.next = int(it.start[len(path)])
+	}
+	it.stack = append(it.stack, frame)
+}
+
+// Next advances the iterator to the next key-value pair, and reports
+// whether there is one.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	for {
+		if it.leaf != nil {
+			for it.suffix < NodeWidth {
+				suffix := it.suffix
+				it.suffix++
+				if it.leaf.values[suffix] == nil {
+					continue
+				}
+				key := append(it.leaf.stem[:StemSize:StemSize], byte(suffix))
+				if it.start != nil {
+					if bytes.Compare(key, it.start) < 0 {
+						continue
+					}
+					it.start = nil
+				}
+				it.key, it.value = key, it.leaf.values[suffix]
+				return true
+			}
+			it.leaf = nil
+		}
+
+		if len(it.stack) == 0 {
+			it.key, it.value = nil, nil
+			return false
+		}
+		top := &it.stack[len(it.stack)-1]
+		if top.next >= NodeWidth {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		idx := top.next
+		top.next++
+		childpath := append(top.path[:len(top.path):len(top.path)], byte(idx))
+		if it.start != nil && bytes.Compare(childpath, it.start[:len(childpath)]) < 0 {
+			continue
+		}
+
+		child := top.node.children[idx]
+		if _, ok := child.(HashedNode); ok {
+			if it.resolver == nil {
+				it.err = fmt.Errorf("no resolver for path %x", childpath)
+				return false
+			}
+			serialized, err := it.resolver(childpath)
+			if err != nil {
+				it.err = fmt.Errorf("error resolving for path %x: %w", childpath, err)
+				return false
+			}
+			if child, err = ParseNode(serialized, byte(len(childpath))); err != nil {
+				it.err = err
+				return false
+			}
+		}
+		switch child := child.(type) {
+		case *InternalNode:
+			it.push(child, childpath)
+		case *LeafNode:
+			it.leaf, it.suffix = child, 0
+		case Empty:
+		default:
+			it.err = fmt.Errorf("unexpected node of type %T at path %x", child, childpath)
+			return false
+		}
+	}
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Value returns the current value, which must not be modified.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Error returns the error that stopped the iteration, if any.
+func (it *Iterator) Error() error {
+	return it.err
+}
+
+// Range calls fn, in order, on every leaf whose stem is between start and
+// end, both included. Subtrees outside of the range aren't visited, and
+// hashed nodes are resolved without being stored in the tree. The walk
+// stops at the first error returned by fn.
+func (n *InternalNode) Range(start, end Stem, resolver NodeResolverFn, fn func(*LeafNode) error) error {
+	return n.rangeLeaves(nil, start, end, resolver, fn)
+}
+
+func (n *InternalNode) rangeLeaves(path []byte, start, end Stem, resolver NodeResolverFn, fn func(*LeafNode) error) error {
+	first, last := 0, NodeWidth-1
+	if bytes.Equal(path, start[:len(path)]) {
+		first = int(start[len(path)])
+	}
+	if bytes.Equal(path, end[:len(path)]) {
+		last = int(end[len(path)])
+	}
+	for idx := first; idx <= last; idx++ {
+		child := n.children[idx]
+		childpath := append(path[:len(path):len(path)], byte(idx))
+		if _, ok := child.(HashedNode); ok {
+			if resolver == nil {
+				return fmt.Errorf("no resolver for path %x", childpath)
+			}
+			serialized, err := resolver(childpath)
+			if err != nil {
+				return fmt.Errorf("error resolving for path %x: %w", childpath, err)
+			}
+			if child, err = ParseNode(serialized, n.depth+1); err != nil {
+				return err
+			}
+		}
+		switch child := child.(type) {
+		case *InternalNode:
+			if err := child.rangeLeaves(childpath, start, end, resolver, fn); err != nil {
+				return err
+			}
+		case *LeafNode:
+			if child.stem.Compare(start) >= 0 && child.stem.Compare(end) <= 0 {
+				if err := fn(child); err != nil {
+					return err
+				}
+			}
+		case Empty:
+		default:
+			return fmt.Errorf("unexpected node of type %T at path %x", child, childpath)
+		}
+	}
+	return nil
+}
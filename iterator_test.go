@@ -0,0 +1,137 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 300)
+	// Several values in the same leaf.
+	keys = append(keys, append(keys[0][:StemSize:StemSize], keys[0][StemSize]^0x80))
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	// Load the tree from its serialized nodes, so that the iterator has
+	// to resolve them.
+	serializedNodes, err := root.(*InternalNode).BatchSerialize()
+	if err != nil {
+		t.Fatalf("error serializing tree: %v", err)
+	}
+	db := make(map[string][]byte)
+	for _, sn := range serializedNodes {
+		db[string(sn.Path)] = sn.SerializedBytes
+	}
+	resolver := func(path []byte) ([]byte, error) { return db[string(path)], nil }
+	stateless, err := ParseNode(db[""], 0)
+	if err != nil {
+		t.Fatalf("error parsing root: %v", err)
+	}
+
+	for _, tree := range []VerkleNode{root, stateless} {
+		it, err := NewIterator(tree, resolver)
+		if err != nil {
+			t.Fatalf("error creating iterator: %v", err)
+		}
+		checkIterator(t, it, keys)
+
+		// Seek to an existing key, to a key between two keys, and to a
+		// prefix.
+		it.Seek(keys[100])
+		checkIterator(t, it, keys[100:])
+		between := append([]byte{}, keys[150]...)
+		for i := KeySize - 1; i >= 0; i-- {
+			if between[i]++; between[i] != 0 {
+				break
+			}
+		}
+		it.Seek(between)
+		checkIterator(t, it, keys[151:])
+		it.Seek(keys[200][:2])
+		first := sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], keys[200][:2]) >= 0 })
+		checkIterator(t, it, keys[first:])
+	}
+
+	// Resolved nodes must not be stored in the tree.
+	for i, c := range stateless.(*InternalNode).children {
+		if _, ok := c.(Empty); !ok {
+			if _, ok := c.(HashedNode); !ok {
+				t.Fatalf("child #%d was resolved in the tree: %T", i, c)
+			}
+		}
+	}
+}
+
+func checkIterator(t *testing.T, it *Iterator, keys [][]byte) {
+	t.Helper()
+
+	var i int
+	for ; it.Next(); i++ {
+		if i >= len(keys) {
+			t.Fatalf("unexpected key %x", it.Key())
+		}
+		if !bytes.Equal(it.Key(), keys[i]) {
+			t.Fatalf("invalid key #%d, got %x, expected %x", i, it.Key(), keys[i])
+		}
+		if !bytes.Equal(it.Value(), keys[i]) {
+			t.Fatalf("invalid value #%d, got %x, expected %x", i, it.Value(), keys[i])
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("iteration error: %v", err)
+	}
+	if i != len(keys) {
+		t.Fatalf("invalid number of keys, got %d, expected %d", i, len(keys))
+	}
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeysSorted(t, 300)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+
+	start, end := Stem(keys[40][:StemSize]), Stem(keys[250][:StemSize])
+	var stems []Stem
+	err := root.(*InternalNode).Range(start, end, nil, func(leaf *LeafNode) error {
+		stems = append(stems, leaf.stem)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error visiting range: %v", err)
+	}
+	if len(stems) != 211 {
+		t.Fatalf("invalid number of leaves, got %d, expected %d", len(stems), 211)
+	}
+	for i, stem := range stems {
+		if !bytes.Equal(stem[:], keys[40+i][:StemSize]) {
+			t.Fatalf("invalid stem #%d, got %x, expected %x", i, stem, keys[40+i][:StemSize])
+		}
+	}
+
+	// The walk stops at the first error.
+	errStop := errors.New("stop")
+	var visited int
+	err = root.(*InternalNode).Range(start, end, nil, func(*LeafNode) error {
+		visited++
+		return errStop
+	})
+	if err != errStop || visited != 1 {
+		t.Fatalf("invalid early stop, err=%v visited=%d", err, visited)
+	}
+}
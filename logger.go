@@ -0,0 +1,80 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "sync/atomic"
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// Logger receives the log messages of the package. The context of a
+// message is passed as alternating keys and values, so that it can be
+// forwarded to structured loggers such as log/slog.
+type Logger interface {
+	Enabled(level LogLevel) bool
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Enabled(LogLevel) bool                { return false }
+func (nopLogger) Log(LogLevel, string, ...interface{}) {}
+
+type loggerHolder struct{ Logger }
+
+var logger atomic.Pointer[loggerHolder]
+
+func init() {
+	logger.Store(&loggerHolder{nopLogger{}})
+}
+
+// SetLogger sets the logger of the package, which discards everything by
+// default. Passing nil restores the default.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger.Store(&loggerHolder{l})
+}
+
+// logEnabled must be checked before calling log on hot paths, so that
+// the arguments aren't built when the message would be discarded.
+func logEnabled(level LogLevel) bool {
+	return logger.Load().Enabled(level)
+}
+
+func log(level LogLevel, msg string, keyvals ...interface{}) {
+	if l := logger.Load(); l.Enabled(level) {
+		l.Log(level, msg, keyvals...)
+	}
+}
@@ -0,0 +1,45 @@
+package verkle
+
+import (
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Enabled(level LogLevel) bool { return true }
+
+func (l *recordingLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+// Not parallel, since it changes the package logger.
+func TestSetLogger(t *testing.T) {
+	l := &recordingLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+	root.(*InternalNode).Flush(func([]byte, VerkleNode) {})
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	seen := make(map[string]bool)
+	for _, msg := range l.messages {
+		seen[msg] = true
+	}
+	for _, msg := range []string{"committing internal nodes", "flushing internal node"} {
+		if !seen[msg] {
+			t.Fatalf("message %q wasn't logged, got %v", msg, l.messages)
+		}
+	}
+}
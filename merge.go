@@ -0,0 +1,141 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrMergeConflict is returned when two partial trees disagree about
+// the content of the tree.
+var ErrMergeConflict = errors.New("conflicting partial trees")
+
+// MergeStatelessTrees combines partial trees, typically rebuilt from
+// separate witnesses with PreStateTreeFromProof, into a single partial
+// tree. The trees must have the same root: nodes that are known in more
+// than one tree must agree on their commitments and values, and unknown
+// nodes are filled from whichever tree knows about them. The input trees
+// are left untouched.
+func MergeStatelessTrees(roots []VerkleNode) (VerkleNode, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("no tree to merge")
+	}
+	merged := roots[0].Copy()
+	for _, root := range roots[1:] {
+		var err error
+		if merged, err = mergeStateless(merged, root, nil); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// mergeStateless merges src into dst and returns the merged node. dst is
+// updated in place, and the parts of src that are used are copied.
+func mergeStateless(dst, src VerkleNode, path []byte) (VerkleNode, error) {
+	if _, ok := src.(UnknownNode); ok {
+		return dst, nil
+	}
+	if _, ok := dst.(UnknownNode); ok {
+		return src.Copy(), nil
+	}
+
+	switch d := dst.(type) {
+	case Empty:
+		if _, ok := src.(Empty); ok {
+			return dst, nil
+		}
+	case *InternalNode:
+		s, ok := src.(*InternalNode)
+		if !ok {
+			break
+		}
+		if !d.Commitment().Equal(s.Commitment()) {
+			return nil, fmt.Errorf("%w: different internal node commitments at path %x", ErrMergeConflict, path)
+		}
+		for i := range d.children {
+			child, err := mergeStateless(d.children[i], s.children[i], append(path[:len(path):len(path)], byte(i)))
+			if err != nil {
+				return nil, err
+			}
+			d.children[i] = child
+		}
+		return d, nil
+	case *LeafNode:
+		if s, ok := src.(*LeafNode); ok {
+			return mergeStatelessLeaves(d, s, path)
+		}
+	}
+	return nil, fmt.Errorf("%w: incompatible nodes %T and %T at path %x", ErrMergeConflict, dst, src, path)
+}
+
+func mergeStatelessLeaves(dst, src *LeafNode, path []byte) (*LeafNode, error) {
+	if dst.stem != src.stem || !dst.commitment.Equal(src.commitment) {
+		return nil, fmt.Errorf("%w: leaves %x and %x at path %x", ErrMergeConflict, dst.stem, src.stem, path)
+	}
+	if src.isPOAStub {
+		return dst, nil
+	}
+	if dst.isPOAStub {
+		return src.Copy().(*LeafNode), nil
+	}
+
+	for i, v := range src.values {
+		switch {
+		case v == nil:
+		case dst.values[i] == nil:
+			dst.values[i] = append([]byte{}, v...)
+		case !bytes.Equal(dst.values[i], v):
+			return nil, fmt.Errorf("%w: different values for key %x", ErrMergeConflict, dst.Key(i))
+		}
+	}
+	var err error
+	if dst.c1, err = mergeStatelessPoints(dst.c1, src.c1); err != nil {
+		return nil, fmt.Errorf("c1 of stem %x: %w", dst.stem, err)
+	}
+	if dst.c2, err = mergeStatelessPoints(dst.c2, src.c2); err != nil {
+		return nil, fmt.Errorf("c2 of stem %x: %w", dst.stem, err)
+	}
+	return dst, nil
+}
+
+// mergeStatelessPoints merges the c1 or c2 commitments of two versions
+// of a leaf. When rebuilding a tree from a proof, the commitments that
+// the proof doesn't open are set to the zero value of Point.
+func mergeStatelessPoints(dst, src *Point) (*Point, error) {
+	switch {
+	case src == nil || *src == (Point{}):
+		return dst, nil
+	case dst == nil || *dst == (Point{}):
+		return new(Point).Set(src), nil
+	case !dst.Equal(src):
+		return nil, ErrMergeConflict
+	default:
+		return dst, nil
+	}
+}
@@ -0,0 +1,70 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMergeStatelessTrees(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 50)
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	rootC := root.Commit()
+
+	partial := func(root VerkleNode, keys [][]byte) VerkleNode {
+		proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), nil)
+		if err != nil {
+			t.Fatalf("error creating proof: %v", err)
+		}
+		tree, err := PreStateTreeFromProof(proof, root.Commitment())
+		if err != nil {
+			t.Fatalf("error rebuilding tree: %v", err)
+		}
+		return tree
+	}
+	setA, setB := keys[:10], keys[5:20]
+	merged, err := MergeStatelessTrees([]VerkleNode{partial(root, setA), partial(root, setB)})
+	if err != nil {
+		t.Fatalf("error merging trees: %v", err)
+	}
+	if !merged.Commitment().Equal(rootC) {
+		t.Fatal("invalid merged root commitment")
+	}
+	for _, k := range keys[:20] {
+		value, err := merged.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", k, err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for %x: %x", k, value)
+		}
+	}
+
+	// A tree with a different root can't be merged.
+	other := New()
+	if err := other.Insert(keys[0], testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	other.Commit()
+	if _, err := MergeStatelessTrees([]VerkleNode{partial(root, setA), partial(other, keys[:1])}); !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("expected a merge conflict, got %v", err)
+	}
+
+	// Conflicting values are detected, even with agreeing commitments.
+	tampered := partial(root, setA)
+	leaf, err := tampered.(*InternalNode).GetValuesAtStem(KeyToStem(keys[5]), nil)
+	if err != nil {
+		t.Fatalf("error getting values: %v", err)
+	}
+	leaf[keys[5][StemSize]] = testValue
+	if _, err := MergeStatelessTrees([]VerkleNode{tampered, partial(root, setB)}); !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("expected a merge conflict, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+// zeroValue is written to the overlay of an OverlayTree to delete a key.
+var zeroValue [LeafValueSize]byte
+
+// OverlayTree is a tree made of a frozen base tree, and of an overlay tree
+// that receives all the writes. It is meant for the transition period
+// during which values are moved from the base to the overlay: reads look
+// into the overlay first, and fall back to the base for the keys that the
+// overlay doesn't have. The root commitment is that of the overlay.
+//
+// Deleting a key writes a zero value to the overlay, since removing the
+// key from the overlay would let its base value show through.
+type OverlayTree struct {
+	base, overlay                 VerkleNode
+	baseResolver, overlayResolver NodeResolverFn
+}
+
+// NewOverlayTree creates an OverlayTree that reads from base and writes
+// to overlay. Each resolver is used to resolve the hashed nodes of its
+// tree, and can be nil if that tree is fully in memory.
+func NewOverlayTree(base, overlay VerkleNode, baseResolver, overlayResolver NodeResolverFn) *OverlayTree {
+	return &OverlayTree{
+		base:            base,
+		overlay:         overlay,
+		baseResolver:    baseResolver,
+		overlayResolver: overlayResolver,
+	}
+}
+
+// Base returns the frozen base tree.
+func (t *OverlayTree) Base() VerkleNode {
+	return t.base
+}
+
+// Overlay returns the tree that receives the writes.
+func (t *OverlayTree) Overlay() VerkleNode {
+	return t.overlay
+}
+
+// Get returns the value of a key, as found in the overlay if it is
+// present there, and in the base otherwise.
+func (t *OverlayTree) Get(key []byte) ([]byte, error) {
+	value, err := t.overlay.Get(key, t.overlayResolver)
+	if err != nil || value != nil {
+		return value, err
+	}
+	return t.base.Get(key, t.baseResolver)
+}
+
+// Insert writes a value to the overlay.
+func (t *OverlayTree) Insert(key, value []byte) error {
+	return t.overlay.Insert(key, value, t.overlayResolver)
+}
+
+// Delete hides the value of a key by writing a zero value to the
+// overlay.
+func (t *OverlayTree) Delete(key []byte) error {
+	return t.overlay.Insert(key, zeroValue[:], t.overlayResolver)
+}
+
+// Commit computes the commitment of the overlay, which is the root
+// commitment of the whole tree.
+func (t *OverlayTree) Commit() *Point {
+	return t.overlay.Commit()
+}
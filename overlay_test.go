@@ -0,0 +1,54 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOverlayTree(t *testing.T) {
+	t.Parallel()
+
+	base := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest} {
+		if err := base.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	baseC := base.Commit().Bytes()
+
+	tree := NewOverlayTree(base, New(), nil, nil)
+	if err := tree.Insert(oneKeyTest, testValue); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := tree.Insert(ffx32KeyTest, testValue); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := tree.Delete(fourtyKeyTest); err != nil {
+		t.Fatalf("error deleting: %v", err)
+	}
+
+	for _, tc := range []struct {
+		key, value []byte
+	}{
+		{zeroKeyTest, zeroKeyTest},
+		{oneKeyTest, testValue},
+		{ffx32KeyTest, testValue},
+		{fourtyKeyTest, zeroValue[:]},
+		{forkOneKeyTest, nil},
+	} {
+		value, err := tree.Get(tc.key)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", tc.key, err)
+		}
+		if !bytes.Equal(value, tc.value) || (value == nil) != (tc.value == nil) {
+			t.Fatalf("invalid value for %x, got %x, expected %x", tc.key, value, tc.value)
+		}
+	}
+
+	if base.Commit().Bytes() != baseC {
+		t.Fatal("the base tree was modified")
+	}
+	if !tree.Commit().Equal(tree.Overlay().Commit()) {
+		t.Fatal("the root isn't the overlay commitment")
+	}
+}
@@ -0,0 +1,103 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"slices"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Prefetch resolves, ahead of time, all the hashed nodes along the paths
+// of the given keys, so that accessing them later doesn't stall on the
+// storage. The nodes are resolved in parallel, at most runtime.NumCPU() at
+// a time, so resolver must be safe for concurrent use. The tree must not
+// be accessed until Prefetch returns.
+func (n *InternalNode) Prefetch(keys [][]byte, resolver NodeResolverFn) error {
+	for _, key := range keys {
+		if len(key) < StemSize {
+			return fmt.Errorf("invalid key size: %d", len(key))
+		}
+	}
+	sorted := slices.Clone(keys)
+	slices.SortFunc(sorted, bytes.Compare)
+
+	var (
+		group errgroup.Group
+		sem   = make(chan struct{}, runtime.NumCPU())
+	)
+	n.prefetch(&group, sem, sorted, resolver)
+	return group.Wait()
+}
+
+// prefetch resolves the hashed nodes along the paths of the keys, which
+// are sorted and all go through n. Each hashed child is resolved in its
+// own goroutine, which then takes care of the subtree below it.
+func (n *InternalNode) prefetch(group *errgroup.Group, sem chan struct{}, keys [][]byte, resolver NodeResolverFn) {
+	for start := 0; start < len(keys); {
+		idx := keys[start][n.depth]
+		end := start + 1
+		for end < len(keys) && keys[end][n.depth] == idx {
+			end++
+		}
+		subset := keys[start:end]
+		start = end
+
+		switch child := n.children[idx].(type) {
+		case *InternalNode:
+			child.prefetch(group, sem, subset, resolver)
+		case HashedNode:
+			if resolver == nil {
+				group.Go(func() error {
+					return fmt.Errorf("hashed node at path %x could not be resolved: %w", subset[0][:n.depth+1], errReadFromInvalid)
+				})
+				continue
+			}
+			group.Go(func() error {
+				path := subset[0][:n.depth+1]
+				sem <- struct{}{}
+				serialized, err := resolver(path)
+				if err != nil {
+					<-sem
+					return fmt.Errorf("resolving node at path %x: %w", path, err)
+				}
+				resolved, err := ParseNode(serialized, n.depth+1)
+				<-sem
+				if err != nil {
+					return fmt.Errorf("parsing node at path %x: %w", path, err)
+				}
+				n.children[idx] = resolved
+				if internal, ok := resolved.(*InternalNode); ok {
+					internal.prefetch(group, sem, subset, resolver)
+				}
+				return nil
+			})
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+
+	root := New().(*InternalNode)
+	keys := randomKeys(t, 200)
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	db := map[string][]byte{}
+	root.Flush(func(path []byte, node VerkleNode) {
+		serialized, err := node.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = serialized
+	})
+	var resolved atomic.Int32
+	resolver := func(path []byte) ([]byte, error) {
+		resolved.Add(1)
+		return db[string(path)], nil
+	}
+
+	if err := root.Prefetch(keys[:50], resolver); err != nil {
+		t.Fatalf("error prefetching: %v", err)
+	}
+	if resolved.Load() == 0 {
+		t.Fatal("no node was resolved")
+	}
+	// All the prefetched keys can now be read without a resolver.
+	for _, k := range keys[:50] {
+		value, err := root.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", k, err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for %x: %x", k, value)
+		}
+	}
+
+	errResolve := errors.New("resolver error")
+	err := root.Prefetch(keys[50:], func([]byte) ([]byte, error) {
+		return nil, errResolve
+	})
+	if !errors.Is(err, errResolve) {
+		t.Fatalf("expected the resolver error, got %v", err)
+	}
+}
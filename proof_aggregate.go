@@ -0,0 +1,143 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+
+	ipa "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// AggregatedProof proves the pre-state values of several consecutive blocks
+// with a single multipoint opening. Each block keeps its own commitments,
+// extension statuses and values, but an opening that several blocks share
+// is only proven once.
+type AggregatedProof struct {
+	Multipoint *ipa.MultiProof // multipoint argument for all the blocks
+	Proofs     []*Proof        // per-block proofs, without their multipoint argument
+}
+
+// MakeAggregatedMultiProof builds an aggregated proof of the values of keys[i]
+// in the tree preroots[i], for each block i.
+func MakeAggregatedMultiProof(preroots []VerkleNode, keys [][][]byte, resolver NodeResolverFn) (*AggregatedProof, error) {
+	return defaultProofDomain.MakeAggregatedMultiProof(preroots, keys, resolver)
+}
+
+// MakeAggregatedMultiProof is like the MakeAggregatedMultiProof function,
+// in the domain d.
+func (d *ProofDomain) MakeAggregatedMultiProof(preroots []VerkleNode, keys [][][]byte, resolver NodeResolverFn) (*AggregatedProof, error) {
+	if len(preroots) != len(keys) {
+		return nil, fmt.Errorf("incompatible number of trees and key sets: %d != %d", len(preroots), len(keys))
+	}
+	if len(preroots) == 0 {
+		return nil, errors.New("no tree provided for proof")
+	}
+
+	var (
+		agg    = &ProofElements{}
+		seen   = map[aggregatedOpening]struct{}{}
+		proofs = make([]*Proof, len(preroots))
+	)
+	for i, preroot := range preroots {
+		pe, es, poas, postvals, err := getProofElementsFromTree(preroot, nil, keys[i], resolver)
+		if err != nil {
+			return nil, fmt.Errorf("get commitments for block #%d: %w", i, err)
+		}
+		proofs[i] = newProofFromElements(pe, es, poas, keys[i], postvals)
+		appendUniqueOpenings(agg, seen, pe)
+	}
+
+	mpArg, err := ipa.CreateMultiProof(d.newTranscript(), GetConfig().conf, copyPoints(agg.Cis), agg.Fis, agg.Zis)
+	if err != nil {
+		return nil, fmt.Errorf("creating multiproof: %w", err)
+	}
+	return &AggregatedProof{Multipoint: mpArg, Proofs: proofs}, nil
+}
+
+// VerifyAggregatedProof checks an aggregated proof against the pre-state
+// root commitment of each block.
+func VerifyAggregatedProof(ap *AggregatedProof, roots []*Point) error {
+	return defaultProofDomain.VerifyAggregatedProof(ap, roots)
+}
+
+// VerifyAggregatedProof is like the VerifyAggregatedProof function, in the
+// domain d.
+func (d *ProofDomain) VerifyAggregatedProof(ap *AggregatedProof, roots []*Point) error {
+	if len(ap.Proofs) != len(roots) {
+		return fmt.Errorf("incompatible number of proofs and roots: %d != %d", len(ap.Proofs), len(roots))
+	}
+
+	var (
+		agg  = &ProofElements{}
+		seen = map[aggregatedOpening]struct{}{}
+	)
+	for i, proof := range ap.Proofs {
+		pretree, err := PreStateTreeFromProof(proof, roots[i])
+		if err != nil {
+			return fmt.Errorf("error rebuilding the pre-tree of block #%d: %w", i, err)
+		}
+		pe, _, _, _, err := getProofElementsFromTree(pretree, nil, proof.Keys, nil)
+		if err != nil {
+			return fmt.Errorf("error getting proof elements of block #%d: %w", i, err)
+		}
+		appendUniqueOpenings(agg, seen, pe)
+	}
+
+	ok, err := ipa.CheckMultiProof(d.newTranscript(), GetConfig().conf, ap.Multipoint, agg.Cis, agg.Yis, agg.Zis)
+	if !ok || err != nil {
+		return fmt.Errorf("error verifying proof: verifies=%v, error=%w", ok, err)
+	}
+	return nil
+}
+
+// aggregatedOpening identifies the opening of a commitment at a point.
+// Trees of different blocks don't share their *Point, so unlike in
+// ProofElements.Merge, openings are compared by value.
+type aggregatedOpening struct {
+	commitment [banderwagon.CompressedSize]byte
+	z          byte
+}
+
+// appendUniqueOpenings appends to dst the openings of src that haven't been
+// seen yet.
+func appendUniqueOpenings(dst *ProofElements, seen map[aggregatedOpening]struct{}, src *ProofElements) {
+	commitments := banderwagon.ElementsToBytes(src.Cis...)
+	for i := range src.Cis {
+		key := aggregatedOpening{commitment: commitments[i], z: src.Zis[i]}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		dst.Cis = append(dst.Cis, src.Cis[i])
+		dst.Zis = append(dst.Zis, src.Zis[i])
+		dst.Yis = append(dst.Yis, src.Yis[i])
+		if src.Fis != nil {
+			dst.Fis = append(dst.Fis, src.Fis[i])
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package verkle
+
+import "testing"
+
+func TestAggregatedMultiProof(t *testing.T) {
+	t.Parallel()
+
+	block1 := New()
+	keys := randomKeys(t, 50)
+	for _, k := range keys {
+		if err := block1.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	block1.Commit()
+	block2 := block1.Copy()
+	if err := block2.Insert(keys[0], fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	block2.Commit()
+
+	keys1 := [][]byte{keys[0], keys[1], keys[2]}
+	keys2 := [][]byte{keys[0], keys[1], zeroKeyTest}
+	ap, err := MakeAggregatedMultiProof([]VerkleNode{block1, block2}, [][][]byte{keys1, keys2}, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	roots := []*Point{block1.Commitment(), block2.Commitment()}
+	if err := VerifyAggregatedProof(ap, roots); err != nil {
+		t.Fatalf("error verifying proof: %v", err)
+	}
+
+	// The openings of keys[1] are the same in both blocks below the root,
+	// so the aggregated proof must open fewer commitments than two proofs.
+	var (
+		separate int
+		agg      = &ProofElements{}
+		seen     = map[aggregatedOpening]struct{}{}
+	)
+	for i, block := range []VerkleNode{block1, block2} {
+		pe, _, _, _, err := getProofElementsFromTree(block, nil, [][][]byte{keys1, keys2}[i], nil)
+		if err != nil {
+			t.Fatalf("error getting proof elements: %v", err)
+		}
+		separate += len(pe.Cis)
+		appendUniqueOpenings(agg, seen, pe)
+	}
+	if len(agg.Cis) >= separate {
+		t.Fatalf("openings weren't deduplicated: %d >= %d", len(agg.Cis), separate)
+	}
+
+	// A tampered value must be rejected.
+	value := ap.Proofs[1].PreValues[0]
+	ap.Proofs[1].PreValues[0] = zeroKeyTest
+	if err := VerifyAggregatedProof(ap, roots); err == nil {
+		t.Fatal("proof verified with an invalid value")
+	}
+	ap.Proofs[1].PreValues[0] = value
+
+	// So must swapped roots.
+	if err := VerifyAggregatedProof(ap, []*Point{roots[1], roots[0]}); err == nil {
+		t.Fatal("proof verified against the wrong roots")
+	}
+}
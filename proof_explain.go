@@ -0,0 +1,87 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import "fmt"
+
+// ProofMismatch describes the first opening of a proof that differs from
+// the one expected from a reference tree.
+type ProofMismatch struct {
+	Index  int    // index of the opening in the multipoint argument
+	Path   []byte // path of the opened commitment in the tree
+	Z      byte   // evaluation point
+	Reason string
+}
+
+func (m *ProofMismatch) Error() string {
+	return fmt.Sprintf("proof opening #%d at path %x, z=%d: %s", m.Index, m.Path, m.Z, m.Reason)
+}
+
+// ExplainProof verifies proof against root, and if it is invalid, compares
+// the openings that the proof implies with those of a reference tree that
+// has the same root, to report the first commitment, evaluation point and
+// path that diverge as a *ProofMismatch. It returns nil if the proof is
+// valid.
+func ExplainProof(proof *Proof, root *Point, reference VerkleNode, resolver NodeResolverFn) error {
+	pretree, err := PreStateTreeFromProof(proof, root)
+	if err != nil {
+		return fmt.Errorf("error rebuilding the pre-tree from proof: %w", err)
+	}
+	got, _, _, _, err := getProofElementsFromTree(pretree, nil, append([][]byte{}, proof.Keys...), nil)
+	if err != nil {
+		return fmt.Errorf("error getting proof elements: %w", err)
+	}
+	if ok, err := verifyVerkleProof(proof, got.Cis, got.Zis, got.Yis, GetConfig()); ok && err == nil {
+		return nil
+	}
+
+	want, _, _, _, err := getProofElementsFromTree(reference, nil, append([][]byte{}, proof.Keys...), resolver)
+	if err != nil {
+		return fmt.Errorf("error getting reference proof elements: %w", err)
+	}
+	paths := make(map[*Point]string, len(got.ByPath))
+	for path, c := range got.ByPath {
+		paths[c] = path
+	}
+	for i := 0; i < len(got.Cis) && i < len(want.Cis); i++ {
+		mismatch := &ProofMismatch{Index: i, Path: []byte(paths[got.Cis[i]]), Z: got.Zis[i]}
+		switch {
+		case !got.Cis[i].Equal(want.Cis[i]):
+			mismatch.Reason = "commitment differs from the reference"
+		case got.Zis[i] != want.Zis[i]:
+			mismatch.Reason = fmt.Sprintf("evaluation point differs from the reference z=%d", want.Zis[i])
+		case !got.Yis[i].Equal(want.Yis[i]):
+			mismatch.Reason = "evaluation differs from the reference"
+		default:
+			continue
+		}
+		return mismatch
+	}
+	if len(got.Cis) != len(want.Cis) {
+		return fmt.Errorf("proof has %d openings, the reference has %d", len(got.Cis), len(want.Cis))
+	}
+	return fmt.Errorf("all %d openings match the reference, the multipoint argument is invalid", len(got.Cis))
+}
@@ -0,0 +1,38 @@
+package verkle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExplainProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(k, fourtyKeyTest, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	rootC := root.Commit()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, ffx32KeyTest}, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	if err := ExplainProof(proof, rootC, root, nil); err != nil {
+		t.Fatalf("valid proof reported as invalid: %v", err)
+	}
+
+	// Change the proven value of ffx32KeyTest.
+	proof.PreValues[1] = zeroKeyTest
+	err = ExplainProof(proof, rootC, root, nil)
+	var mismatch *ProofMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("invalid error, got %v, expected a mismatch", err)
+	}
+	// The lower half of the value is the evaluation of C2 at 2*(255-128).
+	if mismatch.Reason != "evaluation differs from the reference" || mismatch.Z != 254 {
+		t.Fatalf("invalid mismatch: %v", mismatch)
+	}
+}
@@ -38,6 +38,40 @@ import (
 
 const IPA_PROOF_DEPTH = 8
 
+// DefaultTranscriptLabel is the domain separator of the Fiat-Shamir
+// transcript of multiproofs, as used by Ethereum.
+const DefaultTranscriptLabel = "vt"
+
+// ProofDomain creates and verifies multiproofs whose Fiat-Shamir transcript
+// starts with its label, so that deployments outside of Ethereum produce
+// proofs that can't be replayed in another domain. Proofs only verify in
+// the domain they were created in. Domains are immutable, so that several
+// of them can be used side by side. The package-level proof functions use
+// the domain of DefaultTranscriptLabel.
+type ProofDomain struct {
+	label string
+}
+
+var defaultProofDomain = NewProofDomain(DefaultTranscriptLabel)
+
+// NewProofDomain returns the domain of the given transcript label. An empty
+// label is that of DefaultTranscriptLabel.
+func NewProofDomain(label string) *ProofDomain {
+	if label == "" {
+		label = DefaultTranscriptLabel
+	}
+	return &ProofDomain{label: label}
+}
+
+// Label returns the transcript label of the domain.
+func (d *ProofDomain) Label() string {
+	return d.label
+}
+
+func (d *ProofDomain) newTranscript() *common.Transcript {
+	return common.NewTranscript(d.label)
+}
+
 type IPAProof struct {
 	CL              [IPA_PROOF_DEPTH][32]byte `json:"cl"`
 	CR              [IPA_PROOF_DEPTH][32]byte `json:"cr"`
@@ -227,18 +261,32 @@ func getProofElementsFromTree(preroot, postroot VerkleNode, keys [][]byte, resol
 }
 
 func MakeVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver NodeResolverFn) (*Proof, []*Point, []byte, []*Fr, error) {
+	return defaultProofDomain.MakeVerkleMultiProof(preroot, postroot, keys, resolver)
+}
+
+// MakeVerkleMultiProof is like the MakeVerkleMultiProof function, in the
+// domain d.
+func (d *ProofDomain) MakeVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver NodeResolverFn) (*Proof, []*Point, []byte, []*Fr, error) {
 	pe, es, poas, postvals, err := getProofElementsFromTree(preroot, postroot, keys, resolver)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("get commitments for multiproof: %s", err)
 	}
 
 	cfg := GetConfig()
-	tr := common.NewTranscript("vt")
-	mpArg, err := ipa.CreateMultiProof(tr, cfg.conf, pe.Cis, pe.Fis, pe.Zis)
+	tr := d.newTranscript()
+	mpArg, err := ipa.CreateMultiProof(tr, cfg.conf, copyPoints(pe.Cis), pe.Fis, pe.Zis)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("creating multiproof: %w", err)
 	}
 
+	proof := newProofFromElements(pe, es, poas, keys, postvals)
+	proof.Multipoint = mpArg
+	return proof, pe.Cis, pe.Zis, pe.Yis, nil
+}
+
+// newProofFromElements builds a proof, without its multipoint argument, out
+// of the proof elements gathered from the tree.
+func newProofFromElements(pe *ProofElements, es []byte, poas []Stem, keys [][]byte, postvals [][]byte) *Proof {
 	// It's wheel-reinvention time again 🎉: reimplement a basic
 	// feature that should be part of the stdlib.
 	// "But golang is a high-productivity language!!!" 🤪
@@ -256,8 +304,7 @@ func MakeVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver
 		cis[i] = pe.ByPath[path]
 	}
 
-	proof := &Proof{
-		Multipoint: mpArg,
+	return &Proof{
 		Cs:         cis,
 		ExtStatus:  es,
 		PoaStems:   poas,
@@ -265,26 +312,112 @@ func MakeVerkleMultiProof(preroot, postroot VerkleNode, keys [][]byte, resolver
 		PreValues:  pe.Vals,
 		PostValues: postvals,
 	}
-	return proof, pe.Cis, pe.Zis, pe.Yis, nil
 }
 
 // verifyVerkleProofWithPreState takes a proof and a trusted tree root and verifies that the proof is valid.
 func verifyVerkleProofWithPreState(proof *Proof, preroot VerkleNode) error {
+	return defaultProofDomain.verifyWithPreState(proof, preroot)
+}
+
+func (d *ProofDomain) verifyWithPreState(proof *Proof, preroot VerkleNode) error {
 	pe, _, _, _, err := getProofElementsFromTree(preroot, nil, proof.Keys, nil)
 	if err != nil {
 		return fmt.Errorf("error getting proof elements: %w", err)
 	}
 
-	if ok, err := verifyVerkleProof(proof, pe.Cis, pe.Zis, pe.Yis, GetConfig()); !ok || err != nil {
+	if ok, err := d.verifyMultipoint(proof, pe.Cis, pe.Zis, pe.Yis, GetConfig()); !ok || err != nil {
 		return fmt.Errorf("error verifying proof: verifies=%v, error=%w", ok, err)
 	}
 
 	return nil
 }
 
+// VerifyVerkleProof checks that proof opens the tree whose root commitment is
+// root to the given values at the given keys, a nil value meaning that the
+// key is absent. Keys may be given in any order. Only the proof is needed:
+// the relevant part of the tree is rebuilt from it before checking the
+// multipoint opening.
+func VerifyVerkleProof(proof *Proof, keys, values [][]byte, root *Point) error {
+	return defaultProofDomain.VerifyVerkleProof(proof, keys, values, root)
+}
+
+// VerifyVerkleProof is like the VerifyVerkleProof function, in the domain d.
+func (d *ProofDomain) VerifyVerkleProof(proof *Proof, keys, values [][]byte, root *Point) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("key and value counts differ: %d != %d", len(keys), len(values))
+	}
+	// The tree is rebuilt stem by stem, in the order of the extension
+	// statuses, so the keys have to be sorted.
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return bytes.Compare(keys[order[i]], keys[order[j]]) < 0 })
+	p := *proof
+	p.Keys = make([][]byte, len(keys))
+	p.PreValues = make([][]byte, len(keys))
+	p.PostValues = make([][]byte, len(keys))
+	for i, idx := range order {
+		p.Keys[i], p.PreValues[i] = keys[idx], values[idx]
+	}
+	pretree, err := PreStateTreeFromProof(&p, root)
+	if err != nil {
+		return fmt.Errorf("error rebuilding the pre-tree from proof: %w", err)
+	}
+	return d.verifyWithPreState(&p, pretree)
+}
+
+// VerifyAndExtract verifies the proof against the root commitment, like
+// VerifyVerkleProof, and returns the proven values by key, as well as the
+// set of keys proven to be absent.
+func VerifyAndExtract(proof *Proof, root *Point) (map[[KeySize]byte][]byte, map[[KeySize]byte]struct{}, error) {
+	return defaultProofDomain.VerifyAndExtract(proof, root)
+}
+
+// VerifyAndExtract is like the VerifyAndExtract function, in the domain d.
+func (d *ProofDomain) VerifyAndExtract(proof *Proof, root *Point) (map[[KeySize]byte][]byte, map[[KeySize]byte]struct{}, error) {
+	if len(proof.Keys) != len(proof.PreValues) {
+		return nil, nil, fmt.Errorf("incompatible number of keys and pre-values: %d != %d", len(proof.Keys), len(proof.PreValues))
+	}
+	if err := d.VerifyVerkleProof(proof, proof.Keys, proof.PreValues, root); err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[[KeySize]byte][]byte)
+	absent := make(map[[KeySize]byte]struct{})
+	for i, k := range proof.Keys {
+		if len(k) != KeySize {
+			return nil, nil, fmt.Errorf("invalid key size %d", len(k))
+		}
+		key := [KeySize]byte(k)
+		if len(proof.PreValues[i]) == 0 {
+			absent[key] = struct{}{}
+		} else {
+			values[key] = proof.PreValues[i]
+		}
+	}
+	return values, absent, nil
+}
+
 func verifyVerkleProof(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr, tc *Config) (bool, error) {
-	tr := common.NewTranscript("vt")
-	return ipa.CheckMultiProof(tr, tc.conf, proof.Multipoint, Cs, ys, indices)
+	return defaultProofDomain.verifyMultipoint(proof, Cs, indices, ys, tc)
+}
+
+func (d *ProofDomain) verifyMultipoint(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr, tc *Config) (bool, error) {
+	tr := d.newTranscript()
+	return ipa.CheckMultiProof(tr, tc.conf, proof.Multipoint, copyPoints(Cs), ys, indices)
+}
+
+// copyPoints returns a copy of a list of commitments. The multiproof code
+// normalizes the commitments it is given in place, and those of the proof
+// elements belong to the nodes of the tree, which might be read
+// concurrently.
+func copyPoints(points []*Point) []*Point {
+	copied := make([]*Point, len(points))
+	for i, p := range points {
+		copied[i] = new(Point).Set(p)
+	}
+	return copied
 }
 
 // SerializeProof serializes the proof in the rust-verkle format:
@@ -296,7 +429,7 @@ func verifyVerkleProof(proof *Proof, Cs []*Point, indices []uint8, ys []*Fr, tc
 func SerializeProof(proof *Proof) (*VerkleProof, StateDiff, error) {
 	otherstems := make([][StemSize]byte, len(proof.PoaStems))
 	for i, stem := range proof.PoaStems {
-		copy(otherstems[i][:], stem)
+		copy(otherstems[i][:], stem[:])
 	}
 
 	cbp := make([][32]byte, len(proof.Cs))
@@ -318,10 +451,10 @@ func SerializeProof(proof *Proof) (*VerkleProof, StateDiff, error) {
 	var statediff StateDiff
 	for i, key := range proof.Keys {
 		stem := KeyToStem(key)
-		if stemdiff == nil || !bytes.Equal(stemdiff.Stem[:], stem) {
+		if stemdiff == nil || !bytes.Equal(stemdiff.Stem[:], stem[:]) {
 			statediff = append(statediff, StemStateDiff{})
 			stemdiff = &statediff[len(statediff)-1]
-			copy(stemdiff.Stem[:], stem)
+			copy(stemdiff.Stem[:], stem[:])
 		}
 		stemdiff.SuffixDiffs = append(stemdiff.SuffixDiffs, SuffixStateDiff{Suffix: key[StemSize]})
 		newsd := &stemdiff.SuffixDiffs[len(stemdiff.SuffixDiffs)-1]
@@ -379,8 +512,7 @@ func DeserializeProof(vp *VerkleProof, statediff StateDiff) (*Proof, error) {
 
 	poaStems = make([]Stem, len(vp.OtherStems))
 	for i, poaStem := range vp.OtherStems {
-		poaStems[i] = make([]byte, len(poaStem))
-		copy(poaStems[i], poaStem[:])
+		poaStems[i] = poaStem
 	}
 
 	extStatus = vp.DepthExtensionPresent
@@ -463,8 +595,8 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 	stems := make([][]byte, 0, len(proof.Keys))
 	for _, k := range proof.Keys {
 		stem := KeyToStem(k)
-		if len(stems) == 0 || !bytes.Equal(stems[len(stems)-1], stem) {
-			stems = append(stems, stem)
+		if len(stems) == 0 || !bytes.Equal(stems[len(stems)-1], stem[:]) {
+			stems = append(stems, stem[:])
 		}
 	}
 	if len(stems) != len(proof.ExtStatus) {
@@ -532,13 +664,13 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 				continue
 			}
 
-			si.stem = poas[0]
+			si.stem = poas[0][:]
 			poas = poas[1:]
 		case extStatusPresent:
 			si.values = map[byte][]byte{}
 			si.stem = stems[i]
 			for j, k := range proof.Keys { // TODO: DoS risk, use map or binary search.
-				if bytes.Equal(KeyToStem(k), si.stem) {
+				if bytes.Equal(k[:StemSize], si.stem) {
 					si.values[k[StemSize]] = proof.PreValues[j]
 					si.has_c1 = si.has_c1 || (k[StemSize] < 128)
 					si.has_c2 = si.has_c2 || (k[StemSize] >= 128)
@@ -570,7 +702,7 @@ func PreStateTreeFromProof(proof *Proof, rootC *Point) (VerkleNode, error) { //
 				continue
 			}
 
-			if bytes.Equal(KeyToStem(k), info[string(p)].stem) {
+			if bytes.Equal(k[:StemSize], info[string(p)].stem) {
 				values[k[StemSize]] = proof.PreValues[i]
 			}
 		}
@@ -604,9 +736,7 @@ func PostStateTreeFromStateDiff(preroot VerkleNode, statediff StateDiff) (Verkle
 		}
 
 		if overwrites {
-			var stem [StemSize]byte
-			copy(stem[:StemSize], stemstatediff.Stem[:])
-			if err := postroot.(*InternalNode).InsertValuesAtStem(stem[:], values, nil); err != nil {
+			if err := postroot.(*InternalNode).InsertValuesAtStem(stemstatediff.Stem, values, nil); err != nil {
 				return nil, fmt.Errorf("error overwriting value in post state: %w", err)
 			}
 		}
@@ -619,12 +749,16 @@ func PostStateTreeFromStateDiff(preroot VerkleNode, statediff StateDiff) (Verkle
 type bytesSlice []Stem
 
 func (x bytesSlice) Len() int           { return len(x) }
-func (x bytesSlice) Less(i, j int) bool { return bytes.Compare(x[i], x[j]) < 0 }
+func (x bytesSlice) Less(i, j int) bool { return x[i].Compare(x[j]) < 0 }
 func (x bytesSlice) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
 
 // Verify is the API function that verifies a verkle proofs as found in a block/execution payload.
 func Verify(vp *VerkleProof, preStateRoot []byte, postStateRoot []byte, statediff StateDiff) error {
+	return defaultProofDomain.Verify(vp, preStateRoot, postStateRoot, statediff)
+}
 
+// Verify is like the Verify function, in the domain d.
+func (d *ProofDomain) Verify(vp *VerkleProof, preStateRoot []byte, postStateRoot []byte, statediff StateDiff) error {
 	proof, err := DeserializeProof(vp, statediff)
 	if err != nil {
 		return fmt.Errorf("verkle proof deserialization error: %w", err)
@@ -675,5 +809,5 @@ func Verify(vp *VerkleProof, preStateRoot []byte, postStateRoot []byte, statedif
 		return fmt.Errorf("post tree root mismatch: %x != %x", regeneratedPostTreeRoot, postStateRoot)
 	}
 
-	return verifyVerkleProofWithPreState(proof, pretree)
+	return d.verifyWithPreState(proof, pretree)
 }
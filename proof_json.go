@@ -29,6 +29,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // HexToPrefixedString turns a byte slice into its hex representation
@@ -39,10 +40,7 @@ func HexToPrefixedString(data []byte) string {
 
 // PrefixedHexStringToBytes does the opposite of HexToPrefixedString.
 func PrefixedHexStringToBytes(input string) ([]byte, error) {
-	if input[0:2] == "0x" {
-		input = input[2:]
-	}
-	return hex.DecodeString(input)
+	return hex.DecodeString(strings.TrimPrefix(input, "0x"))
 }
 
 type ipaproofMarshaller struct {
@@ -22,3 +22,17 @@ func TestJSONDeserialization(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPrefixedHexStringToBytes(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"", "0x", "0"} {
+		if _, err := PrefixedHexStringToBytes(input); input == "0" && err == nil {
+			t.Fatalf("expected an error decoding %q", input)
+		}
+	}
+	var stemdiff StemStateDiff
+	if err := json.Unmarshal([]byte(`{"stem": "", "suffixDiffs": []}`), &stemdiff); err != nil {
+		t.Fatalf("error decoding empty stem: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var errIncompleteRange = errors.New("stem range proof is incomplete")
+
+// MakeStemRangeProof proves all the keys of all the stems between start and
+// end, both included. Besides the values, the proof opens every subtree
+// that intersects the range, so that a verifier can check with
+// VerifyStemRangeProof that no stem of the range was omitted.
+func MakeStemRangeProof(root VerkleNode, start, end Stem, resolver NodeResolverFn) (*Proof, error) {
+	return defaultProofDomain.MakeStemRangeProof(root, start, end, resolver)
+}
+
+// MakeStemRangeProof is like the MakeStemRangeProof function, in the
+// domain d.
+func (d *ProofDomain) MakeStemRangeProof(root VerkleNode, start, end Stem, resolver NodeResolverFn) (*Proof, error) {
+	if start.Compare(end) > 0 {
+		return nil, fmt.Errorf("invalid stem range %x > %x", start, end)
+	}
+	rootNode, ok := root.(*InternalNode)
+	if !ok {
+		return nil, errors.New("root must be an internal node")
+	}
+	keys, err := rootNode.collectRangeKeys(nil, nil, start, end, resolver)
+	if err != nil {
+		return nil, err
+	}
+	proof, _, _, _, err := d.MakeVerkleMultiProof(root, nil, keys, resolver)
+	return proof, err
+}
+
+// collectRangeKeys gathers the keys needed to prove the range: every key of
+// the stems in the range, and one key per empty or foreign subtree of the
+// range, to prove its absence.
+func (n *InternalNode) collectRangeKeys(keys [][]byte, path []byte, start, end Stem, resolver NodeResolverFn) ([][]byte, error) {
+	for i := range n.children {
+		childpath := append(path[:len(path):len(path)], byte(i))
+		if !stemRangeIntersects(childpath, start, end) {
+			continue
+		}
+		if _, ok := n.children[i].(HashedNode); ok {
+			if resolver == nil {
+				return nil, fmt.Errorf("no resolver for path %x", childpath)
+			}
+			serialized, err := resolver(childpath)
+			if err != nil {
+				return nil, fmt.Errorf("error resolving for path %x: %w", childpath, err)
+			}
+			resolved, err := ParseNode(serialized, n.depth+1)
+			if err != nil {
+				return nil, err
+			}
+			n.children[i] = resolved
+		}
+
+		switch child := n.children[i].(type) {
+		case *InternalNode:
+			var err error
+			if keys, err = child.collectRangeKeys(keys, childpath, start, end, resolver); err != nil {
+				return nil, err
+			}
+		case *LeafNode:
+			if child.stem.Compare(start) >= 0 && child.stem.Compare(end) <= 0 {
+				for suffix, v := range child.values {
+					if v != nil {
+						keys = append(keys, append(child.stem[:StemSize:StemSize], byte(suffix)))
+					}
+				}
+				continue
+			}
+			keys = append(keys, stemRangeAbsenceKey(childpath, start))
+		case Empty:
+			keys = append(keys, stemRangeAbsenceKey(childpath, start))
+		default:
+			return nil, fmt.Errorf("unexpected node of type %T at path %x", child, childpath)
+		}
+	}
+	return keys, nil
+}
+
+// VerifyStemRangeProof checks that proof opens the tree whose root
+// commitment is root to the values it carries, and that it covers every
+// stem between start and end, both included.
+func VerifyStemRangeProof(proof *Proof, root *Point, start, end Stem) error {
+	return defaultProofDomain.VerifyStemRangeProof(proof, root, start, end)
+}
+
+// VerifyStemRangeProof is like the VerifyStemRangeProof function, in the
+// domain d.
+func (d *ProofDomain) VerifyStemRangeProof(proof *Proof, root *Point, start, end Stem) error {
+	pretree, err := PreStateTreeFromProof(proof, root)
+	if err != nil {
+		return fmt.Errorf("error rebuilding the pre-tree from proof: %w", err)
+	}
+	if err := d.verifyWithPreState(proof, pretree); err != nil {
+		return err
+	}
+	return checkStemRangeComplete(pretree.(*InternalNode), nil, start, end)
+}
+
+// checkStemRangeComplete checks that no subtree intersecting the range was
+// left out of the stateless tree.
+func checkStemRangeComplete(n *InternalNode, path []byte, start, end Stem) error {
+	for i, child := range n.children {
+		childpath := append(path[:len(path):len(path)], byte(i))
+		if !stemRangeIntersects(childpath, start, end) {
+			continue
+		}
+		switch child := child.(type) {
+		case *InternalNode:
+			if err := checkStemRangeComplete(child, childpath, start, end); err != nil {
+				return err
+			}
+		case *LeafNode:
+			// A stem of the range can't be used as a proof of absence,
+			// its values would be missing from the proof.
+			if child.isPOAStub && child.stem.Compare(start) >= 0 && child.stem.Compare(end) <= 0 {
+				return fmt.Errorf("%w: stem %x is only proven as a proof-of-absence stub", errIncompleteRange, child.stem)
+			}
+		case Empty:
+		default:
+			return fmt.Errorf("%w: missing subtree at path %x", errIncompleteRange, childpath)
+		}
+	}
+	return nil
+}
+
+// stemRangeIntersects reports whether some stem starting with prefix is in
+// the range.
+func stemRangeIntersects(prefix []byte, start, end Stem) bool {
+	return bytes.Compare(prefix, start[:len(prefix)]) >= 0 && bytes.Compare(prefix, end[:len(prefix)]) <= 0
+}
+
+// stemRangeAbsenceKey returns a key of the range whose stem starts with
+// prefix, used to prove that the range has no stem under prefix.
+func stemRangeAbsenceKey(prefix []byte, start Stem) []byte {
+	key := make([]byte, KeySize)
+	if bytes.Equal(prefix, start[:len(prefix)]) {
+		copy(key, start[:])
+	} else {
+		copy(key, prefix)
+	}
+	return key
+}
@@ -0,0 +1,58 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestStemRangeProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 200)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	rootC := root.Commit()
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	start, end := Stem(keys[51][:StemSize]), Stem(keys[70][:StemSize])
+	proof, err := MakeStemRangeProof(root, start, end, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	if err := VerifyStemRangeProof(proof, rootC, start, end); err != nil {
+		t.Fatalf("error verifying proof: %v", err)
+	}
+	for _, k := range keys[51:71] {
+		var found bool
+		for i, pk := range proof.Keys {
+			found = found || (bytes.Equal(pk, k) && bytes.Equal(proof.PreValues[i], testValue))
+		}
+		if !found {
+			t.Fatalf("key %x of the range is missing from the proof", k)
+		}
+	}
+
+	// A proof of a narrower range doesn't cover the full range.
+	narrow, err := MakeStemRangeProof(root, start, Stem(keys[60][:StemSize]), nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	if err := VerifyStemRangeProof(narrow, rootC, start, end); !errors.Is(err, errIncompleteRange) {
+		t.Fatalf("invalid error, got %v, expected %v", err, errIncompleteRange)
+	}
+
+	// Neither does a proof of a few keys of the range.
+	partial, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{keys[55], keys[65]}, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	if err := VerifyStemRangeProof(partial, rootC, start, end); !errors.Is(err, errIncompleteRange) {
+		t.Fatalf("invalid error, got %v, expected %v", err, errIncompleteRange)
+	}
+}
@@ -167,7 +167,7 @@ func TestMultiProofVerifyMultipleLeavesWithAbsentStem(t *testing.T) {
 	if len(isabsent) == 0 {
 		t.Fatal("should have detected an absent stem")
 	}
-	if !bytes.Equal(isabsent[0], absentstem[:]) {
+	if !bytes.Equal(isabsent[0][:], absentstem[:]) {
 		t.Fatalf("returning the wrong absent stem: %x != %x", isabsent[0], absentstem)
 	}
 
@@ -913,7 +913,7 @@ func testSerializeDeserializeProof(t *testing.T, insertKVs map[string][]byte, pr
 				// There's "nothing" in the tree, so it's fine.
 			case *LeafNode:
 				// If there's a LeafNode, it must **not** be one with a matching stem.
-				if bytes.Equal(lastNode.stem, key) {
+				if bytes.Equal(lastNode.stem[:], key) {
 					t.Fatalf("key %x: last node is a leaf node with matching stem", key)
 				}
 			default:
@@ -1131,7 +1131,7 @@ func TestGenerateProofWithOnlyAbsentKeys(t *testing.T) {
 		var key [32]byte
 		copy(key[:], presentKey)
 		key[StemSize] = byte(i)
-		if _, err := droot.Get(key[:], nil); err != errIsPOAStub {
+		if _, err := droot.Get(key[:], nil); err != ErrIsPOAStub {
 			t.Fatalf("expected ErrPOALeafValue, got %v", err)
 		}
 	}
@@ -1142,10 +1142,17 @@ func TestGenerateProofWithOnlyAbsentKeys(t *testing.T) {
 		var key [32]byte
 		copy(key[:], presentKey)
 		key[StemSize] = byte(i)
-		if err := droot.Insert(key[:], zeroKeyTest, nil); err != errIsPOAStub {
+		if err := droot.Insert(key[:], zeroKeyTest, nil); err != ErrIsPOAStub {
 			t.Fatalf("expected ErrPOALeafValue, got %v", err)
 		}
 	}
+
+	// Deleting from it isn't allowed either.
+	var key [32]byte
+	copy(key[:], presentKey)
+	if _, err := droot.Delete(key[:], nil); err != ErrIsPOAStub {
+		t.Fatalf("expected ErrIsPOAStub, got %v", err)
+	}
 }
 
 func TestDoubleProofOfAbsence(t *testing.T) {
@@ -1246,3 +1253,114 @@ func TestProveAbsenceInEmptyHalf(t *testing.T) {
 		t.Fatalf("invalid number of extension status: %d", len(proof.ExtStatus))
 	}
 }
+
+func TestVerifyVerkleProof(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(k, fourtyKeyTest, nil); err != nil {
+			t.Fatalf("could not insert key: %v", err)
+		}
+	}
+	rootC := root.Commit()
+
+	keys := [][]byte{zeroKeyTest, ffx32KeyTest, fourtyKeyTest}
+	// MakeVerkleMultiProof sorts its keys in place, pass it a copy so that
+	// values line up with keys below.
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, append([][]byte{}, keys...), nil)
+	if err != nil {
+		t.Fatalf("could not create proof: %v", err)
+	}
+	values := [][]byte{fourtyKeyTest, fourtyKeyTest, nil}
+	if err := VerifyVerkleProof(proof, keys, values, rootC); err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+
+	// A value that differs from the proven one must be rejected.
+	values[1] = zeroKeyTest
+	if err := VerifyVerkleProof(proof, keys, values, rootC); err == nil {
+		t.Fatal("proof verified with an invalid value")
+	}
+	values[1] = fourtyKeyTest
+
+	// So must a different root.
+	var otherRoot Point
+	otherRoot.Add(rootC, rootC)
+	if err := VerifyVerkleProof(proof, keys, values, &otherRoot); err == nil {
+		t.Fatal("proof verified against an invalid root")
+	}
+}
+
+func TestVerifyAndExtract(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(k, fourtyKeyTest, nil); err != nil {
+			t.Fatalf("could not insert key: %v", err)
+		}
+	}
+	rootC := root.Commit()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest, ffx32KeyTest, fourtyKeyTest}, nil)
+	if err != nil {
+		t.Fatalf("could not create proof: %v", err)
+	}
+	values, absent, err := VerifyAndExtract(proof, rootC)
+	if err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+	if len(values) != 2 || !bytes.Equal(values[[KeySize]byte(zeroKeyTest)], fourtyKeyTest) || !bytes.Equal(values[[KeySize]byte(ffx32KeyTest)], fourtyKeyTest) {
+		t.Fatalf("invalid proven values: %x", values)
+	}
+	if _, ok := absent[[KeySize]byte(fourtyKeyTest)]; len(absent) != 1 || !ok {
+		t.Fatalf("invalid absent keys: %x", absent)
+	}
+
+	proof.PreValues[0] = oneKeyTest
+	if _, _, err := VerifyAndExtract(proof, rootC); err == nil {
+		t.Fatal("proof verified with an invalid value")
+	}
+}
+
+func TestProofDomain(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, fourtyKeyTest, nil); err != nil {
+		t.Fatalf("could not insert key: %v", err)
+	}
+	rootC := root.Commit()
+
+	if NewProofDomain("").Label() != DefaultTranscriptLabel {
+		t.Fatal("the empty label isn't the default one")
+	}
+	other := NewProofDomain("other chain")
+	if other.Label() != "other chain" {
+		t.Fatalf("invalid transcript label %q", other.Label())
+	}
+	proof, _, _, _, err := other.MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatalf("could not create proof: %v", err)
+	}
+	if err := other.VerifyVerkleProof(proof, [][]byte{zeroKeyTest}, [][]byte{fourtyKeyTest}, rootC); err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+
+	// The proof must not verify in another domain, while proofs of the
+	// default domain still verify.
+	if err := VerifyVerkleProof(proof, [][]byte{zeroKeyTest}, [][]byte{fourtyKeyTest}, rootC); err == nil {
+		t.Fatal("proof verified with another transcript label")
+	}
+	proof, _, _, _, err = MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatalf("could not create proof: %v", err)
+	}
+	if err := VerifyVerkleProof(proof, [][]byte{zeroKeyTest}, [][]byte{fourtyKeyTest}, rootC); err != nil {
+		t.Fatalf("could not verify proof: %v", err)
+	}
+	if err := other.VerifyVerkleProof(proof, [][]byte{zeroKeyTest}, [][]byte{fourtyKeyTest}, rootC); err == nil {
+		t.Fatal("proof verified with another transcript label")
+	}
+}
@@ -0,0 +1,543 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protocol buffer encoding of tree nodes and proofs, following the schema
+// in proto/verkle.proto. Fields are emitted in increasing field number
+// order, and fields holding their default value are omitted, as the
+// reference implementations do. Unknown fields are skipped when decoding.
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+var errProtoInvalid = errors.New("invalid protobuf encoding")
+
+func protoAppendTag(dst []byte, field int, wireType byte) []byte {
+	return binary.AppendUvarint(dst, uint64(field)<<3|uint64(wireType))
+}
+
+func protoAppendVarint(dst []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return dst
+	}
+	return binary.AppendUvarint(protoAppendTag(dst, field, protoWireVarint), v)
+}
+
+// protoAppendBytes appends a length-delimited field, even if it is empty.
+// It is used for repeated fields, embedded messages and optional fields.
+func protoAppendBytes(dst []byte, field int, b []byte) []byte {
+	dst = binary.AppendUvarint(protoAppendTag(dst, field, protoWireBytes), uint64(len(b)))
+	return append(dst, b...)
+}
+
+// protoAppendScalarBytes appends a singular bytes field, which is omitted
+// when empty.
+func protoAppendScalarBytes(dst []byte, field int, b []byte) []byte {
+	if len(b) == 0 {
+		return dst
+	}
+	return protoAppendBytes(dst, field, b)
+}
+
+// protoFields walks the fields of an encoded message. For varint fields,
+// value holds the decoded integer; for length-delimited fields, data holds
+// the payload. Fixed-size fields are skipped, since the schema has none.
+func protoFields(buf []byte, fn func(field int, value uint64, data []byte) error) error {
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errProtoInvalid
+		}
+		buf = buf[n:]
+		field, wireType := tag>>3, byte(tag&7)
+		if field == 0 || field > 1<<29-1 {
+			return fmt.Errorf("invalid field number %d: %w", field, errProtoInvalid)
+		}
+
+		var (
+			value uint64
+			data  []byte
+		)
+		switch wireType {
+		case protoWireVarint:
+			if value, n = binary.Uvarint(buf); n <= 0 {
+				return errProtoInvalid
+			}
+			buf = buf[n:]
+		case protoWireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < size {
+				return errProtoInvalid
+			}
+			data, buf = buf[n:n+int(size)], buf[n+int(size):]
+		case protoWireFixed64, protoWireFixed32:
+			size := 8
+			if wireType == protoWireFixed32 {
+				size = 4
+			}
+			if len(buf) < size {
+				return errProtoInvalid
+			}
+			buf = buf[size:]
+			continue
+		default:
+			return fmt.Errorf("unsupported wire type %d: %w", wireType, errProtoInvalid)
+		}
+		if err := fn(int(field), value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func protoReadFixed(dst []byte, data []byte) error {
+	if len(data) != len(dst) {
+		return fmt.Errorf("invalid field length %d, expected %d: %w", len(data), len(dst), errProtoInvalid)
+	}
+	copy(dst, data)
+	return nil
+}
+
+func protoReadByte(value uint64) (byte, error) {
+	if value > 0xff {
+		return 0, fmt.Errorf("invalid suffix %d: %w", value, errProtoInvalid)
+	}
+	return byte(value), nil
+}
+
+// SerializeNodeProto returns the protobuf encoding of an internal or leaf
+// node, as a Node message. The node must have been committed to.
+func SerializeNodeProto(node VerkleNode) ([]byte, error) {
+	switch n := node.(type) {
+	case *InternalNode:
+		var bitlist [bitlistSize]byte
+		for i, c := range n.children {
+			if _, ok := c.(Empty); !ok {
+				setBit(bitlist[:], i)
+			}
+		}
+		comm := n.commitment.Bytes()
+		var internal []byte
+		internal = protoAppendScalarBytes(internal, 1, bitlist[:])
+		internal = protoAppendScalarBytes(internal, 2, comm[:])
+		return protoAppendBytes(nil, 1, internal), nil
+	case *LeafNode:
+		if n.isPOAStub {
+			return nil, ErrIsPOAStub
+		}
+		c1, c2 := n.c1, n.c2
+		if c1 == nil {
+			c1 = new(Point).SetIdentity()
+		}
+		if c2 == nil {
+			c2 = new(Point).SetIdentity()
+		}
+		comm, c1Bytes, c2Bytes := n.commitment.Bytes(), c1.Bytes(), c2.Bytes()
+		var leaf []byte
+		leaf = protoAppendScalarBytes(leaf, 1, n.stem[:StemSize])
+		leaf = protoAppendScalarBytes(leaf, 2, comm[:])
+		leaf = protoAppendScalarBytes(leaf, 3, c1Bytes[:])
+		leaf = protoAppendScalarBytes(leaf, 4, c2Bytes[:])
+		for i, v := range n.values {
+			if v != nil {
+				var value []byte
+				value = protoAppendVarint(value, 1, uint64(i))
+				value = protoAppendScalarBytes(value, 2, v)
+				leaf = protoAppendBytes(leaf, 5, value)
+			}
+		}
+		return protoAppendBytes(nil, 2, leaf), nil
+	default:
+		return nil, fmt.Errorf("can not protobuf-encode node of type %T", node)
+	}
+}
+
+// ParseNodeProto decodes a node from a Node message, see SerializeNodeProto.
+func ParseNodeProto(buf []byte, depth byte) (VerkleNode, error) {
+	var node VerkleNode
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		var err error
+		switch field {
+		case 1:
+			node, err = parseInternalNodeProto(data, depth)
+		case 2:
+			node, err = parseLeafNodeProto(data, depth)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrInvalidNodeEncoding
+	}
+	return node, nil
+}
+
+func parseInternalNodeProto(buf []byte, depth byte) (VerkleNode, error) {
+	var bitlist, comm []byte
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		switch field {
+		case 1:
+			bitlist = data
+		case 2:
+			comm = data
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(bitlist) != bitlistSize {
+		return nil, ErrInvalidNodeEncoding
+	}
+	node := newInternalNode(depth).(*InternalNode)
+	for i := range node.children {
+		if bit(bitlist, i) {
+			node.children[i] = HashedNode{}
+		}
+	}
+	if err := node.commitment.SetBytes(comm); err != nil {
+		return nil, fmt.Errorf("setting commitment: %w", err)
+	}
+	return node, nil
+}
+
+func parseLeafNodeProto(buf []byte, depth byte) (VerkleNode, error) {
+	var (
+		stem  []byte
+		comms [3][]byte
+	)
+	values := make([][]byte, NodeWidth)
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		switch field {
+		case 1:
+			stem = data
+		case 2, 3, 4:
+			comms[field-2] = data
+		case 5:
+			var (
+				suffix uint64
+				value  = []byte{}
+			)
+			err := protoFields(data, func(field int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					suffix = v
+				case 2:
+					value = data
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			idx, err := protoReadByte(suffix)
+			if err != nil {
+				return err
+			}
+			if len(value) > LeafValueSize {
+				return ErrInvalidNodeEncoding
+			}
+			values[idx] = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(stem) != StemSize {
+		return nil, ErrInvalidNodeEncoding
+	}
+
+	ln := &LeafNode{
+		stem:       Stem(stem),
+		values:     values,
+		commitment: new(Point),
+		c1:         new(Point),
+		c2:         new(Point),
+		depth:      depth,
+	}
+	for i, p := range []*Point{ln.commitment, ln.c1, ln.c2} {
+		if err := p.SetBytes(comms[i]); err != nil {
+			return nil, fmt.Errorf("setting commitment #%d: %w", i, err)
+		}
+	}
+	return ln, nil
+}
+
+// MarshalProto returns the protobuf encoding of the IPA proof.
+func (ipp *IPAProof) MarshalProto() ([]byte, error) {
+	var buf []byte
+	for i := range ipp.CL {
+		buf = protoAppendBytes(buf, 1, ipp.CL[i][:])
+	}
+	for i := range ipp.CR {
+		buf = protoAppendBytes(buf, 2, ipp.CR[i][:])
+	}
+	return protoAppendScalarBytes(buf, 3, ipp.FinalEvaluation[:]), nil
+}
+
+// UnmarshalProto decodes the protobuf encoding of an IPA proof.
+func (ipp *IPAProof) UnmarshalProto(buf []byte) error {
+	var (
+		proof  IPAProof
+		cl, cr int
+		final  []byte
+	)
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		switch field {
+		case 1:
+			if cl == IPA_PROOF_DEPTH {
+				return fmt.Errorf("too many cl elements: %w", errProtoInvalid)
+			}
+			cl++
+			return protoReadFixed(proof.CL[cl-1][:], data)
+		case 2:
+			if cr == IPA_PROOF_DEPTH {
+				return fmt.Errorf("too many cr elements: %w", errProtoInvalid)
+			}
+			cr++
+			return protoReadFixed(proof.CR[cr-1][:], data)
+		case 3:
+			final = data
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if cl != IPA_PROOF_DEPTH || cr != IPA_PROOF_DEPTH {
+		return fmt.Errorf("invalid IPA proof depth: %w", errProtoInvalid)
+	}
+	if len(final) != 0 {
+		if err := protoReadFixed(proof.FinalEvaluation[:], final); err != nil {
+			return err
+		}
+	}
+	*ipp = proof
+	return nil
+}
+
+// MarshalProto returns the protobuf encoding of the verkle proof.
+func (vp *VerkleProof) MarshalProto() ([]byte, error) {
+	if vp.IPAProof == nil {
+		return nil, errors.New("missing IPA proof")
+	}
+	var buf []byte
+	for i := range vp.OtherStems {
+		buf = protoAppendBytes(buf, 1, vp.OtherStems[i][:])
+	}
+	buf = protoAppendScalarBytes(buf, 2, vp.DepthExtensionPresent)
+	for i := range vp.CommitmentsByPath {
+		buf = protoAppendBytes(buf, 3, vp.CommitmentsByPath[i][:])
+	}
+	buf = protoAppendScalarBytes(buf, 4, vp.D[:])
+	ipaProof, err := vp.IPAProof.MarshalProto()
+	if err != nil {
+		return nil, err
+	}
+	return protoAppendBytes(buf, 5, ipaProof), nil
+}
+
+// UnmarshalProto decodes the protobuf encoding of a verkle proof.
+func (vp *VerkleProof) UnmarshalProto(buf []byte) error {
+	proof := VerkleProof{DepthExtensionPresent: []byte{}}
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		switch field {
+		case 1:
+			var stem [StemSize]byte
+			if err := protoReadFixed(stem[:], data); err != nil {
+				return err
+			}
+			proof.OtherStems = append(proof.OtherStems, stem)
+		case 2:
+			proof.DepthExtensionPresent = append([]byte{}, data...)
+		case 3:
+			var comm [32]byte
+			if err := protoReadFixed(comm[:], data); err != nil {
+				return err
+			}
+			proof.CommitmentsByPath = append(proof.CommitmentsByPath, comm)
+		case 4:
+			return protoReadFixed(proof.D[:], data)
+		case 5:
+			proof.IPAProof = &IPAProof{}
+			if err := proof.IPAProof.UnmarshalProto(data); err != nil {
+				return fmt.Errorf("decoding IPA proof: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if proof.IPAProof == nil {
+		return fmt.Errorf("missing IPA proof: %w", errProtoInvalid)
+	}
+	*vp = proof
+	return nil
+}
+
+func (ssd *StemStateDiff) appendProto(dst []byte) []byte {
+	dst = protoAppendScalarBytes(dst, 1, ssd.Stem[:])
+	for _, suffixDiff := range ssd.SuffixDiffs {
+		var buf []byte
+		buf = protoAppendVarint(buf, 1, uint64(suffixDiff.Suffix))
+		if suffixDiff.CurrentValue != nil {
+			buf = protoAppendBytes(buf, 2, suffixDiff.CurrentValue[:])
+		}
+		if suffixDiff.NewValue != nil {
+			buf = protoAppendBytes(buf, 3, suffixDiff.NewValue[:])
+		}
+		dst = protoAppendBytes(dst, 2, buf)
+	}
+	return dst
+}
+
+// UnmarshalProto decodes the protobuf encoding of a stem state diff.
+func (ssd *StemStateDiff) UnmarshalProto(buf []byte) error {
+	var diff StemStateDiff
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		switch field {
+		case 1:
+			return protoReadFixed(diff.Stem[:], data)
+		case 2:
+			var suffixDiff SuffixStateDiff
+			err := protoFields(data, func(field int, value uint64, data []byte) error {
+				var err error
+				switch field {
+				case 1:
+					suffixDiff.Suffix, err = protoReadByte(value)
+				case 2:
+					suffixDiff.CurrentValue = new([32]byte)
+					err = protoReadFixed(suffixDiff.CurrentValue[:], data)
+				case 3:
+					suffixDiff.NewValue = new([32]byte)
+					err = protoReadFixed(suffixDiff.NewValue[:], data)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			diff.SuffixDiffs = append(diff.SuffixDiffs, suffixDiff)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*ssd = diff
+	return nil
+}
+
+// MarshalProto returns the protobuf encoding of the stem state diff.
+func (ssd *StemStateDiff) MarshalProto() ([]byte, error) {
+	return ssd.appendProto(nil), nil
+}
+
+// MarshalProto returns the protobuf encoding of the state diff.
+func (sd StateDiff) MarshalProto() ([]byte, error) {
+	var buf []byte
+	for i := range sd {
+		buf = protoAppendBytes(buf, 1, sd[i].appendProto(nil))
+	}
+	return buf, nil
+}
+
+// UnmarshalProto decodes the protobuf encoding of a state diff.
+func (sd *StateDiff) UnmarshalProto(buf []byte) error {
+	diff := StateDiff{}
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		if field != 1 {
+			return nil
+		}
+		var stemDiff StemStateDiff
+		if err := stemDiff.UnmarshalProto(data); err != nil {
+			return err
+		}
+		diff = append(diff, stemDiff)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*sd = diff
+	return nil
+}
+
+// MarshalWitnessProto returns the protobuf encoding of a Witness message
+// made of a state diff and its proof.
+func MarshalWitnessProto(sd StateDiff, vp *VerkleProof) ([]byte, error) {
+	diff, err := sd.MarshalProto()
+	if err != nil {
+		return nil, err
+	}
+	proof, err := vp.MarshalProto()
+	if err != nil {
+		return nil, err
+	}
+	return protoAppendBytes(protoAppendBytes(nil, 1, diff), 2, proof), nil
+}
+
+// UnmarshalWitnessProto decodes a Witness message, see MarshalWitnessProto.
+func UnmarshalWitnessProto(buf []byte) (StateDiff, *VerkleProof, error) {
+	var (
+		sd StateDiff
+		vp *VerkleProof
+	)
+	err := protoFields(buf, func(field int, _ uint64, data []byte) error {
+		switch field {
+		case 1:
+			return sd.UnmarshalProto(data)
+		case 2:
+			vp = &VerkleProof{}
+			return vp.UnmarshalProto(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if vp == nil {
+		return nil, nil, fmt.Errorf("missing verkle proof: %w", errProtoInvalid)
+	}
+	if sd == nil {
+		sd = StateDiff{}
+	}
+	return sd, vp, nil
+}
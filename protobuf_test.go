@@ -0,0 +1,133 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProtoWitnessRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(keys[0], fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	postroot.Commit()
+
+	proveKeys := [][]byte{keys[0], keys[1], zeroKeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, proveKeys, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	vp, statediff, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatalf("error serializing proof: %v", err)
+	}
+
+	encoded, err := MarshalWitnessProto(statediff, vp)
+	if err != nil {
+		t.Fatalf("error encoding witness: %v", err)
+	}
+	decodedDiff, decodedProof, err := UnmarshalWitnessProto(encoded)
+	if err != nil {
+		t.Fatalf("error decoding witness: %v", err)
+	}
+	if err := decodedProof.Equal(vp); err != nil {
+		t.Fatalf("decoded proof differs: %v", err)
+	}
+	if *decodedProof.IPAProof != *vp.IPAProof {
+		t.Fatal("decoded IPA proof differs")
+	}
+	if err := decodedDiff.Equal(statediff); err != nil {
+		t.Fatalf("decoded state diff differs: %v", err)
+	}
+
+	if _, _, err := UnmarshalWitnessProto(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated witness")
+	}
+}
+
+func TestProtoNodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, []byte{}, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	encoded, err := SerializeNodeProto(root)
+	if err != nil {
+		t.Fatalf("error encoding root: %v", err)
+	}
+	decoded, err := ParseNodeProto(encoded, 0)
+	if err != nil {
+		t.Fatalf("error decoding root: %v", err)
+	}
+	if !decoded.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+
+	leaf := root.(*InternalNode).children[0].(*LeafNode)
+	encoded, err = SerializeNodeProto(leaf)
+	if err != nil {
+		t.Fatalf("error encoding leaf: %v", err)
+	}
+	decoded, err = ParseNodeProto(encoded, 1)
+	if err != nil {
+		t.Fatalf("error decoding leaf: %v", err)
+	}
+	dleaf := decoded.(*LeafNode)
+	if !dleaf.commitment.Equal(leaf.commitment) || !dleaf.c1.Equal(leaf.c1) || !dleaf.c2.Equal(leaf.c2) {
+		t.Fatal("invalid leaf commitments")
+	}
+	if dleaf.stem != leaf.stem {
+		t.Fatalf("invalid stem, got %x, expected %x", dleaf.stem, leaf.stem)
+	}
+	for i := range leaf.values {
+		if !bytes.Equal(leaf.values[i], dleaf.values[i]) || (leaf.values[i] == nil) != (dleaf.values[i] == nil) {
+			t.Fatalf("invalid value #%d: got %x, expected %x", i, dleaf.values[i], leaf.values[i])
+		}
+	}
+
+	// Unknown fields, such as the ones added by a newer schema, are skipped.
+	encoded = append(encoded, 0x18, 0x2a)
+	if _, err := ParseNodeProto(encoded, 1); err != nil {
+		t.Fatalf("error decoding leaf with an unknown field: %v", err)
+	}
+}
+
+func TestProtoWireFormat(t *testing.T) {
+	t.Parallel()
+
+	value := [32]byte{1}
+	diff := StemStateDiff{
+		SuffixDiffs: SuffixStateDiffs{{Suffix: 5, NewValue: &value}},
+	}
+	encoded, err := diff.MarshalProto()
+	if err != nil {
+		t.Fatalf("error encoding stem diff: %v", err)
+	}
+	// Field 1 (stem) is 31 zero bytes, field 2 holds a SuffixStateDiff with
+	// suffix = 5 and new_value set.
+	expected := append([]byte{0x0a, 31}, make([]byte, 31)...)
+	expected = append(expected, 0x12, 36, 0x08, 0x05, 0x1a, 32)
+	expected = append(expected, value[:]...)
+	if !bytes.Equal(encoded, expected) {
+		t.Fatalf("invalid encoding, got %x, expected %x", encoded, expected)
+	}
+}
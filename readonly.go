@@ -0,0 +1,142 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrReadOnly is returned when trying to modify a ReadOnlyTree.
+var ErrReadOnly = errors.New("tree is read-only")
+
+// ReadOnlyTree gives read access to a committed tree, and is safe for
+// concurrent use. Reads resolve hashed nodes without storing them in the
+// tree, and proof generation, which does store them, excludes all other
+// accesses. The wrapped tree must not be modified directly while it is
+// in use.
+type ReadOnlyTree struct {
+	mu       sync.RWMutex
+	root     *InternalNode
+	resolver NodeResolverFn
+}
+
+// NewReadOnlyTree commits the tree and wraps it in a ReadOnlyTree.
+func NewReadOnlyTree(root VerkleNode, resolver NodeResolverFn) (*ReadOnlyTree, error) {
+	rootNode, ok := root.(*InternalNode)
+	if !ok {
+		return nil, errors.New("root must be an internal node")
+	}
+	rootNode.Commit()
+	return &ReadOnlyTree{root: rootNode, resolver: resolver}, nil
+}
+
+// Commitment returns a copy of the root commitment.
+func (t *ReadOnlyTree) Commitment() *Point {
+	return new(Point).Set(t.root.commitment)
+}
+
+// Get returns the value of a key, or nil if it is absent.
+func (t *ReadOnlyTree) Get(key []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key length, expected %d, got %d", KeySize, len(key))
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var node VerkleNode = t.root
+	for depth := 0; ; depth++ {
+		switch n := node.(type) {
+		case *InternalNode:
+			node = n.children[key[depth]]
+			if _, ok := node.(HashedNode); !ok {
+				continue
+			}
+			if t.resolver == nil {
+				return nil, fmt.Errorf("hashed node at path %x could not be resolved: %w", key[:depth+1], errReadFromInvalid)
+			}
+			serialized, err := t.resolver(key[:depth+1])
+			if err != nil {
+				return nil, fmt.Errorf("resolving node at path %x: %w", key[:depth+1], err)
+			}
+			if node, err = ParseNode(serialized, byte(depth+1)); err != nil {
+				return nil, err
+			}
+		case *LeafNode:
+			if !equalPaths(n.stem[:], key) {
+				return nil, nil
+			}
+			if n.isPOAStub {
+				return nil, ErrIsPOAStub
+			}
+			return n.values[key[StemSize]], nil
+		case Empty:
+			return nil, nil
+		default:
+			return nil, errUnknownNodeType
+		}
+	}
+}
+
+// MakeProof creates a proof of the values of the given keys.
+func (t *ReadOnlyTree) MakeProof(keys [][]byte) (*Proof, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(t.root, nil, append([][]byte{}, keys...), t.resolver)
+	return proof, err
+}
+
+// Iterate calls fn on each key-value pair, in key order, starting at the
+// first key that is greater than or equal to start. It stops at the first
+// error returned by fn.
+func (t *ReadOnlyTree) Iterate(start []byte, fn func(key, value []byte) error) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	it, err := NewIterator(t.root, t.resolver)
+	if err != nil {
+		return err
+	}
+	it.Seek(start)
+	for it.Next() {
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// Insert always returns ErrReadOnly.
+func (t *ReadOnlyTree) Insert([]byte, []byte) error {
+	return ErrReadOnly
+}
+
+// Delete always returns ErrReadOnly.
+func (t *ReadOnlyTree) Delete([]byte) error {
+	return ErrReadOnly
+}
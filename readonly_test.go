@@ -0,0 +1,91 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestReadOnlyTree(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeysSorted(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	rootC := root.Commit().Bytes()
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, node VerkleNode) {
+		serialized, err := node.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = serialized
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	tree, err := NewReadOnlyTree(root, resolver)
+	if err != nil {
+		t.Fatalf("error creating read-only tree: %v", err)
+	}
+	if tree.Commitment().Bytes() != rootC {
+		t.Fatal("invalid root commitment")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, k := range keys {
+				value, err := tree.Get(k)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(value, k) {
+					errs <- errors.New("invalid value")
+					return
+				}
+			}
+			if _, err := tree.MakeProof(keys[10*i : 10*i+10]); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("error reading concurrently: %v", err)
+	}
+
+	if value, err := tree.Get(zeroKeyTest); err != nil || value != nil {
+		t.Fatalf("expected an absent key, got %x, %v", value, err)
+	}
+
+	var i int
+	err = tree.Iterate(keys[50], func(key, value []byte) error {
+		if !bytes.Equal(key, keys[50+i]) || !bytes.Equal(value, keys[50+i]) {
+			t.Fatalf("invalid pair #%d: %x %x", i, key, value)
+		}
+		i++
+		return nil
+	})
+	if err != nil || i != 50 {
+		t.Fatalf("error iterating after %d keys: %v", i, err)
+	}
+
+	if err := tree.Insert(zeroKeyTest, testValue); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := tree.Delete(keys[0]); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Node types below firstCustomNodeType are reserved for the encodings of
+// this package. The ones above, up to the version flag, are available to
+// embedders that want to experiment with their own kind of nodes.
+const (
+	firstCustomNodeType byte = 0x40
+	lastCustomNodeType  byte = nodeVersionFlag - 1
+)
+
+// NodeCodec holds the functions that encode and decode the payload of a
+// custom node type. The payload starts with the node type byte, and
+// doesn't include the version header.
+type NodeCodec struct {
+	Encode func(node VerkleNode) ([]byte, error)
+	Decode func(payload []byte, depth byte) (VerkleNode, error)
+}
+
+var (
+	customNodeCodecsLock sync.RWMutex
+	customNodeCodecs     = map[byte]NodeCodec{}
+)
+
+// RegisterNodeType registers the codec of a custom node type, which ParseNode
+// will then use to decode any payload of that type. Since the length of these
+// payloads is unknown, they can't be read by ParseNodeFrom.
+func RegisterNodeType(nodeType byte, codec NodeCodec) error {
+	if nodeType < firstCustomNodeType || nodeType > lastCustomNodeType {
+		return fmt.Errorf("node type %#x is outside of the custom range [%#x, %#x]", nodeType, firstCustomNodeType, lastCustomNodeType)
+	}
+	if codec.Encode == nil || codec.Decode == nil {
+		return fmt.Errorf("incomplete codec for node type %#x", nodeType)
+	}
+
+	customNodeCodecsLock.Lock()
+	defer customNodeCodecsLock.Unlock()
+	if _, ok := customNodeCodecs[nodeType]; ok {
+		return fmt.Errorf("node type %#x is already registered", nodeType)
+	}
+	customNodeCodecs[nodeType] = codec
+	return nil
+}
+
+// UnregisterNodeType removes the codec of a custom node type.
+func UnregisterNodeType(nodeType byte) {
+	customNodeCodecsLock.Lock()
+	defer customNodeCodecsLock.Unlock()
+	delete(customNodeCodecs, nodeType)
+}
+
+func customNodeCodec(nodeType byte) (NodeCodec, bool) {
+	customNodeCodecsLock.RLock()
+	defer customNodeCodecsLock.RUnlock()
+	codec, ok := customNodeCodecs[nodeType]
+	return codec, ok
+}
+
+// SerializeCustomNode serializes a node with the codec registered for
+// nodeType, and prefixes it with the version header. It is meant to be
+// called by the Serialize method of custom nodes.
+func SerializeCustomNode(nodeType byte, node VerkleNode) ([]byte, error) {
+	codec, ok := customNodeCodec(nodeType)
+	if !ok {
+		return nil, fmt.Errorf("node type %#x is not registered", nodeType)
+	}
+	payload, err := codec.Encode(node)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < nodeTypeSize || payload[nodeTypeOffset] != nodeType {
+		return nil, fmt.Errorf("payload of node type %#x doesn't start with its type", nodeType)
+	}
+	serialized, ret := newSerializedNode(len(payload))
+	copy(ret, payload)
+	return serialized, nil
+}
@@ -0,0 +1,64 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegisterNodeType(t *testing.T) {
+	t.Parallel()
+
+	// A leaf whose commitments are recomputed on load, holding one value.
+	const nodeType = lastCustomNodeType
+	codec := NodeCodec{
+		Encode: func(node VerkleNode) ([]byte, error) {
+			leaf := node.(*LeafNode)
+			payload := append([]byte{nodeType}, leaf.stem[:]...)
+			return append(payload, leaf.values[0]...), nil
+		},
+		Decode: func(payload []byte, depth byte) (VerkleNode, error) {
+			values := make([][]byte, NodeWidth)
+			values[0] = payload[nodeTypeSize+StemSize:]
+			leaf, err := NewLeafNode(KeyToStem(payload[nodeTypeSize:]), values)
+			if err != nil {
+				return nil, err
+			}
+			leaf.setDepth(depth)
+			return leaf, nil
+		},
+	}
+	if err := RegisterNodeType(leafType, codec); err == nil {
+		t.Fatal("expected an error registering a built-in node type")
+	}
+	if err := RegisterNodeType(nodeType, codec); err != nil {
+		t.Fatalf("error registering node type: %v", err)
+	}
+	defer UnregisterNodeType(nodeType)
+	if err := RegisterNodeType(nodeType, codec); err == nil {
+		t.Fatal("expected an error registering a node type twice")
+	}
+
+	values := make([][]byte, NodeWidth)
+	values[0] = testValue
+	leaf, err := NewLeafNode(KeyToStem(ffx32KeyTest), values)
+	if err != nil {
+		t.Fatalf("error creating leaf node: %v", err)
+	}
+	serialized, err := SerializeCustomNode(nodeType, leaf)
+	if err != nil {
+		t.Fatalf("error serializing node: %v", err)
+	}
+	if serialized[0] != currentVersionHeader || serialized[nodeVersionSize] != nodeType {
+		t.Fatalf("invalid header %x", serialized[:nodeVersionSize+nodeTypeSize])
+	}
+	parsed, err := ParseNode(serialized, 1)
+	if err != nil {
+		t.Fatalf("error parsing node: %v", err)
+	}
+	if !parsed.Commitment().Equal(leaf.Commitment()) {
+		t.Fatal("invalid commitment")
+	}
+	if v, _ := parsed.Get(append(ffx32KeyTest[:StemSize:StemSize], 0), nil); !bytes.Equal(v, testValue) {
+		t.Fatalf("invalid value %x", v)
+	}
+}
@@ -0,0 +1,578 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// RLP encoding of tree nodes and proof structures, for clients that persist
+// their data as RLP. Group elements are encoded in their 32-byte compressed
+// form, and missing values as empty strings.
+//
+//	InternalNode:  [internalType, bitlist, commitment]
+//	LeafNode:      [leafType, stem, commitment, c1, c2, [[suffix, value], ...]]
+//	IPAProof:      [[cl, ...], [cr, ...], finalEvaluation]
+//	VerkleProof:   [[otherStem, ...], depthExtensionPresent, [commitment, ...], d, IPAProof]
+//	StateDiff:     [[stem, [[suffix, currentValue, newValue], ...]], ...]
+
+const (
+	rlpStringOffset byte = 0x80
+	rlpListOffset   byte = 0xc0
+	rlpShortLimit        = 55
+)
+
+var errRLPInvalid = errors.New("invalid rlp encoding")
+
+func rlpAppendHeader(dst []byte, offset byte, size int) []byte {
+	if size <= rlpShortLimit {
+		return append(dst, offset+byte(size))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(size))
+	sizeLen := (bits.Len64(uint64(size)) + 7) / 8
+	dst = append(dst, offset+rlpShortLimit+byte(sizeLen))
+	return append(dst, buf[8-sizeLen:]...)
+}
+
+func rlpAppendString(dst []byte, s []byte) []byte {
+	if len(s) == 1 && s[0] < rlpStringOffset {
+		return append(dst, s[0])
+	}
+	dst = rlpAppendHeader(dst, rlpStringOffset, len(s))
+	return append(dst, s...)
+}
+
+func rlpAppendByte(dst []byte, b byte) []byte {
+	// Integers are encoded without leading zeroes, so 0 is the empty string.
+	if b == 0 {
+		return append(dst, rlpStringOffset)
+	}
+	return rlpAppendString(dst, []byte{b})
+}
+
+func rlpAppendList(dst []byte, items ...[]byte) []byte {
+	var size int
+	for _, item := range items {
+		size += len(item)
+	}
+	dst = rlpAppendHeader(dst, rlpListOffset, size)
+	for _, item := range items {
+		dst = append(dst, item...)
+	}
+	return dst
+}
+
+// rlpSplit reads the first item of buf, and returns whether it is a list,
+// its content and the bytes that follow it.
+func rlpSplit(buf []byte) (bool, []byte, []byte, error) {
+	if len(buf) == 0 {
+		return false, nil, nil, errRLPInvalid
+	}
+	var (
+		isList     bool
+		headerSize = 1
+		size       int
+		prefix     = buf[0]
+	)
+	switch {
+	case prefix < rlpStringOffset:
+		return false, buf[:1], buf[1:], nil
+	case prefix <= rlpStringOffset+rlpShortLimit:
+		size = int(prefix - rlpStringOffset)
+	case prefix < rlpListOffset:
+		sizeLen := int(prefix - rlpStringOffset - rlpShortLimit)
+		if len(buf) < 1+sizeLen || sizeLen > 4 {
+			return false, nil, nil, errRLPInvalid
+		}
+		for _, b := range buf[1 : 1+sizeLen] {
+			size = size<<8 | int(b)
+		}
+		headerSize += sizeLen
+	case prefix <= rlpListOffset+rlpShortLimit:
+		isList = true
+		size = int(prefix - rlpListOffset)
+	default:
+		isList = true
+		sizeLen := int(prefix - rlpListOffset - rlpShortLimit)
+		if len(buf) < 1+sizeLen || sizeLen > 4 {
+			return false, nil, nil, errRLPInvalid
+		}
+		for _, b := range buf[1 : 1+sizeLen] {
+			size = size<<8 | int(b)
+		}
+		headerSize += sizeLen
+	}
+	if len(buf) < headerSize+size {
+		return false, nil, nil, errRLPInvalid
+	}
+	return isList, buf[headerSize : headerSize+size], buf[headerSize+size:], nil
+}
+
+// rlpStrings reads a list made of strings only.
+func rlpStrings(buf []byte) ([][]byte, error) {
+	var items [][]byte
+	for len(buf) > 0 {
+		isList, item, rest, err := rlpSplit(buf)
+		if err != nil {
+			return nil, err
+		}
+		if isList {
+			return nil, errRLPInvalid
+		}
+		items = append(items, item)
+		buf = rest
+	}
+	return items, nil
+}
+
+// rlpLists reads a list made of lists only, and returns their content.
+func rlpLists(buf []byte) ([][]byte, error) {
+	var items [][]byte
+	for len(buf) > 0 {
+		isList, item, rest, err := rlpSplit(buf)
+		if err != nil {
+			return nil, err
+		}
+		if !isList {
+			return nil, errRLPInvalid
+		}
+		items = append(items, item)
+		buf = rest
+	}
+	return items, nil
+}
+
+// rlpList reads a single top-level list, and returns its content.
+func rlpList(buf []byte) ([]byte, error) {
+	isList, content, rest, err := rlpSplit(buf)
+	if err != nil {
+		return nil, err
+	}
+	if !isList || len(rest) != 0 {
+		return nil, errRLPInvalid
+	}
+	return content, nil
+}
+
+func rlpReadByte(s []byte) (byte, error) {
+	switch {
+	case len(s) == 0:
+		return 0, nil
+	case len(s) == 1 && s[0] != 0:
+		return s[0], nil
+	default:
+		return 0, errRLPInvalid
+	}
+}
+
+func rlpReadFixed(dst []byte, s []byte) error {
+	if len(s) != len(dst) {
+		return fmt.Errorf("invalid rlp string length %d, expected %d: %w", len(s), len(dst), errRLPInvalid)
+	}
+	copy(dst, s)
+	return nil
+}
+
+// SerializeNodeRLP returns the RLP encoding of an internal or leaf node.
+// The node must have been committed to.
+func SerializeNodeRLP(node VerkleNode) ([]byte, error) {
+	switch n := node.(type) {
+	case *InternalNode:
+		var bitlist [bitlistSize]byte
+		for i, c := range n.children {
+			if _, ok := c.(Empty); !ok {
+				setBit(bitlist[:], i)
+			}
+		}
+		comm := n.commitment.Bytes()
+		return rlpAppendList(nil,
+			rlpAppendByte(nil, internalType),
+			rlpAppendString(nil, bitlist[:]),
+			rlpAppendString(nil, comm[:])), nil
+	case *LeafNode:
+		if n.isPOAStub {
+			return nil, ErrIsPOAStub
+		}
+		c1, c2 := n.c1, n.c2
+		if c1 == nil {
+			c1 = new(Point).SetIdentity()
+		}
+		if c2 == nil {
+			c2 = new(Point).SetIdentity()
+		}
+		comm, c1Bytes, c2Bytes := n.commitment.Bytes(), c1.Bytes(), c2.Bytes()
+		var values []byte
+		for i, v := range n.values {
+			if v != nil {
+				values = rlpAppendList(values, rlpAppendByte(nil, byte(i)), rlpAppendString(nil, v))
+			}
+		}
+		return rlpAppendList(nil,
+			rlpAppendByte(nil, leafType),
+			rlpAppendString(nil, n.stem[:StemSize]),
+			rlpAppendString(nil, comm[:]),
+			rlpAppendString(nil, c1Bytes[:]),
+			rlpAppendString(nil, c2Bytes[:]),
+			rlpAppendList(nil, values)), nil
+	default:
+		return nil, fmt.Errorf("can not rlp-encode node of type %T", node)
+	}
+}
+
+// ParseNodeRLP decodes a node from its RLP encoding, see SerializeNodeRLP.
+func ParseNodeRLP(buf []byte, depth byte) (VerkleNode, error) {
+	content, err := rlpList(buf)
+	if err != nil {
+		return nil, err
+	}
+	_, typeBytes, content, err := rlpSplit(content)
+	if err != nil {
+		return nil, err
+	}
+	nodeType, err := rlpReadByte(typeBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch nodeType {
+	case internalType:
+		fields, err := rlpStrings(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 2 || len(fields[0]) != bitlistSize {
+			return nil, ErrInvalidNodeEncoding
+		}
+		node := newInternalNode(depth).(*InternalNode)
+		for i := range node.children {
+			if bit(fields[0], i) {
+				node.children[i] = HashedNode{}
+			}
+		}
+		if err := node.commitment.SetBytes(fields[1]); err != nil {
+			return nil, fmt.Errorf("setting commitment: %w", err)
+		}
+		return node, nil
+	case leafType:
+		// The last field is the list of values, split it first.
+		var fields [][]byte
+		for i := 0; i < 4; i++ {
+			var (
+				isList bool
+				field  []byte
+			)
+			isList, field, content, err = rlpSplit(content)
+			if err != nil {
+				return nil, err
+			}
+			if isList {
+				return nil, ErrInvalidNodeEncoding
+			}
+			fields = append(fields, field)
+		}
+		valuesContent, err := rlpList(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields[0]) != StemSize {
+			return nil, ErrInvalidNodeEncoding
+		}
+
+		ln := &LeafNode{
+			values:     make([][]byte, NodeWidth),
+			commitment: new(Point),
+			c1:         new(Point),
+			c2:         new(Point),
+			depth:      depth,
+		}
+		copy(ln.stem[:], fields[0])
+		for i, p := range []*Point{ln.commitment, ln.c1, ln.c2} {
+			if err := p.SetBytes(fields[i+1]); err != nil {
+				return nil, fmt.Errorf("setting commitment #%d: %w", i, err)
+			}
+		}
+		values, err := rlpLists(valuesContent)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			pair, err := rlpStrings(v)
+			if err != nil {
+				return nil, err
+			}
+			if len(pair) != 2 || len(pair[1]) > LeafValueSize {
+				return nil, ErrInvalidNodeEncoding
+			}
+			suffix, err := rlpReadByte(pair[0])
+			if err != nil {
+				return nil, err
+			}
+			ln.values[suffix] = append([]byte{}, pair[1]...)
+		}
+		return ln, nil
+	default:
+		return nil, ErrInvalidNodeEncoding
+	}
+}
+
+func (ipp *IPAProof) appendRLP(dst []byte) []byte {
+	var cl, cr []byte
+	for i := range ipp.CL {
+		cl = rlpAppendString(cl, ipp.CL[i][:])
+		cr = rlpAppendString(cr, ipp.CR[i][:])
+	}
+	return rlpAppendList(dst,
+		rlpAppendList(nil, cl),
+		rlpAppendList(nil, cr),
+		rlpAppendString(nil, ipp.FinalEvaluation[:]))
+}
+
+// MarshalRLP returns the RLP encoding of the IPA proof.
+func (ipp *IPAProof) MarshalRLP() ([]byte, error) {
+	return ipp.appendRLP(nil), nil
+}
+
+// UnmarshalRLP decodes the RLP encoding of an IPA proof.
+func (ipp *IPAProof) UnmarshalRLP(buf []byte) error {
+	content, err := rlpList(buf)
+	if err != nil {
+		return err
+	}
+	_, clContent, content, err := rlpSplit(content)
+	if err != nil {
+		return err
+	}
+	_, crContent, content, err := rlpSplit(content)
+	if err != nil {
+		return err
+	}
+	final, err := rlpStrings(content)
+	if err != nil {
+		return err
+	}
+	cl, err := rlpStrings(clContent)
+	if err != nil {
+		return err
+	}
+	cr, err := rlpStrings(crContent)
+	if err != nil {
+		return err
+	}
+	if len(cl) != IPA_PROOF_DEPTH || len(cr) != IPA_PROOF_DEPTH || len(final) != 1 {
+		return errRLPInvalid
+	}
+	for i := range ipp.CL {
+		if err := rlpReadFixed(ipp.CL[i][:], cl[i]); err != nil {
+			return err
+		}
+		if err := rlpReadFixed(ipp.CR[i][:], cr[i]); err != nil {
+			return err
+		}
+	}
+	return rlpReadFixed(ipp.FinalEvaluation[:], final[0])
+}
+
+// MarshalRLP returns the RLP encoding of the verkle proof.
+func (vp *VerkleProof) MarshalRLP() ([]byte, error) {
+	if vp.IPAProof == nil {
+		return nil, errors.New("missing IPA proof")
+	}
+	var stems, comms []byte
+	for i := range vp.OtherStems {
+		stems = rlpAppendString(stems, vp.OtherStems[i][:])
+	}
+	for i := range vp.CommitmentsByPath {
+		comms = rlpAppendString(comms, vp.CommitmentsByPath[i][:])
+	}
+	return rlpAppendList(nil,
+		rlpAppendList(nil, stems),
+		rlpAppendString(nil, vp.DepthExtensionPresent),
+		rlpAppendList(nil, comms),
+		rlpAppendString(nil, vp.D[:]),
+		vp.IPAProof.appendRLP(nil)), nil
+}
+
+// EncodeRLP writes the RLP encoding of the verkle proof to w. Its
+// signature makes VerkleProof usable with geth's rlp package.
+func (vp *VerkleProof) EncodeRLP(w io.Writer) error {
+	encoded, err := vp.MarshalRLP()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// UnmarshalRLP decodes the RLP encoding of a verkle proof.
+func (vp *VerkleProof) UnmarshalRLP(buf []byte) error {
+	content, err := rlpList(buf)
+	if err != nil {
+		return err
+	}
+	var fields [4][]byte
+	for i := range fields {
+		if _, fields[i], content, err = rlpSplit(content); err != nil {
+			return err
+		}
+	}
+	var ipaProof IPAProof
+	if err := ipaProof.UnmarshalRLP(content); err != nil {
+		return fmt.Errorf("decoding IPA proof: %w", err)
+	}
+	stems, err := rlpStrings(fields[0])
+	if err != nil {
+		return err
+	}
+	comms, err := rlpStrings(fields[2])
+	if err != nil {
+		return err
+	}
+
+	proof := VerkleProof{
+		OtherStems:            make([][StemSize]byte, len(stems)),
+		DepthExtensionPresent: append([]byte{}, fields[1]...),
+		CommitmentsByPath:     make([][32]byte, len(comms)),
+		IPAProof:              &ipaProof,
+	}
+	for i := range stems {
+		if err := rlpReadFixed(proof.OtherStems[i][:], stems[i]); err != nil {
+			return err
+		}
+	}
+	for i := range comms {
+		if err := rlpReadFixed(proof.CommitmentsByPath[i][:], comms[i]); err != nil {
+			return err
+		}
+	}
+	if err := rlpReadFixed(proof.D[:], fields[3]); err != nil {
+		return err
+	}
+	*vp = proof
+	return nil
+}
+
+func rlpAppendOptional(dst []byte, value *[32]byte) []byte {
+	if value == nil {
+		return rlpAppendString(dst, nil)
+	}
+	return rlpAppendString(dst, value[:])
+}
+
+func rlpReadOptional(s []byte) (*[32]byte, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	var value [32]byte
+	if err := rlpReadFixed(value[:], s); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// MarshalRLP returns the RLP encoding of the state diff.
+func (sd StateDiff) MarshalRLP() ([]byte, error) {
+	var stemDiffs []byte
+	for i := range sd {
+		var suffixDiffs []byte
+		for _, suffixDiff := range sd[i].SuffixDiffs {
+			suffixDiffs = rlpAppendList(suffixDiffs,
+				rlpAppendByte(nil, suffixDiff.Suffix),
+				rlpAppendOptional(nil, suffixDiff.CurrentValue),
+				rlpAppendOptional(nil, suffixDiff.NewValue))
+		}
+		stemDiffs = rlpAppendList(stemDiffs,
+			rlpAppendString(nil, sd[i].Stem[:]),
+			rlpAppendList(nil, suffixDiffs))
+	}
+	return rlpAppendList(nil, stemDiffs), nil
+}
+
+// EncodeRLP writes the RLP encoding of the state diff to w. Its
+// signature makes StateDiff usable with geth's rlp package.
+func (sd StateDiff) EncodeRLP(w io.Writer) error {
+	encoded, err := sd.MarshalRLP()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// UnmarshalRLP decodes the RLP encoding of a state diff.
+func (sd *StateDiff) UnmarshalRLP(buf []byte) error {
+	content, err := rlpList(buf)
+	if err != nil {
+		return err
+	}
+	stemDiffs, err := rlpLists(content)
+	if err != nil {
+		return err
+	}
+	diff := make(StateDiff, len(stemDiffs))
+	for i, stemDiff := range stemDiffs {
+		_, stem, rest, err := rlpSplit(stemDiff)
+		if err != nil {
+			return err
+		}
+		if err := rlpReadFixed(diff[i].Stem[:], stem); err != nil {
+			return err
+		}
+		suffixContent, err := rlpList(rest)
+		if err != nil {
+			return err
+		}
+		suffixDiffs, err := rlpLists(suffixContent)
+		if err != nil {
+			return err
+		}
+		diff[i].SuffixDiffs = make(SuffixStateDiffs, len(suffixDiffs))
+		for j, suffixDiff := range suffixDiffs {
+			fields, err := rlpStrings(suffixDiff)
+			if err != nil {
+				return err
+			}
+			if len(fields) != 3 {
+				return errRLPInvalid
+			}
+			if diff[i].SuffixDiffs[j].Suffix, err = rlpReadByte(fields[0]); err != nil {
+				return err
+			}
+			if diff[i].SuffixDiffs[j].CurrentValue, err = rlpReadOptional(fields[1]); err != nil {
+				return err
+			}
+			if diff[i].SuffixDiffs[j].NewValue, err = rlpReadOptional(fields[2]); err != nil {
+				return err
+			}
+		}
+	}
+	*sd = diff
+	return nil
+}
@@ -0,0 +1,135 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRLPProofRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(keys[0], fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	postroot.Commit()
+
+	proveKeys := [][]byte{keys[0], keys[1], zeroKeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, proveKeys, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	vp, statediff, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatalf("error serializing proof: %v", err)
+	}
+
+	encoded, err := vp.MarshalRLP()
+	if err != nil {
+		t.Fatalf("error encoding proof: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := vp.EncodeRLP(&buf); err != nil {
+		t.Fatalf("error writing proof: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatal("EncodeRLP and MarshalRLP differ")
+	}
+	var decoded VerkleProof
+	if err := decoded.UnmarshalRLP(encoded); err != nil {
+		t.Fatalf("error decoding proof: %v", err)
+	}
+	if err := decoded.Equal(vp); err != nil {
+		t.Fatalf("decoded proof differs: %v", err)
+	}
+	if *decoded.IPAProof != *vp.IPAProof {
+		t.Fatal("decoded IPA proof differs")
+	}
+
+	encoded, err = statediff.MarshalRLP()
+	if err != nil {
+		t.Fatalf("error encoding state diff: %v", err)
+	}
+	var decodedDiff StateDiff
+	if err := decodedDiff.UnmarshalRLP(encoded); err != nil {
+		t.Fatalf("error decoding state diff: %v", err)
+	}
+	if err := decodedDiff.Equal(statediff); err != nil {
+		t.Fatalf("decoded state diff differs: %v", err)
+	}
+
+	if err := decodedDiff.UnmarshalRLP(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated state diff")
+	}
+}
+
+func TestRLPNodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, []byte{0}, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	encoded, err := SerializeNodeRLP(root)
+	if err != nil {
+		t.Fatalf("error encoding root: %v", err)
+	}
+	decoded, err := ParseNodeRLP(encoded, 0)
+	if err != nil {
+		t.Fatalf("error decoding root: %v", err)
+	}
+	if !decoded.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	for i, c := range decoded.(*InternalNode).children {
+		_, isEmpty := c.(Empty)
+		_, wasEmpty := root.(*InternalNode).children[i].(Empty)
+		if isEmpty != wasEmpty {
+			t.Fatalf("invalid child #%d: %T", i, c)
+		}
+	}
+
+	for _, idx := range []int{0, 64} {
+		leaf := root.(*InternalNode).children[idx].(*LeafNode)
+		encoded, err := SerializeNodeRLP(leaf)
+		if err != nil {
+			t.Fatalf("error encoding leaf: %v", err)
+		}
+		decoded, err := ParseNodeRLP(encoded, 1)
+		if err != nil {
+			t.Fatalf("error decoding leaf: %v", err)
+		}
+		dleaf := decoded.(*LeafNode)
+		if !dleaf.commitment.Equal(leaf.commitment) || !dleaf.c1.Equal(leaf.c1) || !dleaf.c2.Equal(leaf.c2) {
+			t.Fatal("invalid leaf commitments")
+		}
+		if dleaf.stem != leaf.stem {
+			t.Fatalf("invalid stem, got %x, expected %x", dleaf.stem, leaf.stem)
+		}
+		for i := range leaf.values {
+			if !bytes.Equal(leaf.values[i], dleaf.values[i]) || (leaf.values[i] == nil) != (dleaf.values[i] == nil) {
+				t.Fatalf("invalid value #%d: got %x, expected %x", i, dleaf.values[i], leaf.values[i])
+			}
+		}
+	}
+
+	if _, err := ParseNodeRLP(encoded[:len(encoded)-1], 0); err == nil {
+		t.Fatal("expected an error decoding a truncated node")
+	}
+}
@@ -0,0 +1,686 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// SSZ encoding of the proof structures, following the containers defined
+// in EIP-6800, as well as of tree nodes. Group elements are encoded in
+// their 32-byte compressed form. Optional values are merkleized as a
+// Union[None, Bytes32].
+//
+//	SuffixStateDiff: {suffix: uint8, currentValue: Optional[Bytes32], newValue: Optional[Bytes32]}
+//	StemStateDiff:   {stem: Bytes31, suffixDiffs: List[SuffixStateDiff, 256]}
+//	StateDiff:       List[StemStateDiff, MAX_STEMS]
+//	IPAProof:        {cl: Vector[Bytes32, 8], cr: Vector[Bytes32, 8], finalEvaluation: Bytes32}
+//	VerkleProof:     {otherStems: List[Bytes31, MAX_STEMS], depthExtensionPresent: ByteList[MAX_STEMS],
+//	                  commitmentsByPath: List[Bytes32, MAX_STEMS*MAX_COMMITMENTS_PER_STEM], d: Bytes32,
+//	                  ipaProof: IPAProof}
+//	ExecutionWitness: {stateDiff: StateDiff, verkleProof: VerkleProof}
+//	InternalNode:    {bitlist: Bitvector[256], commitment: Bytes32}
+//	LeafNode:        {stem: Bytes31, commitment: Bytes32, c1: Bytes32, c2: Bytes32,
+//	                  values: List[{suffix: uint8, value: Bytes32}, 256]}
+//	Node:            Union[InternalNode, LeafNode]
+//
+// Extension-of-account and single-slot leaves don't have a dedicated SSZ
+// container, they are encoded as any other LeafNode.
+
+const (
+	sszOffsetSize           = 4
+	sszMaxStems             = 1 << 16
+	sszMaxCommsPerStem      = 33
+	sszOptionalNone    byte = 0
+	sszOptionalSome    byte = 1
+
+	sszIPAProofSize     = 2*IPA_PROOF_DEPTH*32 + 32
+	sszVerkleProofFixed = 3*sszOffsetSize + 32 + sszIPAProofSize
+	sszWitnessFixed     = 2 * sszOffsetSize
+	sszSuffixDiffFixed  = 1 + 2*sszOffsetSize
+	sszStemDiffFixed    = StemSize + sszOffsetSize
+	sszInternalNodeSize = bitlistSize + 32
+	sszLeafNodeFixed    = StemSize + 3*32 + sszOffsetSize
+	sszLeafValueSize    = 1 + LeafValueSize
+	sszNodeSelectorSize = 1
+	sszInternalSelector = byte(0)
+	sszLeafNodeSelector = byte(1)
+)
+
+const sszTooManyItemsError = "too many %s: %d > %d"
+
+var errSSZInvalidOffset = errors.New("invalid ssz offset")
+
+func sszAppendOffset(dst []byte, offset int) []byte {
+	return binary.LittleEndian.AppendUint32(dst, uint32(offset))
+}
+
+// sszReadOffsets reads the offsets found in a fixed part, and checks that
+// they are sorted and within bounds. The first offset must be equal to
+// fixedSize.
+func sszReadOffsets(buf []byte, positions []int, fixedSize int) ([]int, error) {
+	offsets := make([]int, len(positions)+1)
+	for i, pos := range positions {
+		offsets[i] = int(binary.LittleEndian.Uint32(buf[pos:]))
+	}
+	offsets[len(positions)] = len(buf)
+	if len(positions) > 0 && offsets[0] != fixedSize {
+		return nil, errSSZInvalidOffset
+	}
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] || offsets[i] > len(buf) {
+			return nil, errSSZInvalidOffset
+		}
+	}
+	return offsets, nil
+}
+
+// sszSplitList splits a list of variable-size items into the encoding
+// of each item.
+func sszSplitList(buf []byte, maxItems int) ([][]byte, error) {
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if len(buf) < sszOffsetSize {
+		return nil, errSSZInvalidOffset
+	}
+	first := int(binary.LittleEndian.Uint32(buf))
+	if first%sszOffsetSize != 0 || first == 0 || first > len(buf) {
+		return nil, errSSZInvalidOffset
+	}
+	count := first / sszOffsetSize
+	if count > maxItems {
+		return nil, fmt.Errorf(sszTooManyItemsError, "items", count, maxItems)
+	}
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = i * sszOffsetSize
+	}
+	offsets, err := sszReadOffsets(buf, positions, first)
+	if err != nil {
+		return nil, err
+	}
+	items := make([][]byte, count)
+	for i := range items {
+		items[i] = buf[offsets[i]:offsets[i+1]]
+	}
+	return items, nil
+}
+
+// sszAppendList encodes a list of variable-size items.
+func sszAppendList(dst []byte, items [][]byte) []byte {
+	offset := len(items) * sszOffsetSize
+	for _, item := range items {
+		dst = sszAppendOffset(dst, offset)
+		offset += len(item)
+	}
+	for _, item := range items {
+		dst = append(dst, item...)
+	}
+	return dst
+}
+
+func sszAppendOptional(dst []byte, value *[32]byte) []byte {
+	if value == nil {
+		return append(dst, sszOptionalNone)
+	}
+	dst = append(dst, sszOptionalSome)
+	return append(dst, value[:]...)
+}
+
+func sszReadOptional(buf []byte) (*[32]byte, error) {
+	switch {
+	case len(buf) == 1 && buf[0] == sszOptionalNone:
+		return nil, nil
+	case len(buf) == 33 && buf[0] == sszOptionalSome:
+		var value [32]byte
+		copy(value[:], buf[1:])
+		return &value, nil
+	default:
+		return nil, fmt.Errorf("invalid ssz optional value: %x", buf)
+	}
+}
+
+// SizeSSZ returns the length of the SSZ encoding of the suffix diff.
+func (ssd *SuffixStateDiff) SizeSSZ() int {
+	size := sszSuffixDiffFixed + 2
+	if ssd.CurrentValue != nil {
+		size += 32
+	}
+	if ssd.NewValue != nil {
+		size += 32
+	}
+	return size
+}
+
+// MarshalSSZ returns the SSZ encoding of the suffix diff.
+func (ssd *SuffixStateDiff) MarshalSSZ() ([]byte, error) {
+	dst := make([]byte, 0, ssd.SizeSSZ())
+	dst = append(dst, ssd.Suffix)
+	dst = sszAppendOffset(dst, sszSuffixDiffFixed)
+	if ssd.CurrentValue != nil {
+		dst = sszAppendOffset(dst, sszSuffixDiffFixed+33)
+	} else {
+		dst = sszAppendOffset(dst, sszSuffixDiffFixed+1)
+	}
+	dst = sszAppendOptional(dst, ssd.CurrentValue)
+	dst = sszAppendOptional(dst, ssd.NewValue)
+	return dst, nil
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of a suffix diff.
+func (ssd *SuffixStateDiff) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszSuffixDiffFixed {
+		return errSerializedPayloadTooShort
+	}
+	offsets, err := sszReadOffsets(buf, []int{1, 1 + sszOffsetSize}, sszSuffixDiffFixed)
+	if err != nil {
+		return err
+	}
+	current, err := sszReadOptional(buf[offsets[0]:offsets[1]])
+	if err != nil {
+		return fmt.Errorf("decoding current value: %w", err)
+	}
+	newValue, err := sszReadOptional(buf[offsets[1]:offsets[2]])
+	if err != nil {
+		return fmt.Errorf("decoding new value: %w", err)
+	}
+	*ssd = SuffixStateDiff{
+		Suffix:       buf[0],
+		CurrentValue: current,
+		NewValue:     newValue,
+	}
+	return nil
+}
+
+// MarshalSSZ returns the SSZ encoding of the stem diff.
+func (ssd *StemStateDiff) MarshalSSZ() ([]byte, error) {
+	if len(ssd.SuffixDiffs) > NodeWidth {
+		return nil, fmt.Errorf(sszTooManyItemsError, "suffix diffs", len(ssd.SuffixDiffs), NodeWidth)
+	}
+	items := make([][]byte, len(ssd.SuffixDiffs))
+	for i := range ssd.SuffixDiffs {
+		items[i], _ = ssd.SuffixDiffs[i].MarshalSSZ()
+	}
+	dst := make([]byte, 0, sszStemDiffFixed+len(items)*(sszOffsetSize+sszSuffixDiffFixed+2+64))
+	dst = append(dst, ssd.Stem[:]...)
+	dst = sszAppendOffset(dst, sszStemDiffFixed)
+	return sszAppendList(dst, items), nil
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of a stem diff.
+func (ssd *StemStateDiff) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszStemDiffFixed {
+		return errSerializedPayloadTooShort
+	}
+	offsets, err := sszReadOffsets(buf, []int{StemSize}, sszStemDiffFixed)
+	if err != nil {
+		return err
+	}
+	items, err := sszSplitList(buf[offsets[0]:], NodeWidth)
+	if err != nil {
+		return fmt.Errorf("decoding suffix diffs: %w", err)
+	}
+	*ssd = StemStateDiff{SuffixDiffs: make(SuffixStateDiffs, len(items))}
+	copy(ssd.Stem[:], buf[:StemSize])
+	for i, item := range items {
+		if err := ssd.SuffixDiffs[i].UnmarshalSSZ(item); err != nil {
+			return fmt.Errorf("decoding suffix diff #%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// MarshalSSZ returns the SSZ encoding of the state diff.
+func (sd StateDiff) MarshalSSZ() ([]byte, error) {
+	if len(sd) > sszMaxStems {
+		return nil, fmt.Errorf(sszTooManyItemsError, "stem diffs", len(sd), sszMaxStems)
+	}
+	items := make([][]byte, len(sd))
+	for i := range sd {
+		var err error
+		if items[i], err = sd[i].MarshalSSZ(); err != nil {
+			return nil, err
+		}
+	}
+	return sszAppendList(nil, items), nil
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of a state diff.
+func (sd *StateDiff) UnmarshalSSZ(buf []byte) error {
+	items, err := sszSplitList(buf, sszMaxStems)
+	if err != nil {
+		return fmt.Errorf("decoding stem diffs: %w", err)
+	}
+	diff := make(StateDiff, len(items))
+	for i, item := range items {
+		if err := diff[i].UnmarshalSSZ(item); err != nil {
+			return fmt.Errorf("decoding stem diff #%d: %w", i, err)
+		}
+	}
+	*sd = diff
+	return nil
+}
+
+// SizeSSZ returns the length of the SSZ encoding of the IPA proof.
+func (ipp *IPAProof) SizeSSZ() int {
+	return sszIPAProofSize
+}
+
+// MarshalSSZ returns the SSZ encoding of the IPA proof.
+func (ipp *IPAProof) MarshalSSZ() ([]byte, error) {
+	return ipp.appendSSZ(make([]byte, 0, sszIPAProofSize)), nil
+}
+
+func (ipp *IPAProof) appendSSZ(dst []byte) []byte {
+	for i := range ipp.CL {
+		dst = append(dst, ipp.CL[i][:]...)
+	}
+	for i := range ipp.CR {
+		dst = append(dst, ipp.CR[i][:]...)
+	}
+	return append(dst, ipp.FinalEvaluation[:]...)
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of an IPA proof.
+func (ipp *IPAProof) UnmarshalSSZ(buf []byte) error {
+	if len(buf) != sszIPAProofSize {
+		return fmt.Errorf("invalid ssz IPA proof size %d, expected %d", len(buf), sszIPAProofSize)
+	}
+	for i := range ipp.CL {
+		copy(ipp.CL[i][:], buf[i*32:])
+		copy(ipp.CR[i][:], buf[(IPA_PROOF_DEPTH+i)*32:])
+	}
+	copy(ipp.FinalEvaluation[:], buf[2*IPA_PROOF_DEPTH*32:])
+	return nil
+}
+
+// SizeSSZ returns the length of the SSZ encoding of the verkle proof.
+func (vp *VerkleProof) SizeSSZ() int {
+	return sszVerkleProofFixed + len(vp.OtherStems)*StemSize + len(vp.DepthExtensionPresent) + len(vp.CommitmentsByPath)*32
+}
+
+// MarshalSSZ returns the SSZ encoding of the verkle proof.
+func (vp *VerkleProof) MarshalSSZ() ([]byte, error) {
+	if len(vp.OtherStems) > sszMaxStems {
+		return nil, fmt.Errorf(sszTooManyItemsError, "other stems", len(vp.OtherStems), sszMaxStems)
+	}
+	if len(vp.DepthExtensionPresent) > sszMaxStems {
+		return nil, fmt.Errorf(sszTooManyItemsError, "extension statuses", len(vp.DepthExtensionPresent), sszMaxStems)
+	}
+	if len(vp.CommitmentsByPath) > sszMaxStems*sszMaxCommsPerStem {
+		return nil, fmt.Errorf(sszTooManyItemsError, "commitments", len(vp.CommitmentsByPath), sszMaxStems*sszMaxCommsPerStem)
+	}
+	if vp.IPAProof == nil {
+		return nil, errors.New("missing IPA proof")
+	}
+
+	dst := make([]byte, 0, vp.SizeSSZ())
+	offset := sszVerkleProofFixed
+	dst = sszAppendOffset(dst, offset)
+	offset += len(vp.OtherStems) * StemSize
+	dst = sszAppendOffset(dst, offset)
+	offset += len(vp.DepthExtensionPresent)
+	dst = sszAppendOffset(dst, offset)
+	dst = append(dst, vp.D[:]...)
+	dst = vp.IPAProof.appendSSZ(dst)
+	for i := range vp.OtherStems {
+		dst = append(dst, vp.OtherStems[i][:]...)
+	}
+	dst = append(dst, vp.DepthExtensionPresent...)
+	for i := range vp.CommitmentsByPath {
+		dst = append(dst, vp.CommitmentsByPath[i][:]...)
+	}
+	return dst, nil
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of a verkle proof.
+func (vp *VerkleProof) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszVerkleProofFixed {
+		return errSerializedPayloadTooShort
+	}
+	offsets, err := sszReadOffsets(buf, []int{0, sszOffsetSize, 2 * sszOffsetSize}, sszVerkleProofFixed)
+	if err != nil {
+		return err
+	}
+	stems, esses, comms := buf[offsets[0]:offsets[1]], buf[offsets[1]:offsets[2]], buf[offsets[2]:offsets[3]]
+	if len(stems)%StemSize != 0 || len(stems)/StemSize > sszMaxStems {
+		return fmt.Errorf("invalid ssz other stems length %d", len(stems))
+	}
+	if len(esses) > sszMaxStems {
+		return fmt.Errorf("invalid ssz extension statuses length %d", len(esses))
+	}
+	if len(comms)%32 != 0 || len(comms)/32 > sszMaxStems*sszMaxCommsPerStem {
+		return fmt.Errorf("invalid ssz commitments length %d", len(comms))
+	}
+
+	proof := VerkleProof{
+		OtherStems:            make([][StemSize]byte, len(stems)/StemSize),
+		DepthExtensionPresent: make([]byte, len(esses)),
+		CommitmentsByPath:     make([][32]byte, len(comms)/32),
+		IPAProof:              &IPAProof{},
+	}
+	copy(proof.D[:], buf[3*sszOffsetSize:])
+	if err := proof.IPAProof.UnmarshalSSZ(buf[3*sszOffsetSize+32 : sszVerkleProofFixed]); err != nil {
+		return err
+	}
+	for i := range proof.OtherStems {
+		copy(proof.OtherStems[i][:], stems[i*StemSize:])
+	}
+	copy(proof.DepthExtensionPresent, esses)
+	for i := range proof.CommitmentsByPath {
+		copy(proof.CommitmentsByPath[i][:], comms[i*32:])
+	}
+	*vp = proof
+	return nil
+}
+
+// MarshalSSZ returns the SSZ encoding of the execution witness.
+func (ew *ExecutionWitness) MarshalSSZ() ([]byte, error) {
+	if ew.VerkleProof == nil {
+		return nil, errWitnessMissingProof
+	}
+	sd, err := ew.StateDiff.MarshalSSZ()
+	if err != nil {
+		return nil, fmt.Errorf("encoding state diff: %w", err)
+	}
+	vp, err := ew.VerkleProof.MarshalSSZ()
+	if err != nil {
+		return nil, fmt.Errorf("encoding proof: %w", err)
+	}
+	dst := make([]byte, 0, sszWitnessFixed+len(sd)+len(vp))
+	dst = sszAppendOffset(dst, sszWitnessFixed)
+	dst = sszAppendOffset(dst, sszWitnessFixed+len(sd))
+	dst = append(dst, sd...)
+	return append(dst, vp...), nil
+}
+
+// UnmarshalSSZ decodes the SSZ encoding of an execution witness.
+func (ew *ExecutionWitness) UnmarshalSSZ(buf []byte) error {
+	if len(buf) < sszWitnessFixed {
+		return errSerializedPayloadTooShort
+	}
+	offsets, err := sszReadOffsets(buf, []int{0, sszOffsetSize}, sszWitnessFixed)
+	if err != nil {
+		return err
+	}
+	var witness ExecutionWitness
+	if err := witness.StateDiff.UnmarshalSSZ(buf[offsets[0]:offsets[1]]); err != nil {
+		return fmt.Errorf("decoding state diff: %w", err)
+	}
+	witness.VerkleProof = &VerkleProof{}
+	if err := witness.VerkleProof.UnmarshalSSZ(buf[offsets[1]:offsets[2]]); err != nil {
+		return fmt.Errorf("decoding proof: %w", err)
+	}
+	*ew = witness
+	return nil
+}
+
+// sszZeroHashes[i] is the root of a tree of depth i whose leaves are all
+// zero chunks.
+var sszZeroHashes = func() (hashes [64][32]byte) {
+	for i := 1; i < len(hashes); i++ {
+		hashes[i] = sha256.Sum256(append(hashes[i-1][:], hashes[i-1][:]...))
+	}
+	return
+}()
+
+// sszMerkleize computes the root of chunks, virtually padded with zero
+// chunks up to the next power of two of limit.
+func sszMerkleize(chunks [][32]byte, limit int) [32]byte {
+	depth := 0
+	for 1<<depth < limit {
+		depth++
+	}
+	if len(chunks) == 0 {
+		return sszZeroHashes[depth]
+	}
+	layer := append([][32]byte{}, chunks...)
+	var pair [64]byte
+	for d := 0; d < depth; d++ {
+		if len(layer)%2 == 1 {
+			layer = append(layer, sszZeroHashes[d])
+		}
+		for i := 0; i < len(layer)/2; i++ {
+			copy(pair[:32], layer[2*i][:])
+			copy(pair[32:], layer[2*i+1][:])
+			layer[i] = sha256.Sum256(pair[:])
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
+
+func sszMixIn(root [32]byte, value int) [32]byte {
+	var buf [64]byte
+	copy(buf[:32], root[:])
+	binary.LittleEndian.PutUint64(buf[32:], uint64(value))
+	return sha256.Sum256(buf[:])
+}
+
+// sszPack splits data into zero-padded chunks.
+func sszPack(data []byte) [][32]byte {
+	chunks := make([][32]byte, (len(data)+31)/32)
+	for i := range chunks {
+		copy(chunks[i][:], data[i*32:])
+	}
+	return chunks
+}
+
+func sszOptionalRoot(value *[32]byte) [32]byte {
+	if value == nil {
+		return sszMixIn([32]byte{}, int(sszOptionalNone))
+	}
+	return sszMixIn(*value, int(sszOptionalSome))
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the suffix diff.
+func (ssd *SuffixStateDiff) HashTreeRoot() [32]byte {
+	return sszMerkleize([][32]byte{
+		{ssd.Suffix},
+		sszOptionalRoot(ssd.CurrentValue),
+		sszOptionalRoot(ssd.NewValue),
+	}, 3)
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the stem diff.
+func (ssd *StemStateDiff) HashTreeRoot() [32]byte {
+	roots := make([][32]byte, len(ssd.SuffixDiffs))
+	for i := range ssd.SuffixDiffs {
+		roots[i] = ssd.SuffixDiffs[i].HashTreeRoot()
+	}
+	return sszMerkleize([][32]byte{
+		sszPack(ssd.Stem[:])[0],
+		sszMixIn(sszMerkleize(roots, NodeWidth), len(roots)),
+	}, 2)
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the state diff.
+func (sd StateDiff) HashTreeRoot() [32]byte {
+	roots := make([][32]byte, len(sd))
+	for i := range sd {
+		roots[i] = sd[i].HashTreeRoot()
+	}
+	return sszMixIn(sszMerkleize(roots, sszMaxStems), len(roots))
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the IPA proof.
+func (ipp *IPAProof) HashTreeRoot() [32]byte {
+	return sszMerkleize([][32]byte{
+		sszMerkleize(ipp.CL[:], IPA_PROOF_DEPTH),
+		sszMerkleize(ipp.CR[:], IPA_PROOF_DEPTH),
+		ipp.FinalEvaluation,
+	}, 3)
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the verkle proof.
+func (vp *VerkleProof) HashTreeRoot() ([32]byte, error) {
+	if vp.IPAProof == nil {
+		return [32]byte{}, errors.New("missing IPA proof")
+	}
+	stems := make([][32]byte, len(vp.OtherStems))
+	for i := range vp.OtherStems {
+		copy(stems[i][:], vp.OtherStems[i][:])
+	}
+	return sszMerkleize([][32]byte{
+		sszMixIn(sszMerkleize(stems, sszMaxStems), len(stems)),
+		sszMixIn(sszMerkleize(sszPack(vp.DepthExtensionPresent), (sszMaxStems+31)/32), len(vp.DepthExtensionPresent)),
+		sszMixIn(sszMerkleize(vp.CommitmentsByPath, sszMaxStems*sszMaxCommsPerStem), len(vp.CommitmentsByPath)),
+		vp.D,
+		vp.IPAProof.HashTreeRoot(),
+	}, 5), nil
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the execution witness.
+func (ew *ExecutionWitness) HashTreeRoot() ([32]byte, error) {
+	if ew.VerkleProof == nil {
+		return [32]byte{}, errWitnessMissingProof
+	}
+	proofRoot, err := ew.VerkleProof.HashTreeRoot()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sszMerkleize([][32]byte{ew.StateDiff.HashTreeRoot(), proofRoot}, 2), nil
+}
+
+// SerializeNodeSSZ returns the SSZ encoding of an internal or leaf node.
+// The node must have been committed to.
+func SerializeNodeSSZ(node VerkleNode) ([]byte, error) {
+	switch n := node.(type) {
+	case *InternalNode:
+		dst := make([]byte, sszNodeSelectorSize+sszInternalNodeSize)
+		dst[0] = sszInternalSelector
+		for i, c := range n.children {
+			if _, ok := c.(Empty); !ok {
+				setBit(dst[sszNodeSelectorSize:], i)
+			}
+		}
+		comm := n.commitment.Bytes()
+		copy(dst[sszNodeSelectorSize+bitlistSize:], comm[:])
+		return dst, nil
+	case *LeafNode:
+		if n.isPOAStub {
+			return nil, ErrIsPOAStub
+		}
+		var count int
+		for _, v := range n.values {
+			if v != nil {
+				count++
+			}
+		}
+		c1, c2 := n.c1, n.c2
+		if c1 == nil {
+			c1 = new(Point).SetIdentity()
+		}
+		if c2 == nil {
+			c2 = new(Point).SetIdentity()
+		}
+		comms := [][32]byte{n.commitment.Bytes(), c1.Bytes(), c2.Bytes()}
+
+		dst := make([]byte, 0, sszNodeSelectorSize+sszLeafNodeFixed+count*sszLeafValueSize)
+		dst = append(dst, sszLeafNodeSelector)
+		dst = append(dst, n.stem[:StemSize]...)
+		for i := range comms {
+			dst = append(dst, comms[i][:]...)
+		}
+		dst = sszAppendOffset(dst, sszLeafNodeFixed)
+		for i, v := range n.values {
+			if v != nil {
+				var value [LeafValueSize]byte
+				copy(value[:], v)
+				dst = append(dst, byte(i))
+				dst = append(dst, value[:]...)
+			}
+		}
+		return dst, nil
+	default:
+		return nil, fmt.Errorf("can not ssz-encode node of type %T", node)
+	}
+}
+
+// ParseNodeSSZ decodes a node from its SSZ encoding, see SerializeNodeSSZ.
+func ParseNodeSSZ(buf []byte, depth byte) (VerkleNode, error) {
+	if len(buf) < sszNodeSelectorSize {
+		return nil, errSerializedPayloadTooShort
+	}
+	selector, buf := buf[0], buf[sszNodeSelectorSize:]
+	switch selector {
+	case sszInternalSelector:
+		if len(buf) != sszInternalNodeSize {
+			return nil, ErrInvalidNodeEncoding
+		}
+		node := newInternalNode(depth).(*InternalNode)
+		for i := range node.children {
+			if bit(buf[:bitlistSize], i) {
+				node.children[i] = HashedNode{}
+			}
+		}
+		if err := node.commitment.SetBytes(buf[bitlistSize:]); err != nil {
+			return nil, fmt.Errorf("setting commitment: %w", err)
+		}
+		return node, nil
+	case sszLeafNodeSelector:
+		if len(buf) < sszLeafNodeFixed {
+			return nil, errSerializedPayloadTooShort
+		}
+		offsets, err := sszReadOffsets(buf, []int{StemSize + 3*32}, sszLeafNodeFixed)
+		if err != nil {
+			return nil, err
+		}
+		values := buf[offsets[0]:]
+		if len(values)%sszLeafValueSize != 0 || len(values)/sszLeafValueSize > NodeWidth {
+			return nil, fmt.Errorf("invalid ssz leaf values length %d", len(values))
+		}
+
+		ln := &LeafNode{
+			values:     make([][]byte, NodeWidth),
+			commitment: new(Point),
+			c1:         new(Point),
+			c2:         new(Point),
+			depth:      depth,
+		}
+		copy(ln.stem[:], buf[:StemSize])
+		for i, p := range []*Point{ln.commitment, ln.c1, ln.c2} {
+			if err := p.SetBytes(buf[StemSize+i*32 : StemSize+(i+1)*32]); err != nil {
+				return nil, fmt.Errorf("setting commitment #%d: %w", i, err)
+			}
+		}
+		for i := 0; i < len(values); i += sszLeafValueSize {
+			suffix := values[i]
+			if ln.values[suffix] != nil {
+				return nil, fmt.Errorf("duplicate ssz leaf value for suffix %d", suffix)
+			}
+			ln.values[suffix] = make([]byte, LeafValueSize)
+			copy(ln.values[suffix], values[i+1:i+sszLeafValueSize])
+		}
+		return ln, nil
+	default:
+		return nil, ErrInvalidNodeEncoding
+	}
+}
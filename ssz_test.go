@@ -0,0 +1,211 @@
+package verkle
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestSSZProofRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(keys[0], fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	postroot.Commit()
+
+	// Prove an absent key as well, so that all optional fields are tested.
+	proveKeys := [][]byte{keys[0], keys[1], zeroKeyTest}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, proveKeys, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	vp, statediff, err := SerializeProof(proof)
+	if err != nil {
+		t.Fatalf("error serializing proof: %v", err)
+	}
+
+	encoded, err := vp.MarshalSSZ()
+	if err != nil {
+		t.Fatalf("error encoding proof: %v", err)
+	}
+	if len(encoded) != vp.SizeSSZ() {
+		t.Fatalf("invalid ssz size, got %d, expected %d", len(encoded), vp.SizeSSZ())
+	}
+	var decoded VerkleProof
+	if err := decoded.UnmarshalSSZ(encoded); err != nil {
+		t.Fatalf("error decoding proof: %v", err)
+	}
+	if err := decoded.Equal(vp); err != nil {
+		t.Fatalf("decoded proof differs: %v", err)
+	}
+	if *decoded.IPAProof != *vp.IPAProof {
+		t.Fatal("decoded IPA proof differs")
+	}
+
+	encoded, err = statediff.MarshalSSZ()
+	if err != nil {
+		t.Fatalf("error encoding state diff: %v", err)
+	}
+	var decodedDiff StateDiff
+	if err := decodedDiff.UnmarshalSSZ(encoded); err != nil {
+		t.Fatalf("error decoding state diff: %v", err)
+	}
+	if err := decodedDiff.Equal(statediff); err != nil {
+		t.Fatalf("decoded state diff differs: %v", err)
+	}
+
+	// Truncated payloads must be rejected.
+	if err := decodedDiff.UnmarshalSSZ(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("expected an error decoding a truncated state diff")
+	}
+}
+
+func TestSSZNodeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(oneKeyTest, testValue[:3], nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	encoded, err := SerializeNodeSSZ(root)
+	if err != nil {
+		t.Fatalf("error encoding root: %v", err)
+	}
+	decoded, err := ParseNodeSSZ(encoded, 0)
+	if err != nil {
+		t.Fatalf("error decoding root: %v", err)
+	}
+	if !decoded.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	for i, c := range decoded.(*InternalNode).children {
+		_, isEmpty := c.(Empty)
+		_, wasEmpty := root.(*InternalNode).children[i].(Empty)
+		if isEmpty != wasEmpty {
+			t.Fatalf("invalid child #%d: %T", i, c)
+		}
+	}
+
+	for _, idx := range []int{0, 64} {
+		leaf := root.(*InternalNode).children[idx].(*LeafNode)
+		encoded, err := SerializeNodeSSZ(leaf)
+		if err != nil {
+			t.Fatalf("error encoding leaf: %v", err)
+		}
+		decoded, err := ParseNodeSSZ(encoded, 1)
+		if err != nil {
+			t.Fatalf("error decoding leaf: %v", err)
+		}
+		dleaf := decoded.(*LeafNode)
+		if !dleaf.commitment.Equal(leaf.commitment) || !dleaf.c1.Equal(leaf.c1) || !dleaf.c2.Equal(leaf.c2) {
+			t.Fatal("invalid leaf commitments")
+		}
+		if dleaf.stem != leaf.stem {
+			t.Fatalf("invalid stem, got %x, expected %x", dleaf.stem, leaf.stem)
+		}
+		for i := range leaf.values {
+			if (leaf.values[i] == nil) != (dleaf.values[i] == nil) {
+				t.Fatalf("invalid value #%d", i)
+			}
+		}
+	}
+}
+
+func TestSSZMerkleize(t *testing.T) {
+	t.Parallel()
+
+	a, b := [32]byte{1}, [32]byte{2}
+	if root := sszMerkleize([][32]byte{a}, 1); root != a {
+		t.Fatalf("invalid single chunk root %x", root)
+	}
+	if root, expected := sszMerkleize([][32]byte{a, b}, 2), sha256.Sum256(append(a[:], b[:]...)); root != expected {
+		t.Fatalf("invalid root, got %x, expected %x", root, expected)
+	}
+	// Padding with zero chunks up to the limit.
+	var zero [32]byte
+	left := sha256.Sum256(append(a[:], b[:]...))
+	right := sha256.Sum256(append(a[:], zero[:]...))
+	if root, expected := sszMerkleize([][32]byte{a, b, a}, 4), sha256.Sum256(append(left[:], right[:]...)); root != expected {
+		t.Fatalf("invalid root, got %x, expected %x", root, expected)
+	}
+	if root := sszMerkleize(nil, 4); root != sszMerkleize([][32]byte{zero, zero, zero, zero}, 4) {
+		t.Fatalf("invalid empty root %x", root)
+	}
+}
+
+func TestSSZHashTreeRoot(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 20)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{keys[0], keys[1], zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	witness, err := NewExecutionWitness(proof)
+	if err != nil {
+		t.Fatalf("error creating witness: %v", err)
+	}
+
+	// The IPA proof is a container of two vectors and a Bytes32.
+	ipp := witness.VerkleProof.IPAProof
+	expected := sszMerkleize([][32]byte{
+		sszMerkleize(ipp.CL[:], IPA_PROOF_DEPTH),
+		sszMerkleize(ipp.CR[:], IPA_PROOF_DEPTH),
+		ipp.FinalEvaluation,
+		{},
+	}, 4)
+	if got := ipp.HashTreeRoot(); got != expected {
+		t.Fatalf("invalid IPA proof root, got %x, expected %x", got, expected)
+	}
+
+	// Decoding and re-encoding must not change the root.
+	encoded, err := witness.MarshalSSZ()
+	if err != nil {
+		t.Fatalf("error encoding witness: %v", err)
+	}
+	var decoded ExecutionWitness
+	if err := decoded.UnmarshalSSZ(encoded); err != nil {
+		t.Fatalf("error decoding witness: %v", err)
+	}
+	r1, err := witness.HashTreeRoot()
+	if err != nil {
+		t.Fatalf("error computing root: %v", err)
+	}
+	r2, err := decoded.HashTreeRoot()
+	if err != nil {
+		t.Fatalf("error computing root: %v", err)
+	}
+	if r1 != r2 {
+		t.Fatalf("roots differ: %x != %x", r1, r2)
+	}
+
+	// Any change to the proof must change the root.
+	decoded.VerkleProof.DepthExtensionPresent[0] ^= 1
+	if r2, _ = decoded.HashTreeRoot(); r1 == r2 {
+		t.Fatal("root didn't change with the proof")
+	}
+}
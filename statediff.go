@@ -0,0 +1,105 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrStateDiffConflict is returned when merging two state diffs that
+// disagree on the value of a location.
+var ErrStateDiffConflict = errors.New("conflicting state diffs")
+
+// Sort puts the stem diffs in order of their stem, and the suffix diffs of
+// each stem in order of their suffix, which is the order they have in an
+// execution witness.
+func (sd StateDiff) Sort() {
+	sort.Slice(sd, func(i, j int) bool { return bytes.Compare(sd[i].Stem[:], sd[j].Stem[:]) < 0 })
+	for i := range sd {
+		sd[i].SuffixDiffs.Sort()
+	}
+}
+
+// Sort puts the suffix diffs in order of their suffix.
+func (ssd SuffixStateDiffs) Sort() {
+	sort.Slice(ssd, func(i, j int) bool { return ssd[i].Suffix < ssd[j].Suffix })
+}
+
+// Merge returns the sorted union of two state diffs made against the same
+// pre-state, e.g. by different transactions of a block. A location found in
+// both must have the same current value in both, and at most one new value,
+// or the same one; otherwise ErrStateDiffConflict is returned. Neither
+// input is modified.
+func (sd StateDiff) Merge(other StateDiff) (StateDiff, error) {
+	merged := make(map[[StemSize]byte]map[byte]SuffixStateDiff, len(sd)+len(other))
+	for _, diff := range [2]StateDiff{sd, other} {
+		for _, stemdiff := range diff {
+			suffixes, ok := merged[stemdiff.Stem]
+			if !ok {
+				suffixes = make(map[byte]SuffixStateDiff, len(stemdiff.SuffixDiffs))
+				merged[stemdiff.Stem] = suffixes
+			}
+			for _, suffixdiff := range stemdiff.SuffixDiffs {
+				existing, ok := suffixes[suffixdiff.Suffix]
+				if !ok {
+					suffixes[suffixdiff.Suffix] = suffixdiff
+					continue
+				}
+				if !equalOptionalValues(existing.CurrentValue, suffixdiff.CurrentValue) {
+					return nil, fmt.Errorf("%w: different current values at stem %x, suffix %d", ErrStateDiffConflict, stemdiff.Stem, suffixdiff.Suffix)
+				}
+				switch {
+				case existing.NewValue == nil:
+					existing.NewValue = suffixdiff.NewValue
+				case suffixdiff.NewValue != nil && *existing.NewValue != *suffixdiff.NewValue:
+					return nil, fmt.Errorf("%w: different new values at stem %x, suffix %d", ErrStateDiffConflict, stemdiff.Stem, suffixdiff.Suffix)
+				}
+				suffixes[suffixdiff.Suffix] = existing
+			}
+		}
+	}
+
+	ret := make(StateDiff, 0, len(merged))
+	for stem, suffixes := range merged {
+		stemdiff := StemStateDiff{Stem: stem, SuffixDiffs: make(SuffixStateDiffs, 0, len(suffixes))}
+		for _, suffixdiff := range suffixes {
+			stemdiff.SuffixDiffs = append(stemdiff.SuffixDiffs, suffixdiff)
+		}
+		ret = append(ret, stemdiff)
+	}
+	ret.Sort()
+	return ret.Copy(), nil
+}
+
+func equalOptionalValues(a, b *[32]byte) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
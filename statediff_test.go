@@ -0,0 +1,52 @@
+package verkle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStateDiffMerge(t *testing.T) {
+	t.Parallel()
+
+	var stem1, stem2 [StemSize]byte
+	stem1[0], stem2[0] = 2, 1
+	one, two := &[32]byte{1}, &[32]byte{2}
+
+	tx1 := StateDiff{
+		{Stem: stem1, SuffixDiffs: SuffixStateDiffs{{Suffix: 5, CurrentValue: one, NewValue: two}, {Suffix: 1, CurrentValue: one}}},
+	}
+	tx2 := StateDiff{
+		{Stem: stem1, SuffixDiffs: SuffixStateDiffs{{Suffix: 1, CurrentValue: one, NewValue: two}, {Suffix: 5, CurrentValue: one}}},
+		{Stem: stem2, SuffixDiffs: SuffixStateDiffs{{Suffix: 0}}},
+	}
+	merged, err := tx1.Merge(tx2)
+	if err != nil {
+		t.Fatalf("error merging state diffs: %v", err)
+	}
+	expected := StateDiff{
+		{Stem: stem2, SuffixDiffs: SuffixStateDiffs{{Suffix: 0}}},
+		{Stem: stem1, SuffixDiffs: SuffixStateDiffs{{Suffix: 1, CurrentValue: one, NewValue: two}, {Suffix: 5, CurrentValue: one, NewValue: two}}},
+	}
+	if err := merged.Equal(expected); err != nil {
+		t.Fatalf("invalid merged state diff: %v", err)
+	}
+	// The inputs are left untouched.
+	if tx1[0].SuffixDiffs[0].Suffix != 5 || tx2[0].SuffixDiffs[1].NewValue != nil {
+		t.Fatal("merge modified its inputs")
+	}
+
+	// Two different writes to the same location conflict.
+	tx3 := StateDiff{
+		{Stem: stem1, SuffixDiffs: SuffixStateDiffs{{Suffix: 5, CurrentValue: one, NewValue: one}}},
+	}
+	if _, err := tx1.Merge(tx3); !errors.Is(err, ErrStateDiffConflict) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrStateDiffConflict)
+	}
+	// So do two different pre-state values.
+	tx4 := StateDiff{
+		{Stem: stem1, SuffixDiffs: SuffixStateDiffs{{Suffix: 1, CurrentValue: two}}},
+	}
+	if _, err := tx1.Merge(tx4); !errors.Is(err, ErrStateDiffConflict) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrStateDiffConflict)
+	}
+}
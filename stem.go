@@ -0,0 +1,94 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Stem is the first StemSize bytes of a key, that it shares with the
+// other keys of its leaf. Being a fixed-size array, it can't be mixed up
+// with a full key, and can be compared with == and used as a map key.
+type Stem [StemSize]byte
+
+// StemFromBytes returns the stem held in b, which must be exactly
+// StemSize bytes long.
+func StemFromBytes(b []byte) (Stem, error) {
+	if len(b) != StemSize {
+		return Stem{}, fmt.Errorf("invalid stem length %d, expected %d", len(b), StemSize)
+	}
+	return Stem(b), nil
+}
+
+// KeyToStem returns the stem of a key. It panics if the key is shorter
+// than a stem.
+func KeyToStem(key []byte) Stem {
+	if len(key) < StemSize {
+		panic(fmt.Errorf("key length (%d) is shorter than the expected stem size (%d)", len(key), StemSize))
+	}
+	return Stem(key)
+}
+
+// Key returns the key of the value found at suffix in the leaf of the
+// stem.
+func (s Stem) Key(suffix byte) []byte {
+	return append(s[:], suffix)
+}
+
+// Bytes returns a copy of the stem as a slice.
+func (s Stem) Bytes() []byte {
+	return append([]byte{}, s[:]...)
+}
+
+// Compare returns -1, 0 or 1 depending on whether s is lower than, equal
+// to, or greater than other in lexicographic order.
+func (s Stem) Compare(other Stem) int {
+	return bytes.Compare(s[:], other[:])
+}
+
+// HasPrefix reports whether the stem starts with the path prefix.
+func (s Stem) HasPrefix(prefix []byte) bool {
+	return bytes.HasPrefix(s[:], prefix)
+}
+
+// String returns the hexadecimal representation of the stem.
+func (s Stem) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// Format implements fmt.Formatter, so that the %x and %X verbs format
+// the bytes of the stem like they would a byte slice, instead of its
+// string representation.
+func (s Stem) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'x', 'X':
+		fmt.Fprintf(f, fmt.FormatString(f, verb), s[:])
+	default:
+		fmt.Fprintf(f, fmt.FormatString(f, verb), s.String())
+	}
+}
@@ -0,0 +1,50 @@
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	t.Parallel()
+
+	if _, err := StemFromBytes(zeroKeyTest); err == nil {
+		t.Fatal("expected an error creating a stem from a key")
+	}
+	zero, err := StemFromBytes(zeroKeyTest[:StemSize])
+	if err != nil {
+		t.Fatalf("error creating stem: %v", err)
+	}
+	if zero != KeyToStem(zeroKeyTest) {
+		t.Fatal("StemFromBytes and KeyToStem disagree")
+	}
+
+	fork := KeyToStem(forkOneKeyTest)
+	if zero.Compare(fork) >= 0 || fork.Compare(zero) <= 0 || fork.Compare(fork) != 0 {
+		t.Fatal("invalid stem order")
+	}
+	if !fork.HasPrefix([]byte{0, 1}) || fork.HasPrefix([]byte{0, 0}) {
+		t.Fatal("invalid stem prefix")
+	}
+	if !bytes.Equal(fork.Key(1), forkOneKeyTest) {
+		t.Fatalf("invalid key %x", fork.Key(1))
+	}
+
+	// The bytes of a stem don't alias it.
+	b := fork.Bytes()
+	b[0] = 0xff
+	if fork[0] != 0 {
+		t.Fatal("Bytes aliases the stem")
+	}
+
+	expected := fmt.Sprintf("%x", forkOneKeyTest[:StemSize])
+	for _, s := range []string{fmt.Sprintf("%x", fork), fmt.Sprintf("%v", fork), fork.String()} {
+		if s != expected {
+			t.Fatalf("invalid stem format %s, expected %s", s, expected)
+		}
+	}
+	if s := fmt.Sprintf("%#X", fork); s != fmt.Sprintf("%#X", forkOneKeyTest[:StemSize]) {
+		t.Fatalf("invalid stem format %s", s)
+	}
+}
@@ -0,0 +1,113 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// nodeStreamMaxFrameSize bounds the size of a frame read from a node stream,
+// so that a corrupted length doesn't trigger a huge allocation.
+const nodeStreamMaxFrameSize = 1 << 20
+
+// NodeStreamWriter writes serialized nodes to a stream, each one framed by
+// its length encoded as an unsigned varint.
+type NodeStreamWriter struct {
+	w     io.Writer
+	frame []byte
+}
+
+// NewNodeStreamWriter creates a writer that frames nodes into w.
+func NewNodeStreamWriter(w io.Writer) *NodeStreamWriter {
+	return &NodeStreamWriter{w: w}
+}
+
+// WriteSerialized writes an already serialized node.
+func (s *NodeStreamWriter) WriteSerialized(serialized []byte) error {
+	s.frame = binary.AppendUvarint(s.frame[:0], uint64(len(serialized)))
+	s.frame = append(s.frame, serialized...)
+	_, err := s.w.Write(s.frame)
+	return err
+}
+
+// WriteNode serializes a node and writes it.
+func (s *NodeStreamWriter) WriteNode(node VerkleNode) error {
+	serialized, err := node.Serialize()
+	if err != nil {
+		return err
+	}
+	return s.WriteSerialized(serialized)
+}
+
+// NodeStreamReader reads the nodes written by a NodeStreamWriter, one at a
+// time. The underlying reader is buffered, and may then be read past the
+// last frame that is returned.
+type NodeStreamReader struct {
+	r *bufio.Reader
+}
+
+// NewNodeStreamReader creates a reader of the nodes framed in r.
+func NewNodeStreamReader(r io.Reader) *NodeStreamReader {
+	return &NodeStreamReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next serialized node of the stream, or io.EOF if the
+// stream ends before a new frame starts. The returned slice is owned by
+// the caller.
+func (s *NodeStreamReader) Next() ([]byte, error) {
+	size, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading frame length: %w", err)
+	}
+	if size > nodeStreamMaxFrameSize {
+		return nil, fmt.Errorf("frame is too large: %d bytes", size)
+	}
+	serialized := make([]byte, size)
+	if _, err := io.ReadFull(s.r, serialized); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("reading frame: %w", err)
+	}
+	return serialized, nil
+}
+
+// ReadNode reads and deserializes the next node of the stream, which is
+// located at the given depth. It returns io.EOF at the end of the stream.
+func (s *NodeStreamReader) ReadNode(depth byte) (VerkleNode, error) {
+	serialized, err := s.Next()
+	if err != nil {
+		return nil, err
+	}
+	return ParseNodeUnsafe(serialized, depth)
+}
@@ -0,0 +1,55 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNodeStream(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(fourtyKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	root.Commit()
+
+	nodes := []VerkleNode{root, root.(*InternalNode).children[0], root.(*InternalNode).children[64]}
+	depths := []byte{0, 1, 1}
+	var stream bytes.Buffer
+	w := NewNodeStreamWriter(&stream)
+	for i, n := range nodes {
+		if err := w.WriteNode(n); err != nil {
+			t.Fatalf("error writing node #%d: %v", i, err)
+		}
+	}
+
+	r := NewNodeStreamReader(bytes.NewReader(stream.Bytes()))
+	for i, n := range nodes {
+		parsed, err := r.ReadNode(depths[i])
+		if err != nil {
+			t.Fatalf("error reading node #%d: %v", i, err)
+		}
+		if !parsed.Commitment().Equal(n.Commitment()) {
+			t.Fatalf("invalid commitment for node #%d", i)
+		}
+	}
+	if _, err := r.ReadNode(0); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	r = NewNodeStreamReader(bytes.NewReader(stream.Bytes()[:stream.Len()-1]))
+	for range nodes[:len(nodes)-1] {
+		if _, err := r.Next(); err != nil {
+			t.Fatalf("error reading frame: %v", err)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+}
@@ -31,7 +31,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"runtime"
+	"slices"
 	"sync"
 
 	"github.com/crate-crypto/go-ipa/banderwagon"
@@ -56,15 +58,12 @@ func (kl keylist) Swap(i, j int) {
 	kl[i], kl[j] = kl[j], kl[i]
 }
 
-type Stem []byte
-
-func KeyToStem(key []byte) Stem {
-	if len(key) < StemSize {
-		panic(fmt.Errorf("key length (%d) is shorter than the expected stem size (%d)", len(key), StemSize))
-	}
-	return Stem(key[:StemSize])
-}
-
+// VerkleNode is a node of the tree. Trees are not safe for concurrent
+// writes, but once a tree is committed, any number of goroutines can read
+// it and generate proofs from it, as long as no writer is active and the
+// nodes that are read are in memory: resolving a HashedNode stores the
+// resolved node in its parent, which is a write. Use ReadOnlyTree to
+// share a tree that relies on a resolver.
 type VerkleNode interface {
 	// Insert or Update value into the tree
 	Insert([]byte, []byte, NodeResolverFn) error
@@ -95,6 +94,14 @@ type VerkleNode interface {
 	// Serialize encodes the node to RLP.
 	Serialize() ([]byte, error)
 
+	// SerializeTo writes the serialized node to w, and
+	// returns the number of bytes written.
+	SerializeTo(io.Writer) (int, error)
+
+	// Size returns the length of the serialized node, so
+	// that callers can preallocate their buffers.
+	Size() int
+
 	// Copy a node and its children
 	Copy() VerkleNode
 
@@ -166,10 +173,11 @@ func (pe *ProofElements) Merge(other *ProofElements) {
 const (
 	// These types will distinguish internal
 	// and leaf nodes when decoding from RLP.
-	internalType   byte = 1
-	leafType       byte = 2
-	eoAccountType  byte = 3
-	singleSlotType byte = 4
+	internalType    byte = 1
+	leafType        byte = 2
+	eoAccountType   byte = 3
+	singleSlotType  byte = 4
+	flaggedLeafType byte = 5
 )
 
 type (
@@ -185,6 +193,14 @@ type (
 		commitment *Point
 
 		cow map[byte]*Point
+
+		// owner identifies the tree that is allowed to write to
+		// this node, see Snapshot.
+		owner *nodeOwner
+
+		// epoch is the last epoch in which the subtree was
+		// accessed, see ExpireBefore.
+		epoch StateEpoch
 	}
 
 	LeafNode struct {
@@ -200,7 +216,19 @@ type (
 		// for a steam that isn't present in the tree. This flag is only
 		// true in the context of a stateless tree.
 		isPOAStub bool
+
+		// owner identifies the tree that is allowed to write to
+		// this node, see Snapshot.
+		owner *nodeOwner
+
+		// epoch is the last epoch in which the leaf was
+		// accessed, see ExpireBefore.
+		epoch StateEpoch
 	}
+
+	// nodeOwner is a token that is shared by the root of a tree and
+	// the nodes that this tree can write to without copying them.
+	nodeOwner struct{ _ byte }
 )
 
 func (n *InternalNode) toExportable() *ExportableInternalNode {
@@ -299,10 +327,9 @@ func NewLeafNode(stem Stem, values [][]byte) (*LeafNode, error) {
 	c2 := cfg.CommitToPoly(c2poly[:], NodeWidth-count)
 
 	// Root commitment preparation for calculation.
-	stem = stem[:StemSize] // enforce a 31-byte length
 	var poly [NodeWidth]Fr
 	poly[0].SetUint64(1)
-	if err := StemFromLEBytes(&poly[1], stem); err != nil {
+	if err := StemFromLEBytes(&poly[1], stem[:]); err != nil {
 		return nil, err
 	}
 	if err := banderwagon.BatchMapToScalarField([]*Fr{&poly[2], &poly[3]}, []*Point{c1, c2}); err != nil {
@@ -358,30 +385,126 @@ func (n *InternalNode) cowChild(index byte) {
 	}
 }
 
+// Snapshot returns a logically independent copy of the tree, that shares
+// all its nodes with the original tree until they are written to. The
+// tree is committed first, and from then on each of the two trees copies
+// a shared node before it modifies it, so that the other tree isn't
+// affected. Resolving a hashed node is a write, so a tree and its
+// snapshots should not be used concurrently.
+func (n *InternalNode) Snapshot() *InternalNode {
+	n.Commit()
+	snap := &InternalNode{
+		children:   slices.Clone(n.children),
+		depth:      n.depth,
+		commitment: new(Point).Set(n.commitment),
+		owner:      new(nodeOwner),
+	}
+	n.owner = new(nodeOwner)
+	return snap
+}
+
+// writableChild makes sure that the child at the given index can be
+// modified, by replacing it with a shallow copy if it belongs to another
+// tree, and returns it.
+func (n *InternalNode) writableChild(index byte) VerkleNode {
+	switch child := n.children[index].(type) {
+	case *InternalNode:
+		if child.owner != n.owner {
+			c := &InternalNode{
+				children:   slices.Clone(child.children),
+				depth:      child.depth,
+				commitment: new(Point).Set(child.commitment),
+				owner:      n.owner,
+				epoch:      child.epoch,
+			}
+			if child.cow != nil {
+				c.cow = make(map[byte]*Point, len(child.cow))
+				for k, v := range child.cow {
+					c.cow[k] = new(Point).Set(v)
+				}
+			}
+			n.children[index] = c
+		}
+	case *LeafNode:
+		if child.owner != n.owner {
+			c := &LeafNode{
+				stem:      child.stem,
+				values:    slices.Clone(child.values),
+				depth:     child.depth,
+				isPOAStub: child.isPOAStub,
+				owner:     n.owner,
+				epoch:     child.epoch,
+			}
+			if child.commitment != nil {
+				c.commitment = new(Point).Set(child.commitment)
+			}
+			if child.c1 != nil {
+				c.c1 = new(Point).Set(child.c1)
+			}
+			if child.c2 != nil {
+				c.c2 = new(Point).Set(child.c2)
+			}
+			n.children[index] = c
+		}
+	}
+	return n.children[index]
+}
+
 func (n *InternalNode) Insert(key []byte, value []byte, resolver NodeResolverFn) error {
+	if len(key) != StemSize+1 {
+		return fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
 	values := make([][]byte, NodeWidth)
 	values[key[StemSize]] = value
 	return n.InsertValuesAtStem(KeyToStem(key), values, resolver)
 }
 
+// Swap inserts value at key and returns the value it replaced, or nil if
+// the key was absent, in a single traversal of the tree.
+func (n *InternalNode) Swap(key []byte, value []byte, resolver NodeResolverFn) ([]byte, error) {
+	if len(key) != StemSize+1 {
+		return nil, fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
+	values := make([][]byte, NodeWidth)
+	values[key[StemSize]] = value
+	prev := make([][]byte, NodeWidth)
+	if err := n.insertValuesAtStem(KeyToStem(key), values, resolver, prev); err != nil {
+		return nil, err
+	}
+	return prev[key[StemSize]], nil
+}
+
 func (n *InternalNode) InsertValuesAtStem(stem Stem, values [][]byte, resolver NodeResolverFn) error {
-	nChild := offset2key(stem, n.depth) // index of the child pointed by the next byte in the key
+	return n.insertValuesAtStem(stem, values, resolver, nil)
+}
 
-	switch child := n.children[nChild].(type) {
+// insertValuesAtStem inserts values at stem. If prev isn't nil, the values
+// that were present at the inserted suffixes are stored in it.
+func (n *InternalNode) insertValuesAtStem(stem Stem, values [][]byte, resolver NodeResolverFn, prev [][]byte) error {
+	if int(n.depth) >= StemSize {
+		return fmt.Errorf("%w: stem %x reached depth %d", ErrStemCollision, stem, n.depth)
+	}
+	nChild := offset2key(stem[:], n.depth) // index of the child pointed by the next byte in the key
+
+	switch child := n.writableChild(nChild).(type) {
 	case UnknownNode:
-		return errMissingNodeInStateless
+		return ErrMissingNodeInStateless
 	case Empty:
 		n.cowChild(nChild)
-		var err error
-		n.children[nChild], err = NewLeafNode(stem, values)
+		leaf, err := NewLeafNode(stem, values)
 		if err != nil {
 			return err
 		}
-		n.children[nChild].setDepth(n.depth + 1)
+		leaf.setDepth(n.depth + 1)
+		leaf.owner = n.owner
+		n.children[nChild] = leaf
 	case HashedNode:
 		if resolver == nil {
 			return errInsertIntoHash
 		}
+		if logEnabled(LogLevelDebug) {
+			log(LogLevelDebug, "resolving node for insertion", "path", stem[:n.depth+1])
+		}
 		serialized, err := resolver(stem[:n.depth+1])
 		if err != nil {
 			return fmt.Errorf("verkle tree: error resolving node %x at depth %d: %w", stem, n.depth, err)
@@ -394,31 +517,46 @@ func (n *InternalNode) InsertValuesAtStem(stem Stem, values [][]byte, resolver N
 		n.cowChild(nChild)
 		// recurse to handle the case of a LeafNode child that
 		// splits.
-		return n.InsertValuesAtStem(stem, values, resolver)
+		return n.insertValuesAtStem(stem, values, resolver, prev)
 	case *LeafNode:
-		if equalPaths(child.stem, stem) {
+		if child.stem == stem {
 			// We can't insert any values into a POA leaf node.
 			if child.isPOAStub {
-				return errIsPOAStub
+				return ErrIsPOAStub
 			}
 			n.cowChild(nChild)
+			if prev != nil {
+				for i, v := range values {
+					if v != nil {
+						prev[i] = child.values[i]
+					}
+				}
+			}
 			return child.insertMultiple(stem, values)
 		}
+		// Two distinct stems that share the path to this leaf differ
+		// at a deeper byte, so splitting ends before the maximum
+		// depth. A leaf that doesn't share that path, e.g. one from a
+		// corrupted resolver, could never be split apart.
+		if !bytes.Equal(child.stem[:n.depth+1], stem[:n.depth+1]) {
+			return fmt.Errorf("%w: leaf %x found at path %x", ErrStemCollision, child.stem, stem[:n.depth+1])
+		}
 		n.cowChild(nChild)
 
 		// A new branch node has to be inserted. Depending
 		// on the next word in both keys, a recursion into
 		// the moved leaf node can occur.
-		nextWordInExistingKey := offset2key(child.stem, n.depth+1)
+		nextWordInExistingKey := offset2key(child.stem[:], n.depth+1)
 		newBranch := newInternalNode(n.depth + 1).(*InternalNode)
+		newBranch.owner = n.owner
 		newBranch.cowChild(nextWordInExistingKey)
 		n.children[nChild] = newBranch
 		newBranch.children[nextWordInExistingKey] = child
 		child.depth += 1
 
-		nextWordInInsertedKey := offset2key(stem, n.depth+1)
+		nextWordInInsertedKey := offset2key(stem[:], n.depth+1)
 		if nextWordInInsertedKey == nextWordInExistingKey {
-			return newBranch.InsertValuesAtStem(stem, values, resolver)
+			return newBranch.insertValuesAtStem(stem, values, resolver, prev)
 		}
 
 		// Next word differs, so this was the last level.
@@ -428,11 +566,14 @@ func (n *InternalNode) InsertValuesAtStem(stem Stem, values [][]byte, resolver N
 			return err
 		}
 		leaf.setDepth(n.depth + 2)
+		leaf.owner = n.owner
 		newBranch.cowChild(nextWordInInsertedKey)
 		newBranch.children[nextWordInInsertedKey] = leaf
 	case *InternalNode:
 		n.cowChild(nChild)
-		return child.InsertValuesAtStem(stem, values, resolver)
+		return child.insertValuesAtStem(stem, values, resolver, prev)
+	case ExpiredNode:
+		return ErrExpired
 	default: // It should be an UknownNode.
 		return errUnknownNodeType
 	}
@@ -468,7 +609,7 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 			// insert poa stem
 			newchild := &LeafNode{
 				commitment: comms[0],
-				stem:       stemInfo.stem,
+				stem:       Stem(stemInfo.stem),
 				values:     nil,
 				depth:      n.depth + 1,
 				isPOAStub:  true,
@@ -485,7 +626,7 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 			// insert stem
 			newchild := &LeafNode{
 				commitment: comms[0],
-				stem:       stemInfo.stem,
+				stem:       Stem(stemInfo.stem),
 				values:     values,
 				depth:      n.depth + 1,
 			}
@@ -544,10 +685,13 @@ func (n *InternalNode) CreatePath(path []byte, stemInfo stemInfo, comms []*Point
 // The returned slice is internal to the tree, so it *must* be considered readonly
 // for callers.
 func (n *InternalNode) GetValuesAtStem(stem Stem, resolver NodeResolverFn) ([][]byte, error) {
-	nchild := offset2key(stem, n.depth) // index of the child pointed by the next byte in the key
+	if int(n.depth) >= StemSize {
+		return nil, fmt.Errorf("%w: stem %x reached depth %d", ErrStemCollision, stem, n.depth)
+	}
+	nchild := offset2key(stem[:], n.depth) // index of the child pointed by the next byte in the key
 	switch child := n.children[nchild].(type) {
 	case UnknownNode:
-		return nil, errMissingNodeInStateless
+		return nil, ErrMissingNodeInStateless
 	case Empty:
 		return nil, nil
 	case HashedNode:
@@ -567,25 +711,58 @@ func (n *InternalNode) GetValuesAtStem(stem Stem, resolver NodeResolverFn) ([][]
 		// splits.
 		return n.GetValuesAtStem(stem, resolver)
 	case *LeafNode:
-		if equalPaths(child.stem, stem) {
+		if child.stem == stem {
 			// We can't return the values since it's a POA leaf node, so we know nothing
 			// about its values.
 			if child.isPOAStub {
-				return nil, errIsPOAStub
+				return nil, ErrIsPOAStub
 			}
 			return child.values, nil
 		}
 		return nil, nil
 	case *InternalNode:
 		return child.GetValuesAtStem(stem, resolver)
+	case ExpiredNode:
+		return nil, ErrExpired
 	default:
 		return nil, errUnknownNodeType
 	}
 }
 
+// ExtractSubtree returns the root of the subtree that holds all the stems
+// starting with path, resolving hashed nodes along the way. If the path
+// leads to a leaf before its end, that leaf is returned if its stem starts
+// with path, and Empty is returned otherwise.
+func (n *InternalNode) ExtractSubtree(path []byte, resolver NodeResolverFn) (VerkleNode, error) {
+	if len(path) > StemSize {
+		return nil, fmt.Errorf("path %x is longer than a stem", path)
+	}
+	var node VerkleNode = n
+	for depth := range path {
+		internal, ok := node.(*InternalNode)
+		if !ok {
+			break
+		}
+		child, err := internal.resolveChild(path[:depth+1], resolver)
+		if err != nil {
+			return nil, err
+		}
+		node = child
+	}
+	switch node := node.(type) {
+	case *LeafNode:
+		if !bytes.HasPrefix(node.stem[:], path) {
+			return Empty{}, nil
+		}
+	case UnknownNode:
+		return nil, ErrMissingNodeInStateless
+	}
+	return node, nil
+}
+
 func (n *InternalNode) Delete(key []byte, resolver NodeResolverFn) (bool, error) {
 	nChild := offset2key(key, n.depth)
-	switch child := n.children[nChild].(type) {
+	switch child := n.writableChild(nChild).(type) {
 	case Empty:
 		return false, nil
 	case HashedNode:
@@ -636,7 +813,7 @@ func (n *InternalNode) Delete(key []byte, resolver NodeResolverFn) (bool, error)
 // that should only delete things that exist.
 func (n *InternalNode) DeleteAtStem(key []byte, resolver NodeResolverFn) (bool, error) {
 	nChild := offset2key(key, n.depth)
-	switch child := n.children[nChild].(type) {
+	switch child := n.writableChild(nChild).(type) {
 	case Empty:
 		return false, errDeleteMissing
 	case HashedNode:
@@ -655,7 +832,7 @@ func (n *InternalNode) DeleteAtStem(key []byte, resolver NodeResolverFn) (bool,
 		n.children[nChild] = c
 		return n.DeleteAtStem(key, resolver)
 	case *LeafNode:
-		if !bytes.Equal(child.stem, key[:31]) {
+		if !bytes.Equal(child.stem[:], key[:31]) {
 			return false, errDeleteMissing
 		}
 
@@ -721,8 +898,12 @@ func (n *InternalNode) Flush(flush NodeFlushFn) {
 	)
 
 	n.Commit()
+	if logEnabled(LogLevelDebug) {
+		log(LogLevelDebug, "flushing internal node", "depth", n.depth)
+	}
 	for i, child := range n.children {
-		if c, ok := child.(*InternalNode); ok {
+		if _, ok := child.(*InternalNode); ok {
+			c := n.writableChild(byte(i)).(*InternalNode)
 			c.Commit()
 			c.Flush(flushAndCapturePath)
 			n.children[i] = HashedNode{}
@@ -750,6 +931,7 @@ func (n *InternalNode) FlushAtDepth(depth uint8, flush NodeFlushFn) {
 			}
 			continue
 		}
+		c = n.writableChild(byte(i)).(*InternalNode)
 
 		// Not deep enough, recurse
 		if n.depth < depth {
@@ -757,7 +939,7 @@ func (n *InternalNode) FlushAtDepth(depth uint8, flush NodeFlushFn) {
 			continue
 		}
 
-		child.Commit()
+		c.Commit()
 		c.Flush(flush)
 		n.children[i] = HashedNode{}
 	}
@@ -783,6 +965,77 @@ func (n *InternalNode) Get(key []byte, resolver NodeResolverFn) ([]byte, error)
 	return stemValues[key[StemSize]], nil
 }
 
+// PathNode describes a node traversed by GetWithPath.
+type PathNode struct {
+	Path       []byte
+	Depth      byte
+	Stem       Stem // only set for leaves
+	Commitment *Point
+}
+
+// GetWithPath is like Get, and also returns the nodes traversed to reach
+// the key, from the root to the leaf or the empty child where the walk
+// stopped. The reported commitments are those computed by the last
+// call to Commit.
+func (n *InternalNode) GetWithPath(key []byte, resolver NodeResolverFn) ([]byte, []PathNode, error) {
+	if len(key) != StemSize+1 {
+		return nil, nil, fmt.Errorf("invalid key length, expected %d, got %d", StemSize+1, len(key))
+	}
+	var (
+		nodes    []PathNode
+		internal = n
+	)
+	for {
+		path := key[:internal.depth]
+		nodes = append(nodes, PathNode{
+			Path:       path,
+			Depth:      internal.depth,
+			Commitment: copyPoint(internal.commitment),
+		})
+		if int(internal.depth) >= StemSize {
+			return nil, nodes, fmt.Errorf("%w: stem %x reached depth %d", ErrStemCollision, key[:StemSize], internal.depth)
+		}
+		child, err := internal.resolveChild(key[:internal.depth+1], resolver)
+		if err != nil {
+			return nil, nodes, err
+		}
+		switch child := child.(type) {
+		case *InternalNode:
+			internal = child
+		case *LeafNode:
+			nodes = append(nodes, PathNode{
+				Path:       key[:child.depth],
+				Depth:      child.depth,
+				Stem:       child.stem,
+				Commitment: copyPoint(child.commitment),
+			})
+			if !equalPaths(child.stem[:], key) {
+				return nil, nodes, nil
+			}
+			if child.isPOAStub {
+				return nil, nodes, ErrIsPOAStub
+			}
+			return child.values[key[StemSize]], nodes, nil
+		case Empty:
+			return nil, nodes, nil
+		case UnknownNode:
+			return nil, nodes, ErrMissingNodeInStateless
+		case ExpiredNode:
+			return nil, nodes, ErrExpired
+		default:
+			return nil, nodes, errUnknownNodeType
+		}
+	}
+}
+
+// copyPoint returns a copy of p, or nil if p is nil.
+func copyPoint(p *Point) *Point {
+	if p == nil {
+		return nil
+	}
+	return new(Point).Set(p)
+}
+
 func (n *InternalNode) Hash() *Fr {
 	var hash Fr
 	n.Commitment().MapToScalarField(&hash)
@@ -807,6 +1060,17 @@ func (n *InternalNode) fillLevels(levels [][]*InternalNode) {
 }
 
 func (n *InternalNode) Commit() *Point {
+	return n.CommitParallel(runtime.NumCPU())
+}
+
+// CommitParallel is like Commit, but commits the nodes of each level of the
+// tree with at most workers goroutines. Nodes of the same level are
+// independent, so each goroutine maps all the commitments of its share of
+// the level to scalars in a single batch.
+func (n *InternalNode) CommitParallel(workers int) *Point {
+	if workers < 1 {
+		workers = 1
+	}
 	if len(n.cow) == 0 {
 		return n.commitment
 	}
@@ -819,6 +1083,9 @@ func (n *InternalNode) Commit() *Point {
 		if len(nodes) == 0 {
 			continue
 		}
+		if logEnabled(LogLevelDebug) {
+			log(LogLevelDebug, "committing internal nodes", "depth", level, "count", len(nodes))
+		}
 
 		minBatchSize := 4
 		if len(nodes) <= minBatchSize {
@@ -828,7 +1095,7 @@ func (n *InternalNode) Commit() *Point {
 			}
 		} else {
 			var wg sync.WaitGroup
-			numBatches := runtime.NumCPU()
+			numBatches := workers
 			batchSize := (len(nodes) + numBatches - 1) / numBatches
 			if batchSize < minBatchSize {
 				batchSize = minBatchSize
@@ -864,6 +1131,9 @@ func commitNodesAtLevel(nodes []*InternalNode) error {
 	// later.
 	for _, node := range nodes {
 		for idx, nodeChildComm := range node.cow {
+			if _, ok := node.children[idx].(UnknownNode); ok {
+				return fmt.Errorf("committing child %d at depth %d: %w", idx, node.depth, ErrMissingNodeInStateless)
+			}
 			points = append(points, nodeChildComm)
 			points = append(points, node.children[idx].Commitment())
 			cowIndexes = append(cowIndexes, int(idx))
@@ -1011,7 +1281,7 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 
 		if _, isunknown := n.children[childIdx].(UnknownNode); isunknown {
 			// TODO: add a test case to cover this scenario.
-			return nil, nil, nil, errMissingNodeInStateless
+			return nil, nil, nil, ErrMissingNodeInStateless
 		}
 
 		// Special case of a proof of absence: no children
@@ -1020,7 +1290,7 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 		if isempty {
 			addedStems := map[string]struct{}{}
 			for i := 0; i < len(group); i++ {
-				stemStr := string(KeyToStem(group[i]))
+				stemStr := string(group[i][:StemSize])
 				if _, ok := addedStems[stemStr]; !ok {
 					// A question arises here: what if this proof of absence
 					// corresponds to several stems? Should the ext status be
@@ -1049,9 +1319,14 @@ func (n *InternalNode) GetProofItems(keys keylist, resolver NodeResolverFn) (*Pr
 }
 
 // Serialize returns the serialized form of the internal node.
-// The format is: <nodeType><bitlist><commitment>
+// The format is: <version><nodeType><bitlist><commitment>
 func (n *InternalNode) Serialize() ([]byte, error) {
-	ret := make([]byte, nodeTypeSize+bitlistSize+banderwagon.UncompressedSize)
+	return n.appendSerialized(nil), nil
+}
+
+// appendSerialized appends the serialized internal node to dst.
+func (n *InternalNode) appendSerialized(dst []byte) []byte {
+	serialized, ret := appendSerializedNode(dst, nodeTypeSize+bitlistSize+banderwagon.UncompressedSize)
 
 	// Write the <bitlist>.
 	bitlist := ret[internalBitlistOffset:internalCommitmentOffset]
@@ -1068,14 +1343,25 @@ func (n *InternalNode) Serialize() ([]byte, error) {
 	comm := n.commitment.BytesUncompressedTrusted()
 	copy(ret[internalCommitmentOffset:], comm[:])
 
-	return ret, nil
+	return serialized
+}
+
+// SerializeTo writes the serialized internal node to w. The serialization
+// buffer is taken from a pool, so w must not retain it.
+func (n *InternalNode) SerializeTo(w io.Writer) (int, error) {
+	return writePooled(w, n.appendSerialized)
+}
+
+// Size returns the length of the serialized internal node.
+func (n *InternalNode) Size() int {
+	return nodeVersionSize + nodeTypeSize + bitlistSize + banderwagon.UncompressedSize
 }
 
 func (n *InternalNode) Copy() VerkleNode {
 	ret := &InternalNode{
-		children:   make([]VerkleNode, len(n.children)),
-		commitment: new(Point),
-		depth:      n.depth,
+		children: make([]VerkleNode, len(n.children)),
+		depth:    n.depth,
+		epoch:    n.epoch,
 	}
 
 	for i, child := range n.children {
@@ -1083,7 +1369,7 @@ func (n *InternalNode) Copy() VerkleNode {
 	}
 
 	if n.commitment != nil {
-		ret.commitment.Set(n.commitment)
+		ret.commitment = new(Point).Set(n.commitment)
 	}
 
 	if n.cow != nil {
@@ -1148,7 +1434,7 @@ func (n *InternalNode) touchCoW(index byte) {
 
 func (n *LeafNode) Insert(key []byte, value []byte, _ NodeResolverFn) error {
 	if n.isPOAStub {
-		return errIsPOAStub
+		return ErrIsPOAStub
 	}
 
 	if len(key) != StemSize+1 {
@@ -1156,7 +1442,7 @@ func (n *LeafNode) Insert(key []byte, value []byte, _ NodeResolverFn) error {
 	}
 
 	stem := KeyToStem(key)
-	if !bytes.Equal(stem, n.stem) {
+	if !bytes.Equal(stem[:], n.stem[:]) {
 		return fmt.Errorf("stems don't match: %x != %x", stem, n.stem)
 	}
 	values := make([][]byte, NodeWidth)
@@ -1166,7 +1452,7 @@ func (n *LeafNode) Insert(key []byte, value []byte, _ NodeResolverFn) error {
 
 func (n *LeafNode) insertMultiple(stem Stem, values [][]byte) error {
 	// Sanity check: ensure the stems are the same.
-	if !equalPaths(stem, n.stem) {
+	if stem != n.stem {
 		return errInsertIntoOtherStem
 	}
 
@@ -1317,9 +1603,12 @@ func (n *LeafNode) updateMultipleLeaves(values [][]byte) error { // skipcq: GO-R
 // return value, if the parent should entirely delete the child.
 func (n *LeafNode) Delete(k []byte, _ NodeResolverFn) (bool, error) {
 	// Sanity check: ensure the key header is the same:
-	if !equalPaths(k, n.stem) {
+	if !equalPaths(k, n.stem[:]) {
 		return false, nil
 	}
+	if n.isPOAStub {
+		return false, ErrIsPOAStub
+	}
 
 	// Erase the value it used to contain
 	original := n.values[k[StemSize]] // save original value
@@ -1408,10 +1697,10 @@ func (n *LeafNode) Delete(k []byte, _ NodeResolverFn) (bool, error) {
 
 func (n *LeafNode) Get(k []byte, _ NodeResolverFn) ([]byte, error) {
 	if n.isPOAStub {
-		return nil, errIsPOAStub
+		return nil, ErrIsPOAStub
 	}
 
-	if !equalPaths(k, n.stem) {
+	if !equalPaths(k, n.stem[:]) {
 		// If keys differ, return nil in order to
 		// signal that the key isn't present in the
 		// tree. Do not return an error, thus matching
@@ -1508,7 +1797,7 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 
 	// Initialize the top-level polynomial with 1 + stem + C1 + C2
 	poly[0].SetUint64(1)
-	if err := StemFromLEBytes(&poly[1], n.stem); err != nil {
+	if err := StemFromLEBytes(&poly[1], n.stem[:]); err != nil {
 		return nil, nil, nil, fmt.Errorf("error serializing stem '%x': %w", n.stem, err)
 	}
 
@@ -1518,7 +1807,7 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		// Note that keys might contain keys that don't correspond to this leaf node.
 		// We should only analize the inclusion of C1/C2 for keys corresponding to this
 		// leaf node stem.
-		if equalPaths(n.stem, key) {
+		if equalPaths(n.stem[:], key) {
 			hasC1 = hasC1 || (key[StemSize] < 128)
 			hasC2 = hasC2 || (key[StemSize] >= 128)
 			if hasC2 {
@@ -1561,7 +1850,7 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		pe.ByPath[string(key[:n.depth])] = n.commitment
 
 		// Proof of absence: case of a differing stem.
-		if !equalPaths(n.stem, key) {
+		if !equalPaths(n.stem[:], key) {
 			// If this is the first extension status added for this path,
 			// add the proof of absence stem (only once). If later we detect a proof of
 			// presence, we'll clear the list since that proof of presence
@@ -1572,7 +1861,7 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 			// Add an extension status absent other for this stem.
 			// Note we keep a cache to avoid adding the same stem twice (or more) if
 			// there're multiple keys with the same stem.
-			stemStr := string(KeyToStem(key))
+			stemStr := string(key[:StemSize])
 			if _, ok := addedStems[stemStr]; !ok {
 				esses = append(esses, extStatusAbsentOther|(n.depth<<3))
 				addedStems[stemStr] = struct{}{}
@@ -1628,7 +1917,7 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 		pe.Fis = append(pe.Fis, suffPoly[:], suffPoly[:])
 		pe.Vals = append(pe.Vals, n.values[key[StemSize]])
 
-		stemStr := string(KeyToStem(key))
+		stemStr := string(key[:StemSize])
 		if _, ok := addedStems[stemStr]; !ok {
 			esses = append(esses, extStatusPresent|(n.depth<<3))
 			addedStems[stemStr] = struct{}{}
@@ -1642,21 +1931,34 @@ func (n *LeafNode) GetProofItems(keys keylist, _ NodeResolverFn) (*ProofElements
 }
 
 // Serialize serializes a LeafNode.
-// The format is: <nodeType><stem><bitlist><comm><c1comm><c2comm><children...>
+// The format is: <version><nodeType><stem><bitlist><comm><c1comm><c2comm><children...>
 func (n *LeafNode) Serialize() ([]byte, error) {
+	return n.appendSerialized(nil), nil
+}
+
+// appendSerialized appends the serialized leaf node to dst.
+func (n *LeafNode) appendSerialized(dst []byte) []byte {
 	cBytes := banderwagon.BatchToBytesUncompressed(n.commitment, n.c1, n.c2)
-	return n.serializeLeafWithUncompressedCommitments(cBytes[0], cBytes[1], cBytes[2]), nil
+	return n.appendLeafWithUncompressedCommitments(dst, cBytes[0], cBytes[1], cBytes[2])
+}
+
+// SerializeTo writes the serialized leaf node to w. The serialization
+// buffer is taken from a pool, so w must not retain it.
+func (n *LeafNode) SerializeTo(w io.Writer) (int, error) {
+	return writePooled(w, n.appendSerialized)
 }
 
 func (n *LeafNode) Copy() VerkleNode {
 	l := &LeafNode{}
-	l.stem = make([]byte, len(n.stem))
-	l.values = make([][]byte, len(n.values))
+	if n.values != nil {
+		l.values = make([][]byte, len(n.values))
+	}
 	l.depth = n.depth
-	copy(l.stem, n.stem)
+	l.stem = n.stem
 	for i, v := range n.values {
-		l.values[i] = make([]byte, len(v))
-		copy(l.values[i], v)
+		if v != nil {
+			l.values[i] = append([]byte{}, v...)
+		}
 	}
 	if n.commitment != nil {
 		l.commitment = new(Point)
@@ -1671,13 +1973,14 @@ func (n *LeafNode) Copy() VerkleNode {
 		l.c2.Set(n.c2)
 	}
 	l.isPOAStub = n.isPOAStub
+	l.epoch = n.epoch
 
 	return l
 }
 
 func (n *LeafNode) Key(i int) []byte {
 	var ret [KeySize]byte
-	copy(ret[:], n.stem)
+	copy(ret[:], n.stem[:])
 	ret[StemSize] = byte(i)
 	return ret[:]
 }
@@ -1812,21 +2115,133 @@ func (n *InternalNode) collectNonHashedNodes(list []VerkleNode, paths [][]byte,
 	return list, paths
 }
 
+// Path is the sequence of child indices leading from the root of a tree to
+// one of its nodes.
+type Path []byte
+
+// BatchSerializeDirty commits the tree, and serializes all the nodes that were
+// modified since the last commit, so that the caller can write them to its
+// database in one batch. The i-th blob is the serialization of the node found
+// at the i-th path. Nodes are serialized in parallel.
+func (n *InternalNode) BatchSerializeDirty() ([]Path, [][]byte, error) {
+	// The set of dirty nodes has to be collected before committing, since
+	// committing resets it.
+	var (
+		nodes []VerkleNode
+		paths []Path
+	)
+	if len(n.cow) > 0 {
+		nodes, paths = n.collectDirtyNodes(nodes, paths, nil)
+	}
+	n.Commit()
+
+	blobs := make([][]byte, len(nodes))
+	numBatches := runtime.NumCPU()
+	batchSize := (len(nodes) + numBatches - 1) / numBatches
+	if batchSize < 16 {
+		batchSize = 16
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, (len(nodes)+batchSize-1)/batchSize)
+	)
+	for i := 0; i < len(nodes); i += batchSize {
+		start, end := i, i+batchSize
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[start/batchSize] = serializeNodesBatch(nodes[start:end], blobs[start:end])
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return paths, blobs, nil
+}
+
+// collectDirtyNodes gathers n and all its descendants that are referenced in
+// the copy-on-write map of their parent, in depth-first order.
+func (n *InternalNode) collectDirtyNodes(list []VerkleNode, paths []Path, path Path) ([]VerkleNode, []Path) {
+	list = append(list, n)
+	paths = append(paths, path)
+	for i, child := range n.children {
+		if _, ok := n.cow[byte(i)]; !ok {
+			continue
+		}
+		childpath := make(Path, len(path)+1)
+		copy(childpath, path)
+		childpath[len(path)] = byte(i)
+		switch childNode := child.(type) {
+		case *LeafNode:
+			list = append(list, childNode)
+			paths = append(paths, childpath)
+		case *InternalNode:
+			if len(childNode.cow) > 0 {
+				list, paths = childNode.collectDirtyNodes(list, paths, childpath)
+			} else {
+				list = append(list, childNode)
+				paths = append(paths, childpath)
+			}
+		}
+	}
+	return list, paths
+}
+
+// serializeNodesBatch serializes nodes into blobs, converting all their
+// commitments to affine form in a single batch.
+func serializeNodesBatch(nodes []VerkleNode, blobs [][]byte) error {
+	points := make([]*Point, 0, 3*len(nodes))
+	pointsIdx := make(map[VerkleNode]int, len(nodes))
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *InternalNode:
+			pointsIdx[node] = len(points)
+			points = append(points, node.commitment)
+		case *LeafNode:
+			points = append(points, node.commitment, node.c1, node.c2)
+		}
+	}
+	serializedPoints := banderwagon.BatchToBytesUncompressed(points...)
+
+	idx := 0
+	for i, node := range nodes {
+		switch node := node.(type) {
+		case *InternalNode:
+			serialized, err := node.serializeInternalWithUncompressedCommitment(pointsIdx, serializedPoints)
+			if err != nil {
+				return err
+			}
+			blobs[i] = serialized
+			idx++
+		case *LeafNode:
+			blobs[i] = node.serializeLeafWithUncompressedCommitments(serializedPoints[idx], serializedPoints[idx+1], serializedPoints[idx+2])
+			idx += 3
+		}
+	}
+	return nil
+}
+
 // unpack one compressed commitment from the list of batch-compressed commitments
 func (n *InternalNode) serializeInternalWithUncompressedCommitment(pointsIdx map[VerkleNode]int, serializedPoints [][banderwagon.UncompressedSize]byte) ([]byte, error) {
-	serialized := make([]byte, nodeTypeSize+bitlistSize+banderwagon.UncompressedSize)
-	bitlist := serialized[internalBitlistOffset:internalCommitmentOffset]
+	serialized, payload := newSerializedNode(nodeTypeSize + bitlistSize + banderwagon.UncompressedSize)
+	bitlist := payload[internalBitlistOffset:internalCommitmentOffset]
 	for i, c := range n.children {
 		if _, ok := c.(Empty); !ok {
 			setBit(bitlist, i)
 		}
 	}
-	serialized[nodeTypeOffset] = internalType
+	payload[nodeTypeOffset] = internalType
 	pointidx, ok := pointsIdx[n]
 	if !ok {
 		return nil, fmt.Errorf("child node not found in cache")
 	}
-	copy(serialized[internalCommitmentOffset:], serializedPoints[pointidx][:])
+	copy(payload[internalCommitmentOffset:], serializedPoints[pointidx][:])
 
 	return serialized, nil
 }
@@ -1836,26 +2251,18 @@ var (
 	EmptyCodeHash, _ = hex.DecodeString("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
 )
 
-func (n *LeafNode) serializeLeafWithUncompressedCommitments(cBytes, c1Bytes, c2Bytes [banderwagon.UncompressedSize]byte) []byte {
-	// Empty value in LeafNode used for padding.
-	var emptyValue [LeafValueSize]byte
-
-	// Create bitlist and store in children LeafValueSize (padded) values.
-	children := make([]byte, 0, NodeWidth*LeafValueSize)
-	var (
-		bitlist        [bitlistSize]byte
-		isEoA          = true
-		count, lastIdx int
-	)
+// leafEncoding returns the node type used to encode the leaf, as well
+// as the number of values it holds and the index of the last one.
+func (n *LeafNode) leafEncoding() (nodeType byte, count int, lastIdx int) {
+	isEoA := true
+	firstIdx := -1
 	for i, v := range n.values {
 		if v != nil {
+			if firstIdx < 0 {
+				firstIdx = i
+			}
 			count++
 			lastIdx = i
-			setBit(bitlist[:], i)
-			children = append(children, v...)
-			if padding := emptyValue[:LeafValueSize-len(v)]; len(padding) != 0 {
-				children = append(children, padding...)
-			}
 		}
 
 		if isEoA {
@@ -1873,12 +2280,46 @@ func (n *LeafNode) serializeLeafWithUncompressedCommitments(cBytes, c1Bytes, c2B
 		}
 	}
 
-	// Create the serialization.
-	var result []byte
 	switch {
 	case count == 1:
-		var buf [singleSlotLeafSize]byte
-		result = buf[:]
+		return singleSlotType, count, lastIdx
+	case isEoA:
+		return eoAccountType, count, lastIdx
+	case count > 0 && (lastIdx < NodeWidth/2 || firstIdx >= NodeWidth/2):
+		// One of C1 and C2 is the identity, and needn't be stored.
+		return flaggedLeafType, count, lastIdx
+	default:
+		return leafType, count, lastIdx
+	}
+}
+
+// Size returns the length of the serialized leaf node.
+func (n *LeafNode) Size() int {
+	nodeType, count, _ := n.leafEncoding()
+	switch nodeType {
+	case singleSlotType:
+		return nodeVersionSize + singleSlotLeafSize
+	case eoAccountType:
+		return nodeVersionSize + eoaLeafSize
+	case flaggedLeafType:
+		return nodeVersionSize + flaggedLeafCommitmentOffset + 2*banderwagon.UncompressedSize + count*LeafValueSize
+	default:
+		return nodeVersionSize + leafChildrenOffset + count*LeafValueSize
+	}
+}
+
+func (n *LeafNode) serializeLeafWithUncompressedCommitments(cBytes, c1Bytes, c2Bytes [banderwagon.UncompressedSize]byte) []byte {
+	return n.appendLeafWithUncompressedCommitments(nil, cBytes, c1Bytes, c2Bytes)
+}
+
+func (n *LeafNode) appendLeafWithUncompressedCommitments(dst []byte, cBytes, c1Bytes, c2Bytes [banderwagon.UncompressedSize]byte) []byte {
+	nodeType, count, lastIdx := n.leafEncoding()
+
+	// Create the serialization.
+	var serialized, result []byte
+	switch nodeType {
+	case singleSlotType:
+		serialized, result = appendSerializedNode(dst, singleSlotLeafSize)
 		result[0] = singleSlotType
 		copy(result[leafStemOffset:], n.stem[:StemSize])
 		if lastIdx < 128 {
@@ -1889,24 +2330,55 @@ func (n *LeafNode) serializeLeafWithUncompressedCommitments(cBytes, c1Bytes, c2B
 		copy(result[leafStemOffset+StemSize+banderwagon.UncompressedSize:], cBytes[:])
 		result[leafStemOffset+StemSize+2*banderwagon.UncompressedSize] = byte(lastIdx)
 		copy(result[leafStemOffset+StemSize+2*banderwagon.UncompressedSize+leafValueIndexSize:], n.values[lastIdx][:])
-	case isEoA:
-		var buf [eoaLeafSize]byte
-		result = buf[:]
+	case eoAccountType:
+		serialized, result = appendSerializedNode(dst, eoaLeafSize)
 		result[0] = eoAccountType
 		copy(result[leafStemOffset:], n.stem[:StemSize])
 		copy(result[leafStemOffset+StemSize:], c1Bytes[:])
 		copy(result[leafStemOffset+StemSize+banderwagon.UncompressedSize:], cBytes[:])
 		copy(result[leafStemOffset+StemSize+2*banderwagon.UncompressedSize:], n.values[0]) // copy basic data
+	case flaggedLeafType:
+		// Only one of C1 and C2 is stored, the other being the identity.
+		serialized, result = appendSerializedNode(dst, flaggedLeafCommitmentOffset+2*banderwagon.UncompressedSize+count*LeafValueSize)
+		result[0] = flaggedLeafType
+		copy(result[leafStemOffset:], n.stem[:StemSize])
+		copy(result[flaggedLeafCommitmentOffset:], cBytes[:])
+		if lastIdx < NodeWidth/2 {
+			result[flaggedLeafFlagsOffset] = leafC1Present
+			copy(result[flaggedLeafCommitmentOffset+banderwagon.UncompressedSize:], c1Bytes[:])
+		} else {
+			result[flaggedLeafFlagsOffset] = leafC2Present
+			copy(result[flaggedLeafCommitmentOffset+banderwagon.UncompressedSize:], c2Bytes[:])
+		}
+		bitlist := result[leafBitlistOffset:flaggedLeafFlagsOffset]
+		offset := flaggedLeafCommitmentOffset + 2*banderwagon.UncompressedSize
+		for i, v := range n.values {
+			if v != nil {
+				setBit(bitlist, i)
+				copy(result[offset:], v)
+				offset += LeafValueSize
+			}
+		}
 	default:
-		result = make([]byte, nodeTypeSize+StemSize+bitlistSize+3*banderwagon.UncompressedSize+len(children))
+		serialized, result = appendSerializedNode(dst, leafChildrenOffset+count*LeafValueSize)
 		result[0] = leafType
 		copy(result[leafStemOffset:], n.stem[:StemSize])
-		copy(result[leafBitlistOffset:], bitlist[:])
 		copy(result[leafCommitmentOffset:], cBytes[:])
 		copy(result[leafC1CommitmentOffset:], c1Bytes[:])
 		copy(result[leafC2CommitmentOffset:], c2Bytes[:])
-		copy(result[leafChildrenOffset:], children)
+
+		// Set the bitlist, and store the values (zero-padded to
+		// LeafValueSize) after the commitments.
+		bitlist := result[leafBitlistOffset:leafCommitmentOffset]
+		offset := leafChildrenOffset
+		for i, v := range n.values {
+			if v != nil {
+				setBit(bitlist, i)
+				copy(result[offset:], v)
+				offset += LeafValueSize
+			}
+		}
 	}
 
-	return result
+	return serialized
 }
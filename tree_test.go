@@ -39,6 +39,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"testing/quick"
 	"time"
@@ -174,6 +175,22 @@ func TestOffset2key8BitsWide(t *testing.T) {
 	}
 }
 
+func TestBitOffsetForDepth(t *testing.T) {
+	t.Parallel()
+
+	cfg := GetConfig()
+	key, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	for _, depth := range []byte{0, 1, 2, 7, 15, StemSize - 1} {
+		offset := cfg.BitOffsetForDepth(depth)
+		if offset != int(depth)*8 {
+			t.Fatalf("invalid bit offset for depth %d: %d != %d", depth, offset, int(depth)*8)
+		}
+		if key[offset/int(NodeBitWidth)] != offset2key(key, depth) {
+			t.Fatalf("bit offset %d doesn't match the child index at depth %d", offset, depth)
+		}
+	}
+}
+
 func TestFlush1kLeaves(t *testing.T) {
 	t.Parallel()
 
@@ -248,6 +265,57 @@ func TestCopy(t *testing.T) {
 	}
 }
 
+func TestCopyConcurrent(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeys(t, 40)
+	tree := New()
+	for _, k := range keys[:10] {
+		if err := tree.Insert(k, k, nil); err != nil {
+			t.Fatalf("inserting into the original failed: %v", err)
+		}
+	}
+	original := tree.Commit().Bytes()
+
+	// Build candidates from the same parent concurrently, each
+	// one in its own copy of the tree.
+	copies := make([]VerkleNode, 3)
+	var wg sync.WaitGroup
+	for i := range copies {
+		copies[i] = tree.Copy()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, k := range keys[10+10*i : 20+10*i] {
+				if err := copies[i].Insert(k, k, nil); err != nil {
+					panic(err)
+				}
+			}
+			if _, err := copies[i].Delete(keys[i], nil); err != nil {
+				panic(err)
+			}
+			copies[i].Commit()
+		}(i)
+	}
+	wg.Wait()
+
+	if tree.Commit().Bytes() != original {
+		t.Fatal("modifying the copies changed the original tree")
+	}
+	for i, c := range copies {
+		for j, k := range keys {
+			value, err := c.Get(k, nil)
+			if err != nil {
+				t.Fatalf("error getting from copy #%d: %v", i, err)
+			}
+			expected := (j < 10 && j != i) || (j >= 10+10*i && j < 20+10*i)
+			if expected != (value != nil) {
+				t.Fatalf("invalid presence of key #%d in copy #%d: %x", j, i, value)
+			}
+		}
+	}
+}
+
 func TestCachedCommitment(t *testing.T) {
 	t.Parallel()
 
@@ -837,7 +905,7 @@ func isInternalEqual(a, b *InternalNode) bool {
 }
 
 func isLeafEqual(a, b *LeafNode) bool {
-	if !bytes.Equal(a.stem, b.stem) {
+	if a.stem != b.stem {
 		return false
 	}
 
@@ -913,10 +981,10 @@ func TestGetResolveFromHash(t *testing.T) {
 func TestGetKey(t *testing.T) {
 	t.Parallel()
 
-	root := &LeafNode{stem: fourtyKeyTest}
+	root := &LeafNode{stem: KeyToStem(fourtyKeyTest)}
 	for i := 0; i < NodeWidth; i++ {
 		k := root.Key(i)
-		if !bytes.Equal(KeyToStem(k), KeyToStem(fourtyKeyTest)) {
+		if !bytes.Equal(k[:StemSize], fourtyKeyTest[:StemSize]) {
 			t.Fatal("invalid stem")
 		}
 		if int(k[StemSize]) != i {
@@ -1156,8 +1224,8 @@ func TestInsertStem(t *testing.T) {
 	r1c := root1.Commit()
 
 	var key5, key192 [KeySize]byte
-	copy(key5[:], KeyToStem(fourtyKeyTest))
-	copy(key192[:], KeyToStem(fourtyKeyTest))
+	copy(key5[:], fourtyKeyTest[:StemSize])
+	copy(key192[:], fourtyKeyTest[:StemSize])
 	key5[StemSize] = 5
 	key192[StemSize] = 192
 	if err := root2.Insert(key5[:], zeroKeyTest, nil); err != nil {
@@ -1261,7 +1329,7 @@ func TestInsertResolveSplitLeaf(t *testing.T) {
 	if !ok {
 		t.Fatal("resolve with resolver didn't produce a leaf node where expected")
 	}
-	if !bytes.Equal(l.stem, KeyToStem(zeroKeyTest)) && !bytes.Equal(l.values[0], ffx32KeyTest) {
+	if !bytes.Equal(l.stem[:], zeroKeyTest[:StemSize]) && !bytes.Equal(l.values[0], ffx32KeyTest) {
 		t.Fatal("didn't find the resolved leaf where expected")
 	}
 }
@@ -1403,7 +1471,7 @@ func BenchmarkEmptyHashCodeCachedPoint(b *testing.B) {
 			b.ReportAllocs()
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				_, _ = NewLeafNode(zeroKeyTest, values)
+				_, _ = NewLeafNode(KeyToStem(zeroKeyTest), values)
 			}
 		})
 	}
@@ -1421,7 +1489,7 @@ func TestEmptyHashCodeCachedPoint(t *testing.T) {
 	}
 	values := make([][]byte, NodeWidth)
 	values[CodeHashVectorPosition] = emptyHashCode
-	ln, _ := NewLeafNode(zeroKeyTest, values)
+	ln, _ := NewLeafNode(KeyToStem(zeroKeyTest), values)
 
 	// Compare the result (which used the cached point) with the expected result which was
 	// calculated by a previous version of the library that didn't use a cached point.
@@ -1483,7 +1551,7 @@ func TestBatchMigratedKeyValues(t *testing.T) {
 					}
 					for _, kv := range randomKeyValues[1:] {
 						stem := KeyToStem(kv.key)
-						if bytes.Equal(curr.Stem, stem) {
+						if bytes.Equal(curr.Stem[:], stem[:]) {
 							curr.Values[kv.key[StemSize]] = kv.value
 							continue
 						}
@@ -1575,7 +1643,7 @@ func BenchmarkBatchLeavesInsert(b *testing.B) {
 		}
 		for _, kv := range randomKeyValues[1:] {
 			stem := KeyToStem(kv.key)
-			if bytes.Equal(curr.Stem, stem) {
+			if bytes.Equal(curr.Stem[:], stem[:]) {
 				curr.Values[kv.key[StemSize]] = kv.value
 				continue
 			}
@@ -1616,7 +1684,7 @@ func TestManipulateChildren(t *testing.T) {
 	if !ok {
 		t.Fatalf("failed to get expected leaf node")
 	}
-	if !bytes.Equal(ln.stem, KeyToStem(ffx32KeyTest)) || !bytes.Equal(ln.values[NodeWidth-1], testValue) {
+	if !bytes.Equal(ln.stem[:], ffx32KeyTest[:StemSize]) || !bytes.Equal(ln.values[NodeWidth-1], testValue) {
 		t.Fatalf("failed to get expected leaf node stem and values")
 	}
 
@@ -1648,7 +1716,7 @@ func TestLeafNodeInsert(t *testing.T) {
 	}
 
 	// Check we get the value correctly via Get(...).
-	getValue, err := ln.Get(append(KeyToStem(keyTest), byte(valIdx)), nil)
+	getValue, err := ln.Get(append(keyTest[:StemSize], byte(valIdx)), nil)
 	if err != nil {
 		t.Fatalf("failed to get leaf node key/value: %v", err)
 	}
@@ -1683,7 +1751,7 @@ func TestLeafNodeInsert(t *testing.T) {
 	}
 
 	// Check wrong *key* length.
-	if err := ln.Insert(KeyToStem(ffx32KeyTest2), newValue, nil); err == nil {
+	if err := ln.Insert(ffx32KeyTest2[:StemSize], newValue, nil); err == nil {
 		t.Fatalf("key with size 31 should not be accepted, keys must have length StemSize+1")
 	}
 
@@ -1880,3 +1948,507 @@ func TestRandomExtracted(t *testing.T) {
 		t.Fatalf("got %x, expected %x", val, val_k1490_0)
 	}
 }
+
+func TestBatchSerializeDirty(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 50)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+
+	// In a fresh tree, every node is dirty.
+	paths, blobs, err := root.(*InternalNode).BatchSerializeDirty()
+	if err != nil {
+		t.Fatalf("error serializing tree: %v", err)
+	}
+	all, err := root.(*InternalNode).BatchSerialize()
+	if err != nil {
+		t.Fatalf("error serializing tree: %v", err)
+	}
+	if len(paths) != len(all) || len(blobs) != len(all) {
+		t.Fatalf("invalid number of dirty nodes, got %d, expected %d", len(paths), len(all))
+	}
+	for i := range all {
+		if !bytes.Equal(paths[i], all[i].Path) {
+			t.Fatalf("invalid path #%d, got %x, expected %x", i, paths[i], all[i].Path)
+		}
+		if !bytes.Equal(blobs[i], all[i].SerializedBytes) {
+			t.Fatalf("invalid serialization for node #%d", i)
+		}
+	}
+
+	// Once committed, only the nodes along the path of an update are dirty.
+	if paths, _, err := root.(*InternalNode).BatchSerializeDirty(); err != nil || len(paths) != 0 {
+		t.Fatalf("expected no dirty nodes, got %d (err=%v)", len(paths), err)
+	}
+	if err := root.Insert(keys[0], fourtyKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	paths, blobs, err = root.(*InternalNode).BatchSerializeDirty()
+	if err != nil {
+		t.Fatalf("error serializing tree: %v", err)
+	}
+	for i, path := range paths {
+		if !bytes.Equal(path, keys[0][:i]) {
+			t.Fatalf("invalid dirty path #%d: %x", i, path)
+		}
+	}
+	parsed, err := ParseNode(blobs[0], 0)
+	if err != nil {
+		t.Fatalf("error parsing root: %v", err)
+	}
+	if !parsed.Commitment().Equal(root.Commitment()) {
+		t.Fatal("invalid root commitment")
+	}
+	parsed, err = ParseNode(blobs[len(blobs)-1], byte(len(paths)-1))
+	if err != nil {
+		t.Fatalf("error parsing leaf: %v", err)
+	}
+	if leaf, ok := parsed.(*LeafNode); !ok || !bytes.Equal(leaf.values[keys[0][StemSize]], fourtyKeyTest) {
+		t.Fatalf("invalid dirty leaf: %v", parsed)
+	}
+}
+
+func TestCommitParallel(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeys(t, 2000)
+	var roots []*Point
+	for _, workers := range []int{0, 1, 3, 64} {
+		root := New()
+		for _, k := range keys {
+			if err := root.Insert(k, testValue, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		roots = append(roots, root.(*InternalNode).CommitParallel(workers))
+	}
+	expected := New()
+	for _, k := range keys {
+		if err := expected.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	expected.Commit()
+	for i, root := range roots {
+		if !root.Equal(expected.Commitment()) {
+			t.Fatalf("invalid root commitment #%d", i)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeys(t, 200)
+	build := func(keys [][]byte) VerkleNode {
+		root := New()
+		for _, k := range keys {
+			if err := root.Insert(k, k, nil); err != nil {
+				t.Fatalf("error inserting: %v", err)
+			}
+		}
+		return root
+	}
+	root := build(keys[:100]).(*InternalNode)
+	snap := root.Snapshot()
+	if !snap.Commitment().Equal(root.Commitment()) {
+		t.Fatal("snapshot has a different commitment")
+	}
+
+	// Write to both trees: the snapshot gets new keys, and the
+	// original tree loses some.
+	for _, k := range keys[100:] {
+		if err := snap.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	for _, k := range keys[:50] {
+		if _, err := root.Delete(k, nil); err != nil {
+			t.Fatalf("error deleting: %v", err)
+		}
+	}
+	// Deletions don't collapse the tree, so compare with
+	// the same deletions in a tree that was never shared.
+	expected := build(keys[:100])
+	for _, k := range keys[:50] {
+		if _, err := expected.Delete(k, nil); err != nil {
+			t.Fatalf("error deleting: %v", err)
+		}
+	}
+	if !root.Commit().Equal(expected.Commit()) {
+		t.Fatal("invalid commitment for the original tree")
+	}
+	if !snap.Commit().Equal(build(keys).Commit()) {
+		t.Fatal("invalid commitment for the snapshot")
+	}
+
+	// Flushing the original tree doesn't turn the nodes of the
+	// snapshot into hashed nodes.
+	root.Flush(func([]byte, VerkleNode) {})
+	for _, k := range keys {
+		value, err := snap.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", k, err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for %x: %x", k, value)
+		}
+	}
+}
+
+func TestSnapshotInsertMigratedLeaves(t *testing.T) {
+	t.Parallel()
+
+	keys := randomKeys(t, 200)
+	root := New().(*InternalNode)
+	for _, k := range keys[:100] {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	snap := root.Snapshot()
+	comm := new(Point).Set(root.Commitment())
+
+	// Migrate leaves at new stems, and at existing stems with new
+	// suffixes, so that both splits and leaf updates happen.
+	var migrated [][]byte
+	for _, k := range keys[100:] {
+		migrated = append(migrated, k)
+	}
+	for _, k := range keys[:50] {
+		migrated = append(migrated, append(k[:StemSize:StemSize], k[StemSize]+1))
+	}
+	data := make([]BatchNewLeafNodeData, 0, len(migrated))
+	for _, k := range migrated {
+		data = append(data, BatchNewLeafNodeData{Stem: KeyToStem(k), Values: map[byte][]byte{k[StemSize]: k}})
+	}
+	leaves, err := BatchNewLeafNode(data)
+	if err != nil {
+		t.Fatalf("error creating leaves: %v", err)
+	}
+	if err := snap.InsertMigratedLeaves(leaves, nil); err != nil {
+		t.Fatalf("error inserting migrated leaves: %v", err)
+	}
+	snap.Commit()
+
+	if !root.Commit().Equal(comm) {
+		t.Fatal("the original tree was modified")
+	}
+	for _, k := range keys[:100] {
+		value, err := root.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", k, err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for %x: %x", k, value)
+		}
+	}
+	for _, k := range migrated {
+		if value, err := root.Get(k, nil); err != nil || value != nil {
+			t.Fatalf("migrated key %x found in the original tree: %x, %v", k, value, err)
+		}
+		value, err := snap.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting %x: %v", k, err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for %x: %x", k, value)
+		}
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 200)
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for _, k := range keys {
+				value, err := root.Get(k, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(value, k) {
+					errs <- fmt.Errorf("invalid value for %x: %x", k, value)
+					return
+				}
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			proveKeys := append([][]byte{}, keys[i*20:i*20+20]...)
+			proof, _, _, _, err := MakeVerkleMultiProof(root, nil, proveKeys, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := verifyVerkleProofWithPreState(proof, root); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("error reading concurrently: %v", err)
+	}
+}
+
+func TestExtractSubtree(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, forkOneKeyTest, fourtyKeyTest} {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	db := map[string][]byte{}
+	root.(*InternalNode).Flush(func(path []byte, node VerkleNode) {
+		serialized, err := node.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		db[string(path)] = serialized
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		return db[string(path)], nil
+	}
+
+	subtree, err := root.(*InternalNode).ExtractSubtree([]byte{0}, resolver)
+	if err != nil {
+		t.Fatalf("error extracting subtree: %v", err)
+	}
+	internal, ok := subtree.(*InternalNode)
+	if !ok {
+		t.Fatalf("invalid subtree type %T", subtree)
+	}
+	if _, ok := internal.children[1].(HashedNode); !ok {
+		t.Fatalf("children were resolved needlessly: %T", internal.children[1])
+	}
+
+	// A path ending under a leaf returns the leaf if its stem matches.
+	leaf, err := root.(*InternalNode).ExtractSubtree(fourtyKeyTest[:3], resolver)
+	if err != nil {
+		t.Fatalf("error extracting subtree: %v", err)
+	}
+	if l, ok := leaf.(*LeafNode); !ok || !bytes.Equal(l.stem[:], fourtyKeyTest[:StemSize]) {
+		t.Fatalf("invalid leaf %v", leaf)
+	}
+	other, err := root.(*InternalNode).ExtractSubtree([]byte{0x40, 1}, resolver)
+	if err != nil {
+		t.Fatalf("error extracting subtree: %v", err)
+	}
+	if _, ok := other.(Empty); !ok {
+		t.Fatalf("expected an empty subtree, got %T", other)
+	}
+	if _, err := root.(*InternalNode).ExtractSubtree(make([]byte, KeySize), resolver); err == nil {
+		t.Fatal("expected an error for a path longer than a stem")
+	}
+}
+
+func TestStemCollision(t *testing.T) {
+	t.Parallel()
+
+	// Stems that only differ in their last byte split the tree down to
+	// the maximum depth.
+	var keys [][]byte
+	for _, last := range []byte{0, 1, 0xff} {
+		for _, suffix := range []byte{0, 0xff} {
+			key := make([]byte, KeySize)
+			key[StemSize-1] = last
+			key[StemSize] = suffix
+			keys = append(keys, key)
+		}
+	}
+	root := New()
+	for _, k := range keys {
+		if err := root.Insert(k, k, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	reversed := New()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := reversed.Insert(keys[i], keys[i], nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	if !root.Commit().Equal(reversed.Commit()) {
+		t.Fatal("insertion order changed the commitment")
+	}
+	for _, k := range keys {
+		value, err := root.Get(k, nil)
+		if err != nil {
+			t.Fatalf("error getting: %v", err)
+		}
+		if !bytes.Equal(value, k) {
+			t.Fatalf("invalid value for key %x: %x", k, value)
+		}
+	}
+	var node VerkleNode = root
+	for depth := 0; depth < StemSize; depth++ {
+		node = node.(*InternalNode).children[0]
+	}
+	if leaf, ok := node.(*LeafNode); !ok || leaf.depth != StemSize {
+		t.Fatalf("expected a leaf at depth %d, got %T", StemSize, node)
+	}
+
+	// A leaf that isn't under its path shares every byte but the
+	// first with the inserted stem: splitting it must fail rather than
+	// go past the maximum depth.
+	misplacedStem := make([]byte, StemSize)
+	misplacedStem[0] = 1
+	misplaced, err := NewLeafNode(KeyToStem(misplacedStem), make([][]byte, NodeWidth))
+	if err != nil {
+		t.Fatalf("error creating leaf: %v", err)
+	}
+	root = New()
+	root.(*InternalNode).children[0] = misplaced
+	if err := root.Insert(zeroKeyTest, testValue, nil); !errors.Is(err, ErrStemCollision) {
+		t.Fatalf("expected ErrStemCollision, got %v", err)
+	}
+	if leaf, ok := root.(*InternalNode).children[0].(*LeafNode); !ok || !bytes.Equal(leaf.stem[:], misplacedStem) {
+		t.Fatal("a failed insertion modified the tree")
+	}
+
+	if err := root.Insert(zeroKeyTest[:StemSize], testValue, nil); err == nil {
+		t.Fatal("expected an error inserting a short key")
+	}
+}
+
+func TestSwap(t *testing.T) {
+	t.Parallel()
+
+	root := New().(*InternalNode)
+	prev, err := root.Swap(zeroKeyTest, testValue, nil)
+	if err != nil {
+		t.Fatalf("error swapping: %v", err)
+	}
+	if prev != nil {
+		t.Fatalf("expected no previous value, got %x", prev)
+	}
+	// Splits the leaf of zeroKeyTest.
+	if _, err := root.Swap(forkOneKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error swapping: %v", err)
+	}
+	prev, err = root.Swap(zeroKeyTest, ffx32KeyTest, nil)
+	if err != nil {
+		t.Fatalf("error swapping: %v", err)
+	}
+	if !bytes.Equal(prev, testValue) {
+		t.Fatalf("invalid previous value %x", prev)
+	}
+	// Another suffix of the same stem had no value.
+	prev, err = root.Swap(oneKeyTest, testValue, nil)
+	if err != nil {
+		t.Fatalf("error swapping: %v", err)
+	}
+	if prev != nil {
+		t.Fatalf("expected no previous value, got %x", prev)
+	}
+
+	expected := New()
+	for _, k := range [][]byte{forkOneKeyTest, oneKeyTest} {
+		if err := expected.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	if err := expected.Insert(zeroKeyTest, ffx32KeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if !root.Commit().Equal(expected.Commit()) {
+		t.Fatal("Swap and Insert produced different trees")
+	}
+}
+
+func TestGetWithPath(t *testing.T) {
+	t.Parallel()
+
+	root := New().(*InternalNode)
+	for _, k := range [][]byte{zeroKeyTest, forkOneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	branch := root.children[0].(*InternalNode)
+	leaf := branch.children[1].(*LeafNode)
+
+	value, nodes, err := root.GetWithPath(forkOneKeyTest, nil)
+	if err != nil {
+		t.Fatalf("error getting: %v", err)
+	}
+	if !bytes.Equal(value, testValue) {
+		t.Fatalf("invalid value %x", value)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(nodes))
+	}
+	for i, expected := range []struct {
+		path       []byte
+		commitment *Point
+	}{
+		{nil, root.commitment},
+		{[]byte{0}, branch.commitment},
+		{[]byte{0, 1}, leaf.commitment},
+	} {
+		if !bytes.Equal(nodes[i].Path, expected.path) || int(nodes[i].Depth) != len(expected.path) {
+			t.Fatalf("invalid path %x at depth %d for node %d", nodes[i].Path, nodes[i].Depth, i)
+		}
+		if !nodes[i].Commitment.Equal(expected.commitment) {
+			t.Fatalf("invalid commitment for node %d", i)
+		}
+	}
+	if !bytes.Equal(nodes[2].Stem[:], forkOneKeyTest[:StemSize]) {
+		t.Fatalf("invalid leaf stem %x", nodes[2].Stem)
+	}
+
+	// The walk for an absent key stops at the empty child.
+	absent := append([]byte{0, 2}, zeroKeyTest[2:]...)
+	value, nodes, err = root.GetWithPath(absent, nil)
+	if err != nil {
+		t.Fatalf("error getting: %v", err)
+	}
+	if value != nil || len(nodes) != 2 {
+		t.Fatalf("expected no value after 2 nodes, got %x after %d", value, len(nodes))
+	}
+
+	// Hashed nodes are resolved.
+	serialized := map[string][]byte{}
+	root.Flush(func(path []byte, node VerkleNode) {
+		s, err := node.Serialize()
+		if err != nil {
+			panic(err)
+		}
+		serialized[string(path)] = s
+	})
+	resolver := func(path []byte) ([]byte, error) {
+		return serialized[string(path)], nil
+	}
+	value, nodes, err = root.GetWithPath(forkOneKeyTest, resolver)
+	if err != nil {
+		t.Fatalf("error getting from the flushed tree: %v", err)
+	}
+	if !bytes.Equal(value, testValue) || len(nodes) != 3 || !nodes[2].Commitment.Equal(leaf.commitment) {
+		t.Fatal("invalid result from the flushed tree")
+	}
+}
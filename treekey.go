@@ -0,0 +1,256 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// Layout of the account data in the tree, as defined by EIP-6800.
+const (
+	BasicDataLeafKey    = 0
+	CodeHashLeafKey     = 1
+	HeaderStorageOffset = 64
+	CodeOffset          = 128
+)
+
+// treeKeyDomain is the first element of the polynomial committed to when
+// deriving a tree key, 2 + 256*64.
+const treeKeyDomain = 2 + NodeWidth*64
+
+// PedersenHash is the hash function of EIP-6800, that commits to the
+// input split into 16-byte little-endian integers, after a first element
+// that encodes the length of the input, and maps the commitment to a
+// field element, returned in little-endian order. The input is at most
+// 255*16 bytes long. The commitment uses the precomputed tables of the
+// configuration of the tree, and thus matches the keys that the tree
+// expects.
+func PedersenHash(input []byte) ([32]byte, error) {
+	hashes, err := PedersenHashBatch([][]byte{input})
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return hashes[0], nil
+}
+
+// PedersenHashBatch is like PedersenHash for several inputs, and maps all
+// the commitments to field elements in a single batch, which saves a
+// field inversion per input.
+func PedersenHashBatch(inputs [][]byte) ([][32]byte, error) {
+	points := make([]*Point, len(inputs))
+	for i, input := range inputs {
+		if len(input) > (NodeWidth-1)*16 {
+			return nil, fmt.Errorf("pedersen hash input too long: %d > %d", len(input), (NodeWidth-1)*16)
+		}
+		poly := make([]Fr, 1+(len(input)+15)/16)
+		poly[0].SetUint64(2 + NodeWidth*uint64(len(input)))
+		for j := 1; j < len(poly); j++ {
+			_ = FromLEBytes(&poly[j], input[(j-1)*16:min(j*16, len(input))])
+		}
+		points[i] = GetConfig().CommitToPoly(poly, 0)
+	}
+	return hashPointsToBytes(points)
+}
+
+// hashPointsToBytes is a batched HashPointToBytes.
+func hashPointsToBytes(points []*Point) ([][32]byte, error) {
+	frs := make([]*Fr, len(points))
+	for i := range frs {
+		frs[i] = new(Fr)
+	}
+	if err := banderwagon.BatchMapToScalarField(frs, points); err != nil {
+		return nil, fmt.Errorf("batch mapping to scalar fields: %w", err)
+	}
+	hashes := make([][32]byte, len(frs))
+	for i, fr := range frs {
+		hashes[i] = fr.BytesLE()
+	}
+	return hashes, nil
+}
+
+// EvaluateAddressPoint returns the part of the commitment of a tree key
+// that only depends on the address, which is the same for all the keys
+// of an account. The address is left-padded to 32 bytes if it is
+// shorter.
+func EvaluateAddressPoint(address []byte) *Point {
+	var aligned [32]byte
+	copy(aligned[32-len(address):], address)
+
+	// poly = [2+256*64, address_le_low, address_le_high]
+	var poly [3]Fr
+	poly[0].SetUint64(treeKeyDomain)
+	_ = FromLEBytes(&poly[1], aligned[:16])
+	_ = FromLEBytes(&poly[2], aligned[16:])
+	return GetConfig().CommitToPoly(poly[:], 0)
+}
+
+// GetTreeKey returns the key of the value found at subIndex in the leaf
+// number treeIndex, a 32-byte big-endian integer, of an account. The
+// address is left-padded to 32 bytes if it is shorter.
+func GetTreeKey(address []byte, treeIndex [32]byte, subIndex byte) []byte {
+	return GetTreeKeyWithEvaluatedAddress(EvaluateAddressPoint(address), treeIndex, subIndex)
+}
+
+// GetTreeKeyWithEvaluatedAddress is like GetTreeKey, for the address
+// point returned by EvaluateAddressPoint, so that the keys of an account
+// only need to commit to their tree index.
+func GetTreeKeyWithEvaluatedAddress(evaluated *Point, treeIndex [32]byte, subIndex byte) []byte {
+	hash := HashPointToBytes(treeIndexPoint(evaluated, treeIndex))
+	hash[StemSize] = subIndex
+	return hash[:]
+}
+
+// treeIndexPoint adds the commitment to the tree index to the address
+// point.
+func treeIndexPoint(evaluated *Point, treeIndex [32]byte) *Point {
+	// poly = [0, 0, 0, tree_index_le_low, tree_index_le_high]
+	var poly [5]Fr
+	// The tree index is interpreted as a 32-byte little-endian number,
+	// whose low half is the big-endian number found in the last 16
+	// bytes of its big-endian representation.
+	FromBytes(&poly[3], treeIndex[16:])
+	FromBytes(&poly[4], treeIndex[:16])
+	point := GetConfig().CommitToPoly(poly[:], 0)
+	return point.Add(point, evaluated)
+}
+
+// GetTreeKeyBasicData returns the key of the basic data of an account,
+// i.e. its version, code size, nonce and balance.
+func GetTreeKeyBasicData(address []byte) []byte {
+	return GetTreeKey(address, [32]byte{}, BasicDataLeafKey)
+}
+
+// GetTreeKeyCodeHash returns the key of the code hash of an account.
+func GetTreeKeyCodeHash(address []byte) []byte {
+	return GetTreeKey(address, [32]byte{}, CodeHashLeafKey)
+}
+
+// GetTreeKeyStorageSlot returns the key of a storage slot of an account,
+// given as a big-endian integer of at most 32 bytes. The first slots
+// are stored in the leaf of the account header, and the others in the
+// main storage, at an offset of 256^31.
+func GetTreeKeyStorageSlot(address []byte, slot []byte) []byte {
+	var key [32]byte
+	copy(key[32-len(slot):], slot)
+	treeIndex, subIndex := StorageSlotIndex(key)
+	return GetTreeKey(address, treeIndex, subIndex)
+}
+
+// StorageSlotIndex returns the tree index and the sub-index at which a
+// storage slot, given as a 32-byte big-endian integer, is stored. The
+// slots below CodeOffset-HeaderStorageOffset are stored in the leaf of
+// the account header, i.e. at tree index 0, from HeaderStorageOffset on.
+// The others are stored in the main storage, at slot + 256^31, so that
+// slots that only differ in their last byte share a leaf.
+func StorageSlotIndex(slot [32]byte) ([32]byte, byte) {
+	var treeIndex [32]byte
+	if isZero(slot[:31]) && slot[31] < CodeOffset-HeaderStorageOffset {
+		return treeIndex, HeaderStorageOffset + slot[31]
+	}
+	// The tree index is (256^31 + slot) / 256, i.e. slot / 256 + 256^30.
+	// Adding the offset after the division can't overflow.
+	copy(treeIndex[1:], slot[:31])
+	for i := 1; i >= 0; i-- {
+		treeIndex[i]++
+		if treeIndex[i] != 0 {
+			break
+		}
+	}
+	return treeIndex, slot[31]
+}
+
+// Address is the 20-byte address of an account.
+type Address [20]byte
+
+// HashKeys returns the keys of the storage slots slots[i] of the accounts
+// addresses[i]. The address points are only computed once per account,
+// the commitments are spread over the available CPUs, and all of them
+// are mapped to field elements in a single batch.
+func HashKeys(addresses []Address, slots [][32]byte) ([][]byte, error) {
+	if len(addresses) != len(slots) {
+		return nil, fmt.Errorf("incompatible number of addresses and slots: %d != %d", len(addresses), len(slots))
+	}
+	addressPoints := make(map[Address]*Point)
+	for _, address := range addresses {
+		if _, ok := addressPoints[address]; !ok {
+			addressPoints[address] = EvaluateAddressPoint(address[:])
+		}
+	}
+
+	points := make([]*Point, len(slots))
+	subIndexes := make([]byte, len(slots))
+	workers := runtime.NumCPU()
+	batchSize := (len(slots) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(slots); start += batchSize {
+		end := min(start+batchSize, len(slots))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				var treeIndex [32]byte
+				treeIndex, subIndexes[i] = StorageSlotIndex(slots[i])
+				points[i] = treeIndexPoint(addressPoints[addresses[i]], treeIndex)
+			}
+		}()
+	}
+	wg.Wait()
+
+	hashes, err := hashPointsToBytes(points)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, len(hashes))
+	for i := range hashes {
+		hashes[i][StemSize] = subIndexes[i]
+		keys[i] = hashes[i][:]
+	}
+	return keys, nil
+}
+
+// GetTreeKeyCodeChunk returns the key of a 31-byte chunk of the code of
+// an account.
+func GetTreeKeyCodeChunk(address []byte, chunk uint64) []byte {
+	// (CodeOffset + chunk) / 256 and % 256, without overflowing.
+	var treeIndex [32]byte
+	low := chunk%NodeWidth + CodeOffset
+	binary.BigEndian.PutUint64(treeIndex[24:], chunk/NodeWidth+low/NodeWidth)
+	return GetTreeKey(address, treeIndex, byte(low%NodeWidth))
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"container/list"
+	"sync"
+)
+
+// AddressPointCache is a least-recently-used cache of the address points
+// returned by EvaluateAddressPoint, so that the keys of the accounts that
+// are accessed often only need to commit to their tree index. It is safe
+// for concurrent use.
+type AddressPointCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // most recently used first
+	entries map[[32]byte]*list.Element
+}
+
+type addressPointEntry struct {
+	address [32]byte
+	point   *Point
+}
+
+// NewAddressPointCache returns a cache that holds the points of at most
+// size addresses.
+func NewAddressPointCache(size int) *AddressPointCache {
+	return &AddressPointCache{
+		size:    max(size, 1),
+		order:   list.New(),
+		entries: make(map[[32]byte]*list.Element),
+	}
+}
+
+// Get returns the address point of an address, computing it if it isn't
+// in the cache. The point is shared, and must not be modified.
+func (c *AddressPointCache) Get(address []byte) *Point {
+	var aligned [32]byte
+	copy(aligned[32-len(address):], address)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[aligned]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*addressPointEntry).point
+	}
+	c.mu.Unlock()
+
+	// The commitment is computed without holding the lock, so two
+	// goroutines can compute the same point, which is harmless.
+	point := EvaluateAddressPoint(aligned[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[aligned]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*addressPointEntry).point
+	}
+	c.entries[aligned] = c.order.PushFront(&addressPointEntry{address: aligned, point: point})
+	if c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*addressPointEntry)
+		delete(c.entries, oldest.address)
+	}
+	return point
+}
+
+// Len returns the number of cached addresses.
+func (c *AddressPointCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// GetTreeKey is like the GetTreeKey function, using the cached address
+// point.
+func (c *AddressPointCache) GetTreeKey(address []byte, treeIndex [32]byte, subIndex byte) []byte {
+	return GetTreeKeyWithEvaluatedAddress(c.Get(address), treeIndex, subIndex)
+}
+
+// GetTreeKeyStorageSlot is like the GetTreeKeyStorageSlot function, using
+// the cached address point.
+func (c *AddressPointCache) GetTreeKeyStorageSlot(address []byte, slot []byte) []byte {
+	var key [32]byte
+	copy(key[32-len(slot):], slot)
+	treeIndex, subIndex := StorageSlotIndex(key)
+	return c.GetTreeKey(address, treeIndex, subIndex)
+}
@@ -0,0 +1,52 @@
+package verkle
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestAddressPointCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewAddressPointCache(2)
+	a, b, c := []byte{1}, []byte{2}, []byte{3}
+	pa := cache.Get(a)
+	if !pa.Equal(EvaluateAddressPoint(a)) {
+		t.Fatal("invalid address point")
+	}
+	if cache.Get(a) != pa {
+		t.Fatal("the address point wasn't cached")
+	}
+	cache.Get(b)
+	cache.Get(a) // a is now more recent than b
+	cache.Get(c) // evicts b
+	if cache.Len() != 2 {
+		t.Fatalf("invalid cache length %d", cache.Len())
+	}
+	if cache.Get(a) != pa {
+		t.Fatal("the most recently used address was evicted")
+	}
+	// A padded address shares the entry of the unpadded one.
+	if cache.Get(append(make([]byte, 19), a...)) != pa {
+		t.Fatal("the padded address has its own entry")
+	}
+
+	slot := []byte{0xaa, 0xbb}
+	if !bytes.Equal(cache.GetTreeKeyStorageSlot(b, slot), GetTreeKeyStorageSlot(b, slot)) {
+		t.Fatal("invalid storage slot key")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			address := []byte{byte(i % 4)}
+			if !cache.Get(address).Equal(EvaluateAddressPoint(address)) {
+				t.Error("invalid concurrent address point")
+			}
+		}(i)
+	}
+	wg.Wait()
+}
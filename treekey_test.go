@@ -0,0 +1,235 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestTreeKeyLayout(t *testing.T) {
+	t.Parallel()
+
+	address := bytes.Repeat([]byte{0xaa}, 20)
+	basicData := GetTreeKeyBasicData(address)
+	header := KeyToStem(basicData)
+	if basicData[StemSize] != BasicDataLeafKey {
+		t.Fatalf("invalid basic data suffix %d", basicData[StemSize])
+	}
+	var padded [32]byte
+	copy(padded[12:], address)
+	if !bytes.Equal(GetTreeKeyBasicData(padded[:]), basicData) {
+		t.Fatal("the address isn't left-padded")
+	}
+	if !bytes.Equal(GetTreeKeyBasicData(padded[1:]), basicData) {
+		t.Fatal("different keys for the same address")
+	}
+	if KeyToStem(GetTreeKeyBasicData([]byte{1})) == header {
+		t.Fatal("two accounts share a stem")
+	}
+
+	// The header holds the basic data, the code hash, the first 64
+	// storage slots and the first 128 code chunks.
+	for _, tt := range []struct {
+		key    []byte
+		suffix byte
+	}{
+		{GetTreeKeyCodeHash(address), CodeHashLeafKey},
+		{GetTreeKeyStorageSlot(address, []byte{0}), HeaderStorageOffset},
+		{GetTreeKeyStorageSlot(address, []byte{63}), HeaderStorageOffset + 63},
+		{GetTreeKeyCodeChunk(address, 0), CodeOffset},
+		{GetTreeKeyCodeChunk(address, 127), NodeWidth - 1},
+	} {
+		if KeyToStem(tt.key) != header || tt.key[StemSize] != tt.suffix {
+			t.Fatalf("invalid key %x, expected suffix %d of the header", tt.key, tt.suffix)
+		}
+	}
+
+	// Code chunks continue in the following leaves.
+	var index [32]byte
+	index[31] = 1
+	if !bytes.Equal(GetTreeKeyCodeChunk(address, 128), GetTreeKey(address, index, 0)) {
+		t.Fatal("invalid key for code chunk 128")
+	}
+	index[31] = 2
+	if !bytes.Equal(GetTreeKeyCodeChunk(address, 128+256+5), GetTreeKey(address, index, 5)) {
+		t.Fatal("invalid key for code chunk 389")
+	}
+
+	// The other storage slots are in the main storage, at 256^31.
+	var mainStorage [32]byte
+	mainStorage[1] = 1
+	if !bytes.Equal(GetTreeKeyStorageSlot(address, []byte{64}), GetTreeKey(address, mainStorage, 64)) {
+		t.Fatal("invalid key for storage slot 64")
+	}
+	slot := bytes.Repeat([]byte{0xff}, 32)
+	var last [32]byte
+	last[0] = 1
+	for i := 2; i < 32; i++ {
+		last[i] = 0xff
+	}
+	if !bytes.Equal(GetTreeKeyStorageSlot(address, slot), GetTreeKey(address, last, 0xff)) {
+		t.Fatal("invalid key for the last storage slot")
+	}
+}
+
+func TestTreeKeyKnownAnswers(t *testing.T) {
+	t.Parallel()
+
+	// geth precomputes the commitment to the domain marker 2+256*64
+	// alone, which is the tree index point of the zero address at tree
+	// index 0.
+	index0 := []byte{34, 25, 109, 242, 193, 5, 144, 224, 76, 52, 189, 92, 197, 126, 9, 145, 27, 152, 199, 130, 165, 3, 210, 27, 193, 131, 142, 28, 110, 26, 16, 191}
+	var zero [20]byte
+	if b := EvaluateAddressPoint(zero[:]).Bytes(); !bytes.Equal(b[:], index0) {
+		t.Fatalf("invalid point for the zero address, got %x, expected %x", b, index0)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		key      []byte
+		expected string
+	}{
+		{"basic data", GetTreeKeyBasicData(zero[:]), "1a100684fd68185060405f3f160e4bb6e034194336b547bdae323f888d533200"},
+		{"code hash", GetTreeKeyCodeHash(zero[:]), "1a100684fd68185060405f3f160e4bb6e034194336b547bdae323f888d533201"},
+		{"header storage slot 0", GetTreeKeyStorageSlot(zero[:], []byte{0}), "1a100684fd68185060405f3f160e4bb6e034194336b547bdae323f888d533240"},
+		{"code chunk 0", GetTreeKeyCodeChunk(zero[:], 0), "1a100684fd68185060405f3f160e4bb6e034194336b547bdae323f888d533280"},
+		{"main storage slot 64", GetTreeKeyStorageSlot(zero[:], []byte{64}), "2bd13e6125f94c5cb9a9d795c457f911930d2a2e4d8eec18faf6f3697856b540"},
+	} {
+		if got := hex.EncodeToString(tt.key); got != tt.expected {
+			t.Fatalf("invalid %s key, got %s, expected %s", tt.name, got, tt.expected)
+		}
+	}
+
+	// The main storage stem is the Pedersen hash of the address and of
+	// the tree index 256^30, both as 32-byte little-endian integers.
+	input := make([]byte, 64)
+	input[32+30] = 1
+	hash, err := PedersenHash(input)
+	if err != nil {
+		t.Fatalf("error hashing: %v", err)
+	}
+	if expected, _ := hex.DecodeString("2bd13e6125f94c5cb9a9d795c457f911930d2a2e4d8eec18faf6f3697856b5"); !bytes.Equal(hash[:StemSize], expected) {
+		t.Fatalf("invalid main storage stem, got %x, expected %x", hash[:StemSize], expected)
+	}
+}
+
+func TestPedersenHash(t *testing.T) {
+	t.Parallel()
+
+	address := bytes.Repeat([]byte{0xaa}, 32)
+	var treeIndex [32]byte
+	treeIndex[1], treeIndex[31] = 1, 7
+
+	// The tree key of EIP-6800 is the hash of the address followed by
+	// the little-endian tree index.
+	input := append([]byte{}, address...)
+	for i := 31; i >= 0; i-- {
+		input = append(input, treeIndex[i])
+	}
+	hash, err := PedersenHash(input)
+	if err != nil {
+		t.Fatalf("error hashing: %v", err)
+	}
+	key := GetTreeKey(address, treeIndex, 5)
+	if !bytes.Equal(hash[:StemSize], key[:StemSize]) {
+		t.Fatalf("PedersenHash and GetTreeKey disagree: %x != %x", hash, key)
+	}
+	evaluated := EvaluateAddressPoint(address)
+	if !bytes.Equal(GetTreeKeyWithEvaluatedAddress(evaluated, treeIndex, 5), key) {
+		t.Fatal("invalid key from the evaluated address")
+	}
+
+	inputs := [][]byte{input, nil, {1}, bytes.Repeat([]byte{0xff}, 255*16)}
+	hashes, err := PedersenHashBatch(inputs)
+	if err != nil {
+		t.Fatalf("error hashing: %v", err)
+	}
+	for i, input := range inputs {
+		hash, err := PedersenHash(input)
+		if err != nil {
+			t.Fatalf("error hashing: %v", err)
+		}
+		if hash != hashes[i] {
+			t.Fatalf("invalid batched hash %d: %x != %x", i, hashes[i], hash)
+		}
+	}
+	if hashes[1] == hashes[2] {
+		t.Fatal("the length of the input isn't hashed")
+	}
+
+	if _, err := PedersenHash(make([]byte, 255*16+1)); err == nil {
+		t.Fatal("expected an error hashing a too long input")
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	t.Parallel()
+
+	var (
+		addresses []Address
+		slots     [][32]byte
+	)
+	for i := 0; i < 50; i++ {
+		var address Address
+		address[0] = byte(i % 3)
+		var slot [32]byte
+		slot[0], slot[31] = byte(i%2), byte(i)
+		addresses = append(addresses, address)
+		slots = append(slots, slot)
+	}
+	keys, err := HashKeys(addresses, slots)
+	if err != nil {
+		t.Fatalf("error hashing keys: %v", err)
+	}
+	for i := range keys {
+		if expected := GetTreeKeyStorageSlot(addresses[i][:], slots[i][:]); !bytes.Equal(keys[i], expected) {
+			t.Fatalf("invalid key %d: %x != %x", i, keys[i], expected)
+		}
+	}
+
+	if keys, err := HashKeys(nil, nil); err != nil || len(keys) != 0 {
+		t.Fatalf("error hashing no keys: %v", err)
+	}
+	if _, err := HashKeys(addresses, slots[1:]); err == nil {
+		t.Fatal("expected an error with a missing slot")
+	}
+}
+
+func TestStorageSlotIndex(t *testing.T) {
+	t.Parallel()
+
+	slot := func(b ...byte) (s [32]byte) {
+		copy(s[32-len(b):], b)
+		return s
+	}
+	// mainStorage returns the tree index of the main storage group
+	// of the slots slot*256 to slot*256+255.
+	mainStorage := func(slot ...byte) (s [32]byte) {
+		copy(s[32-len(slot):], slot)
+		s[1]++
+		return s
+	}
+	var high [32]byte
+	high[0] = 1
+	for _, tt := range []struct {
+		slot      [32]byte
+		treeIndex [32]byte
+		subIndex  byte
+	}{
+		// The header group.
+		{slot(0), [32]byte{}, HeaderStorageOffset},
+		{slot(63), [32]byte{}, HeaderStorageOffset + 63},
+		// The main storage.
+		{slot(64), mainStorage(), 64},
+		{slot(0xff), mainStorage(), 0xff},
+		{slot(1, 0), mainStorage(1), 0},
+		{slot(1, 0x3f), mainStorage(1), 0x3f},
+		// A slot whose high bytes are set isn't in the header group.
+		{high, mainStorage(high[:31]...), 0},
+	} {
+		treeIndex, subIndex := StorageSlotIndex(tt.slot)
+		if treeIndex != tt.treeIndex || subIndex != tt.subIndex {
+			t.Fatalf("invalid index for slot %x: %x/%d, expected %x/%d", tt.slot, treeIndex, subIndex, tt.treeIndex, tt.subIndex)
+		}
+	}
+}
@@ -25,12 +25,22 @@
 
 package verkle
 
-import "errors"
+import (
+	"errors"
+	"io"
+)
 
+// ErrMissingNodeInStateless is returned when accessing a part of a
+// stateless tree that is missing from the witness it was built from.
+var ErrMissingNodeInStateless = errors.New("trying to access a node that is missing from the stateless view")
+
+// UnknownNode is a node of a stateless tree that is missing from the
+// witness the tree was built from. Unlike Empty, it says nothing about
+// the content of its subtree, and unlike HashedNode, it can't be resolved.
 type UnknownNode struct{}
 
 func (UnknownNode) Insert([]byte, []byte, NodeResolverFn) error {
-	return errMissingNodeInStateless
+	return ErrMissingNodeInStateless
 }
 
 func (UnknownNode) Delete([]byte, NodeResolverFn) (bool, error) {
@@ -38,9 +48,12 @@ func (UnknownNode) Delete([]byte, NodeResolverFn) (bool, error) {
 }
 
 func (UnknownNode) Get([]byte, NodeResolverFn) ([]byte, error) {
-	return nil, nil
+	return nil, ErrMissingNodeInStateless
 }
 
+// Commit returns the identity, like Commitment. The commitment of a node
+// that is missing from the witness can't be computed, so an internal node
+// refuses to commit a modified child that is unknown.
 func (n UnknownNode) Commit() *Point {
 	return n.Commitment()
 }
@@ -59,6 +72,15 @@ func (UnknownNode) Serialize() ([]byte, error) {
 	return nil, errors.New("trying to serialize a subtree missing from the statless view")
 }
 
+func (u UnknownNode) SerializeTo(io.Writer) (int, error) {
+	_, err := u.Serialize()
+	return 0, err
+}
+
+func (UnknownNode) Size() int {
+	return 0
+}
+
 func (UnknownNode) Copy() VerkleNode {
 	return UnknownNode(struct{}{})
 }
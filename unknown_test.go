@@ -1,20 +1,23 @@
 package verkle
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestUnknownFuncs(t *testing.T) {
 	t.Parallel()
 
 	un := UnknownNode{}
 
-	if err := un.Insert(nil, nil, nil); err != errMissingNodeInStateless {
-		t.Errorf("got %v, want %v", err, errMissingNodeInStateless)
+	if err := un.Insert(nil, nil, nil); err != ErrMissingNodeInStateless {
+		t.Errorf("got %v, want %v", err, ErrMissingNodeInStateless)
 	}
 	if _, err := un.Delete(nil, nil); err == nil {
 		t.Errorf("got nil error when deleting from a hashed node")
 	}
-	if _, err := un.Get(nil, nil); err != nil {
-		t.Errorf("got %v, want nil", err)
+	if _, err := un.Get(nil, nil); err != ErrMissingNodeInStateless {
+		t.Errorf("got %v, want %v", err, ErrMissingNodeInStateless)
 	}
 	var identity Point
 	identity.SetIdentity()
@@ -40,3 +43,40 @@ func TestUnknownFuncs(t *testing.T) {
 		t.Errorf("hash returned non-zero")
 	}
 }
+
+func TestCommitDirtyUnknownNode(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	if err := root.Insert(zeroKeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	if err := root.Insert(ffx32KeyTest, testValue, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	rootC := root.Commit()
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, [][]byte{zeroKeyTest}, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	stateless, err := PreStateTreeFromProof(proof, rootC)
+	if err != nil {
+		t.Fatalf("error rebuilding the tree: %v", err)
+	}
+	sn := stateless.(*InternalNode)
+	if _, ok := sn.children[NodeWidth-1].(UnknownNode); !ok {
+		t.Fatalf("expected an unknown branch, got %T", sn.children[NodeWidth-1])
+	}
+
+	// Mark the unknown branch as modified: its commitment can't be
+	// folded into that of the root.
+	sn.cowChild(NodeWidth - 1)
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, ErrMissingNodeInStateless) {
+			t.Fatalf("got %v, want a panic with %v", err, ErrMissingNodeInStateless)
+		}
+	}()
+	sn.Commit()
+	t.Fatal("committed a modified unknown branch")
+}
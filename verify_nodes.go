@@ -0,0 +1,142 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
+)
+
+// ErrUnverifiableNode is returned by VerifyNodes when a node doesn't bind to
+// the commitment its parent expects, or can't be linked to the root.
+var ErrUnverifiableNode = errors.New("node can't be verified")
+
+// VerifyNodes parses the nodes serialized[i], found at paths[i], as received
+// from an untrusted peer, and checks that they belong to the tree whose root
+// commitment is trusted. The commitment of a leaf is recomputed from its
+// values, and that of an internal node from the commitments of its
+// children, so the nodes must form a complete subtree: the root, and every
+// child of every internal node. The parsed nodes are returned in the order
+// of paths.
+func VerifyNodes(root *Point, paths [][]byte, serialized [][]byte) ([]VerkleNode, error) {
+	return verifySubtreeNodes(root, nil, paths, serialized)
+}
+
+// verifySubtreeNodes is like VerifyNodes, for the subtree found at rootPath
+// whose commitment is root.
+func verifySubtreeNodes(root *Point, rootPath []byte, paths [][]byte, serialized [][]byte) ([]VerkleNode, error) {
+	if len(paths) != len(serialized) {
+		return nil, fmt.Errorf("incompatible number of paths and nodes: %d != %d", len(paths), len(serialized))
+	}
+	nodes := make([]VerkleNode, len(paths))
+	byPath := make(map[string]int, len(paths))
+	for i, path := range paths {
+		if len(path) > StemSize || !bytes.HasPrefix(path, rootPath) {
+			return nil, fmt.Errorf("invalid path %x", path)
+		}
+		if _, ok := byPath[string(path)]; ok {
+			return nil, fmt.Errorf("duplicate node at path %x", path)
+		}
+		node, err := ParseNode(serialized[i], byte(len(path)))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing node at path %x: %w", path, err)
+		}
+		switch n := node.(type) {
+		case *InternalNode:
+		case *LeafNode:
+			if !bytes.HasPrefix(n.stem[:], path) {
+				return nil, fmt.Errorf("%w: leaf stem %x isn't under path %x", ErrUnverifiableNode, n.stem, path)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected node of type %T at path %x", node, path)
+		}
+		nodes[i] = node
+		byPath[string(path)] = i
+	}
+
+	// Walk down from the root, trusting the commitments of the children of
+	// each verified internal node.
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return len(paths[order[i]]) < len(paths[order[j]]) })
+	trusted := map[string]*Point{string(rootPath): root}
+	for _, i := range order {
+		path := paths[i]
+		expected, ok := trusted[string(path)]
+		if !ok {
+			return nil, fmt.Errorf("%w: no parent links the node at path %x to the root", ErrUnverifiableNode, path)
+		}
+		switch n := nodes[i].(type) {
+		case *LeafNode:
+			recomputed, err := NewLeafNode(n.stem, n.values)
+			if err != nil {
+				return nil, fmt.Errorf("error computing the commitment of leaf %x: %w", n.stem, err)
+			}
+			if !recomputed.commitment.Equal(expected) {
+				return nil, fmt.Errorf("%w: leaf at path %x doesn't match its commitment", ErrUnverifiableNode, path)
+			}
+		case *InternalNode:
+			if !n.commitment.Equal(expected) {
+				return nil, fmt.Errorf("%w: internal node at path %x doesn't match its commitment", ErrUnverifiableNode, path)
+			}
+			var (
+				poly       [NodeWidth]Fr
+				frs        []*Fr
+				points     []*Point
+				childPaths []string
+			)
+			for c, child := range n.children {
+				if _, ok := child.(Empty); ok {
+					continue
+				}
+				childPath := string(append(path[:len(path):len(path)], byte(c)))
+				j, ok := byPath[childPath]
+				if !ok {
+					return nil, fmt.Errorf("%w: child %d of the internal node at path %x is missing", ErrUnverifiableNode, c, path)
+				}
+				frs = append(frs, &poly[c])
+				points = append(points, nodes[j].Commitment())
+				childPaths = append(childPaths, childPath)
+			}
+			if err := banderwagon.BatchMapToScalarField(frs, points); err != nil {
+				return nil, fmt.Errorf("batch mapping to scalar fields: %w", err)
+			}
+			if !GetConfig().CommitToPoly(poly[:], 0).Equal(n.commitment) {
+				return nil, fmt.Errorf("%w: children of the internal node at path %x don't match its commitment", ErrUnverifiableNode, path)
+			}
+			for k, childPath := range childPaths {
+				trusted[childPath] = points[k]
+			}
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,51 @@
+package verkle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyNodes(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range randomKeys(t, 100) {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	rootC := root.Commit()
+	serializedNodes, err := root.(*InternalNode).BatchSerialize()
+	if err != nil {
+		t.Fatalf("error serializing tree: %v", err)
+	}
+	paths := make([][]byte, len(serializedNodes))
+	blobs := make([][]byte, len(serializedNodes))
+	for i, sn := range serializedNodes {
+		paths[i], blobs[i] = sn.Path, sn.SerializedBytes
+	}
+	if _, err := VerifyNodes(rootC, paths, blobs); err != nil {
+		t.Fatalf("error verifying nodes: %v", err)
+	}
+
+	// A node that doesn't bind to the root must be rejected.
+	var otherRoot Point
+	otherRoot.Add(rootC, rootC)
+	if _, err := VerifyNodes(&otherRoot, paths, blobs); !errors.Is(err, ErrUnverifiableNode) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrUnverifiableNode)
+	}
+
+	// So must a missing node.
+	if _, err := VerifyNodes(rootC, paths[:len(paths)-1], blobs[:len(blobs)-1]); !errors.Is(err, ErrUnverifiableNode) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrUnverifiableNode)
+	}
+
+	// And a leaf whose value was tampered with.
+	last := len(blobs) - 1
+	tampered := append([]byte{}, blobs[last]...)
+	tampered[len(tampered)-1] ^= 1
+	blobs[last] = tampered
+	if _, err := VerifyNodes(rootC, paths, blobs); !errors.Is(err, ErrUnverifiableNode) {
+		t.Fatalf("invalid error, got %v, expected %v", err, ErrUnverifiableNode)
+	}
+}
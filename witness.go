@@ -0,0 +1,98 @@
+// This is free and unencumbered software released into the public domain.
+//
+// Anyone is free to copy, modify, publish, use, compile, sell, or
+// distribute this software, either in source code form or as a compiled
+// binary, for any purpose, commercial or non-commercial, and by any
+// means.
+//
+// In jurisdictions that recognize copyright laws, the author or authors
+// of this software dedicate any and all copyright interest in the
+// software to the public domain. We make this dedication for the benefit
+// of the public at large and to the detriment of our heirs and
+// successors. We intend this dedication to be an overt act of
+// relinquishment in perpetuity of all present and future rights to this
+// software under copyright law.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS BE LIABLE FOR ANY CLAIM, DAMAGES OR
+// OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE,
+// ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR
+// OTHER DEALINGS IN THE SOFTWARE.
+//
+// For more information, please refer to <https://unlicense.org>
+
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var errWitnessMissingProof = errors.New("witness has no proof")
+
+// ExecutionWitness is the witness that EIP-6800 adds to block payloads:
+// the state diff of every location accessed by the block, and the proof
+// of their pre-state values.
+type ExecutionWitness struct {
+	StateDiff   StateDiff    `json:"stateDiff"`
+	VerkleProof *VerkleProof `json:"verkleProof"`
+}
+
+// NewExecutionWitness builds the execution witness for a proof created with
+// MakeVerkleMultiProof.
+func NewExecutionWitness(proof *Proof) (*ExecutionWitness, error) {
+	vp, sd, err := SerializeProof(proof)
+	if err != nil {
+		return nil, fmt.Errorf("serializing proof: %w", err)
+	}
+	return &ExecutionWitness{StateDiff: sd, VerkleProof: vp}, nil
+}
+
+// Proof deserializes the proof carried by the witness.
+func (ew *ExecutionWitness) Proof() (*Proof, error) {
+	if ew.VerkleProof == nil {
+		return nil, errWitnessMissingProof
+	}
+	return DeserializeProof(ew.VerkleProof, ew.StateDiff)
+}
+
+// Verify checks the witness against the pre- and post-state roots of the
+// block that carries it, see Verify.
+func (ew *ExecutionWitness) Verify(preStateRoot, postStateRoot []byte) error {
+	if ew.VerkleProof == nil {
+		return errWitnessMissingProof
+	}
+	return Verify(ew.VerkleProof, preStateRoot, postStateRoot, ew.StateDiff)
+}
+
+// EstimateProofSize returns the length of the SSZ-encoded execution witness
+// proving the values of keys in root, without building the IPA argument,
+// whose size is fixed. The estimate assumes that the keys aren't written
+// to, i.e. that the state diff has no new values; each new value adds 32
+// bytes to the witness.
+func EstimateProofSize(root VerkleNode, keys [][]byte, resolver NodeResolverFn) (int, error) {
+	// Proof generation sorts the keys in place, don't modify the caller's.
+	keys = append([][]byte{}, keys...)
+	pe, es, poas, _, err := getProofElementsFromTree(root, nil, keys, resolver)
+	if err != nil {
+		return 0, fmt.Errorf("get commitments for multiproof: %w", err)
+	}
+
+	// The root commitment isn't part of the proof.
+	size := sszWitnessFixed + sszVerkleProofFixed + len(poas)*StemSize + len(es) + (len(pe.ByPath)-1)*32
+	var stem []byte
+	for i, key := range keys {
+		if stem == nil || !bytes.Equal(stem, key[:StemSize]) {
+			stem = key[:StemSize]
+			size += sszOffsetSize + sszStemDiffFixed
+		}
+		size += sszOffsetSize + sszSuffixDiffFixed + 2
+		if len(pe.Vals[i]) > 0 {
+			size += 32
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,101 @@
+package verkle
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExecutionWitness(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	for _, k := range [][]byte{zeroKeyTest, oneKeyTest, ffx32KeyTest} {
+		if err := root.Insert(k, fourtyKeyTest, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+	postroot := root.Copy()
+	if err := postroot.Insert(oneKeyTest, zeroKeyTest, nil); err != nil {
+		t.Fatalf("error inserting: %v", err)
+	}
+	postroot.Commit()
+
+	proof, _, _, _, err := MakeVerkleMultiProof(root, postroot, [][]byte{zeroKeyTest, oneKeyTest, fourtyKeyTest}, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	witness, err := NewExecutionWitness(proof)
+	if err != nil {
+		t.Fatalf("error creating witness: %v", err)
+	}
+	preRoot, postRoot := root.Commitment().Bytes(), postroot.Commitment().Bytes()
+	if err := witness.Verify(preRoot[:], postRoot[:]); err != nil {
+		t.Fatalf("error verifying witness: %v", err)
+	}
+
+	encoded, err := witness.MarshalSSZ()
+	if err != nil {
+		t.Fatalf("error encoding witness: %v", err)
+	}
+	var decoded ExecutionWitness
+	if err := decoded.UnmarshalSSZ(encoded); err != nil {
+		t.Fatalf("error decoding witness: %v", err)
+	}
+	if err := decoded.StateDiff.Equal(witness.StateDiff); err != nil {
+		t.Fatalf("decoded state diff differs: %v", err)
+	}
+	if err := decoded.VerkleProof.Equal(witness.VerkleProof); err != nil {
+		t.Fatalf("decoded proof differs: %v", err)
+	}
+
+	encoded, err = json.Marshal(witness)
+	if err != nil {
+		t.Fatalf("error encoding witness: %v", err)
+	}
+	decoded = ExecutionWitness{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("error decoding witness: %v", err)
+	}
+	if err := decoded.Verify(preRoot[:], postRoot[:]); err != nil {
+		t.Fatalf("error verifying decoded witness: %v", err)
+	}
+	if _, err := decoded.Proof(); err != nil {
+		t.Fatalf("error deserializing proof: %v", err)
+	}
+}
+
+func TestEstimateProofSize(t *testing.T) {
+	t.Parallel()
+
+	root := New()
+	keys := randomKeys(t, 100)
+	for _, k := range keys {
+		if err := root.Insert(k, testValue, nil); err != nil {
+			t.Fatalf("error inserting: %v", err)
+		}
+	}
+	root.Commit()
+
+	// Mix present keys, absent keys, and several keys of the same stem.
+	proveKeys := [][]byte{keys[0], keys[5], zeroKeyTest, ffx32KeyTest, append(keys[5][:StemSize:StemSize], keys[5][StemSize]+1)}
+	estimate, err := EstimateProofSize(root, proveKeys, nil)
+	if err != nil {
+		t.Fatalf("error estimating proof size: %v", err)
+	}
+	proof, _, _, _, err := MakeVerkleMultiProof(root, nil, proveKeys, nil)
+	if err != nil {
+		t.Fatalf("error creating proof: %v", err)
+	}
+	witness, err := NewExecutionWitness(proof)
+	if err != nil {
+		t.Fatalf("error creating witness: %v", err)
+	}
+	encoded, err := witness.MarshalSSZ()
+	if err != nil {
+		t.Fatalf("error encoding witness: %v", err)
+	}
+	if estimate != len(encoded) {
+		t.Fatalf("invalid estimate, got %d, expected %d", estimate, len(encoded))
+	}
+}